@@ -0,0 +1,73 @@
+package Audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// GenerateKeyFiles writes a new ed25519 key pair as hex to privatePath and publicPath. It fails when either file
+// exists, overwriting a key would leave the checkpoints it signed without a key to verify them.
+func GenerateKeyFiles(privatePath, publicPath string) error {
+	for _, path := range []string{privatePath, publicPath} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("key file %s already exists", path)
+		}
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := writeNewFile(privatePath, hex.EncodeToString(private)+"\n", 0o600); err != nil {
+		return fmt.Errorf("error writing private key: %w", err)
+	}
+	if err := writeNewFile(publicPath, hex.EncodeToString(public)+"\n", 0o644); err != nil {
+		os.Remove(privatePath)
+		return fmt.Errorf("error writing public key: %w", err)
+	}
+	return nil
+}
+
+// writeNewFile writes data to path, which must not exist yet
+func writeNewFile(path, data string, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadPrivateKey reads a hex private key written by GenerateKeyFiles
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	key, err := loadHexKey(path, ed25519.PrivateKeySize)
+	return ed25519.PrivateKey(key), err
+}
+
+// LoadPublicKey reads a hex public key written by GenerateKeyFiles
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	key, err := loadHexKey(path, ed25519.PublicKeySize)
+	return ed25519.PublicKey(key), err
+}
+
+func loadHexKey(path string, size int) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key %s: %w", path, err)
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("key %s has %d bytes, expected %d", path, len(key), size)
+	}
+	return key, nil
+}
@@ -0,0 +1,285 @@
+package Audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Journal"
+	"mcs/TestDesign/Timing"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+/*
+This package keeps a tamper-evident audit log of the command history of a MasterController. Every record holds the
+SHA-256 hash of the record before it, and its own hash covers that link, so editing, inserting or deleting a record
+breaks the chain from that record on. Every CheckpointEvery records, and when the log is closed, a checkpoint record
+signs the hash of the chain so far with an ed25519 key. The chain can be checked with Verify, or with
+`mcs audit verify`, using only the public key.
+
+The chain can't tell a log whose tail was deleted, checkpoints included, from a log that ended there: what is left
+still checks out. To detect that, keep the last record reported by a verify (its Anchor) outside of the log, and
+pass it to the next verify, which fails when that record is gone or was changed.
+
+The records are JSON lines in a single append-only file. OpenLog removes a last record that was only partly
+written and refuses to continue a chain that doesn't verify. The audited entries are the ones the Journal package
+writes, without the notifications.
+*/
+
+type RecordType string
+
+const (
+	RecordEntry      RecordType = "entry"
+	RecordCheckpoint RecordType = "checkpoint"
+)
+
+const defaultCheckpointEvery = 100
+
+type Record struct {
+	Seq   uint64         `json:"seq"`
+	Time  time.Time      `json:"time"`
+	Type  RecordType     `json:"type"`
+	Entry *Journal.Entry `json:"entry,omitempty"`
+	// Prev is the hash of the previous record, empty for the first record
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+	// Signature is the ed25519 signature of Hash, checkpoints only
+	Signature string `json:"signature,omitempty"`
+}
+
+// hashedRecord holds the fields of a record that are covered by its hash
+type hashedRecord struct {
+	Seq   uint64         `json:"seq"`
+	Time  time.Time      `json:"time"`
+	Type  RecordType     `json:"type"`
+	Entry *Journal.Entry `json:"entry,omitempty"`
+	Prev  string         `json:"prev"`
+}
+
+// computeHash returns the hex SHA-256 hash of the hashed fields of r
+func (r Record) computeHash() (string, error) {
+	data, err := json.Marshal(hashedRecord{Seq: r.Seq, Time: r.Time, Type: r.Type, Entry: r.Entry, Prev: r.Prev})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type Options struct {
+	// CheckpointEvery is the number of entries between two checkpoints, zero uses 100
+	CheckpointEvery int
+	// Clock timestamps the records, nil uses the real clock
+	Clock Timing.Clock
+}
+
+type Log struct {
+	file        *os.File
+	key         ed25519.PrivateKey
+	options     Options
+	lastSeq     uint64
+	lastHash    string
+	uncommitted int
+	mu          sync.Mutex
+}
+
+// OpenLog opens the audit log at path for appending, new records continue the chain that is already in the file
+func OpenLog(path string, key ed25519.PrivateKey, options Options) (*Log, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	if options.CheckpointEvery <= 0 {
+		options.CheckpointEvery = defaultCheckpointEvery
+	}
+	if options.Clock == nil {
+		options.Clock = Timing.RealClock{}
+	}
+
+	l := &Log{key: key, options: options}
+	if err := l.readTail(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// readTail continues the chain after the last record of an existing log. A last record that was only partly
+// written, when the process died while appending it, is removed first. The rest of the chain has to verify, new
+// records aren't chained to a log that was tampered with.
+func (l *Log) readTail(path string) error {
+	removed, err := repairTail(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		fmt.Printf("Removed %d bytes of an incomplete audit record from %s\n", removed, path)
+	}
+
+	result, err := VerifyFile(path, l.key.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	if len(result.Problems) > 0 {
+		return fmt.Errorf("audit log %s doesn't verify, %s", path, result.Problems[0])
+	}
+	l.lastSeq = result.Last.Seq
+	l.lastHash = result.Last.Hash
+	l.uncommitted = result.Unsigned
+	return nil
+}
+
+// repairTail truncates the last line of the log at path when it is incomplete or can't be decoded, and returns
+// the number of bytes it removed
+func repairTail(path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset, lastStart int64
+	var last []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lastStart, last = offset, line
+			offset += int64(len(line))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading audit log: %w", err)
+		}
+	}
+	if last == nil {
+		return 0, nil
+	}
+	var record Record
+	if last[len(last)-1] == '\n' && json.Unmarshal(last, &record) == nil {
+		return 0, nil
+	}
+	if err := file.Truncate(lastStart); err != nil {
+		return 0, fmt.Errorf("error truncating audit log: %w", err)
+	}
+	return offset - lastStart, nil
+}
+
+// Attach audits the commands, registrations and state changes of mc from now on
+func (l *Log) Attach(mc *TestDesign.MasterController) {
+	mc.AddEventListener(func(event TestDesign.Event) {
+		entry, ok := Journal.EntryFromEvent(event)
+		if !ok || entry.Type == Journal.EntryNotify {
+			return
+		}
+		if _, err := l.Append(entry); err != nil {
+			fmt.Printf("Error writing audit record: %v\n", err)
+		}
+	})
+}
+
+// Append chains entry to the log and writes a checkpoint when CheckpointEvery entries aren't signed yet
+func (l *Log) Append(entry Journal.Entry) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return Record{}, errors.New("audit log is closed")
+	}
+	record, err := l.write(RecordEntry, &entry)
+	if err != nil {
+		return record, err
+	}
+	l.uncommitted++
+	if l.uncommitted >= l.options.CheckpointEvery {
+		if _, err := l.write(RecordCheckpoint, nil); err != nil {
+			return record, err
+		}
+		l.uncommitted = 0
+	}
+	return record, nil
+}
+
+// Checkpoint signs the chain so far
+func (l *Log) Checkpoint() (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return Record{}, errors.New("audit log is closed")
+	}
+	record, err := l.write(RecordCheckpoint, nil)
+	if err == nil {
+		l.uncommitted = 0
+	}
+	return record, err
+}
+
+// write must be called with the lock held
+func (l *Log) write(recordType RecordType, entry *Journal.Entry) (Record, error) {
+	record := Record{
+		Seq:   l.lastSeq + 1,
+		Time:  l.options.Clock.Now().UTC(),
+		Type:  recordType,
+		Entry: entry,
+		Prev:  l.lastHash,
+	}
+	if entry != nil {
+		entry.Seq = record.Seq
+		entry.Time = entry.Time.UTC()
+	}
+	hash, err := record.computeHash()
+	if err != nil {
+		return record, fmt.Errorf("error hashing audit record: %w", err)
+	}
+	record.Hash = hash
+	if recordType == RecordCheckpoint {
+		record.Signature = hex.EncodeToString(ed25519.Sign(l.key, []byte(hash)))
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return record, fmt.Errorf("error encoding audit record: %w", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return record, fmt.Errorf("error writing audit record: %w", err)
+	}
+	l.lastSeq = record.Seq
+	l.lastHash = record.Hash
+	return record, nil
+}
+
+// Close signs the records that aren't covered by a checkpoint yet and closes the file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	var err error
+	if l.uncommitted > 0 {
+		_, err = l.write(RecordCheckpoint, nil)
+	}
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
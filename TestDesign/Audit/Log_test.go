@@ -0,0 +1,87 @@
+package Audit
+
+import (
+	"crypto/rand"
+	"mcs/TestDesign/Journal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+// writeLog writes entries records to a new log at path, and closes it when closed is set
+func writeLog(t *testing.T, path string, key ed25519.PrivateKey, entries int, closed bool) *Log {
+	t.Helper()
+	log, err := OpenLog(path, key, Options{CheckpointEvery: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < entries; i++ {
+		if _, err := log.Append(Journal.Entry{Type: Journal.EntryPublish, PublisherID: "module", Topic: "topic"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closed {
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return log
+}
+
+func TestOpenLogRemovesATornLastRecord(t *testing.T) {
+	public, private := newKey(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeLog(t, path, private, 5, true)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The process died while appending a record
+	if _, err := file.WriteString(`{"seq":8,"time":"2026-`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	log := writeLog(t, path, private, 2, false)
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := VerifyFile(path, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid() || result.Records != 10 {
+		t.Fatalf("log with %d records doesn't verify: %v", result.Records, result.Problems)
+	}
+}
+
+func TestOpenLogRefusesATamperedLog(t *testing.T) {
+	_, private := newKey(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeLog(t, path, private, 5, true)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `"topic":"topic"`, `"topic":"other"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLog(path, private, Options{}); err == nil {
+		t.Fatal("opened a tampered log for appending")
+	}
+}
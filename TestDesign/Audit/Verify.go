@@ -0,0 +1,183 @@
+package Audit
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+type Problem struct {
+	Line    int
+	Seq     uint64
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d (record %d): %s", p.Line, p.Seq, p.Message)
+}
+
+// Anchor identifies a record by its sequence number and hash. An anchor kept outside of the log, such as the Last
+// record of an earlier verify, detects the deletion of the tail of the log, which the chain itself can't.
+type Anchor struct {
+	Seq  uint64
+	Hash string
+}
+
+// ParseAnchor parses the "seq:hash" form of String
+func ParseAnchor(s string) (Anchor, error) {
+	seq, hash, ok := strings.Cut(s, ":")
+	if !ok || hash == "" {
+		return Anchor{}, fmt.Errorf("anchor %q isn't of the form seq:hash", s)
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return Anchor{}, fmt.Errorf("anchor %q has an invalid sequence number: %w", s, err)
+	}
+	return Anchor{Seq: n, Hash: hash}, nil
+}
+
+func (a Anchor) String() string {
+	return fmt.Sprintf("%d:%s", a.Seq, a.Hash)
+}
+
+type VerifyResult struct {
+	Records        int
+	Checkpoints    int
+	LastCheckpoint uint64
+	// Unsigned is the number of records after the last checkpoint. Records removed from the end of the log,
+	// checkpoints included, can only be detected with an anchor.
+	Unsigned int
+	// Anchored is the last record an anchor matched, records up to it are vouched for by the anchor
+	Anchored uint64
+	// Last is the anchor of the last record of the log
+	Last     Anchor
+	Problems []Problem
+}
+
+// Valid reports whether the log checks out and every record is covered by a checkpoint or an anchor. Records after
+// the last checkpoint can be rewritten with their hashes recomputed, only an anchor can vouch for them.
+func (r VerifyResult) Valid() bool {
+	return len(r.Problems) == 0 && !r.unverified()
+}
+
+// unverified reports whether records after the last checkpoint aren't covered by an anchor
+func (r VerifyResult) unverified() bool {
+	return r.Unsigned > 0 && r.Anchored < r.Last.Seq
+}
+
+func (r VerifyResult) Write(w io.Writer) {
+	for _, problem := range r.Problems {
+		fmt.Fprintf(w, "  %s\n", problem)
+	}
+	status := "OK"
+	switch {
+	case len(r.Problems) > 0:
+		status = "TAMPERED"
+	case r.unverified():
+		status = "UNSIGNED"
+	}
+	fmt.Fprintf(w, "%s %d records, %d checkpoints, last checkpoint at record %d\n", status, r.Records, r.Checkpoints, r.LastCheckpoint)
+	if r.unverified() {
+		fmt.Fprintf(w, "  %d records after the last checkpoint aren't signed and could have been rewritten\n", r.Unsigned)
+	} else if r.Unsigned > 0 {
+		fmt.Fprintf(w, "  %d records after the last checkpoint aren't signed, an anchor covers them\n", r.Unsigned)
+	}
+	if r.Valid() && r.Records > 0 {
+		fmt.Fprintf(w, "  last record %s, keep it to pass as -anchor to the next verify\n", r.Last)
+	}
+}
+
+// VerifyFile verifies the audit log at path, see Verify
+func VerifyFile(path string, key ed25519.PublicKey, anchors ...Anchor) (VerifyResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return VerifyResult{}, fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer file.Close()
+	return Verify(file, key, anchors...)
+}
+
+// Verify checks that the sequence numbers are consecutive, that every record is linked to the record before it,
+// that every hash matches its record, that every checkpoint is signed by key and that the log holds the record of
+// every anchor. It returns an error when the log can't be read, a log that doesn't check out is reported through
+// the problems of the result, and a log whose last records are neither signed nor anchored isn't Valid either.
+func Verify(r io.Reader, key ed25519.PublicKey, anchors ...Anchor) (VerifyResult, error) {
+	var result VerifyResult
+	if len(key) != ed25519.PublicKeySize {
+		return result, fmt.Errorf("invalid ed25519 public key")
+	}
+	report := func(line int, seq uint64, format string, args ...interface{}) {
+		result.Problems = append(result.Problems, Problem{Line: line, Seq: seq, Message: fmt.Sprintf(format, args...)})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	var lastSeq uint64
+	lastHash := ""
+	for scanner.Scan() {
+		line++
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			report(line, lastSeq+1, "record can't be decoded: %v", err)
+			continue
+		}
+		result.Records++
+
+		if record.Seq != lastSeq+1 {
+			report(line, record.Seq, "expected record %d, records were inserted or deleted", lastSeq+1)
+		}
+		if record.Prev != lastHash {
+			report(line, record.Seq, "link to the previous record is broken")
+		}
+		if hash, err := record.computeHash(); err != nil || hash != record.Hash {
+			report(line, record.Seq, "hash doesn't match the record, the record was modified")
+		}
+		if record.Entry != nil && record.Entry.Seq != record.Seq {
+			report(line, record.Seq, "entry has sequence number %d", record.Entry.Seq)
+		}
+
+		switch record.Type {
+		case RecordCheckpoint:
+			result.Checkpoints++
+			signature, err := hex.DecodeString(record.Signature)
+			if err != nil || !ed25519.Verify(key, []byte(record.Hash), signature) {
+				report(line, record.Seq, "checkpoint signature is invalid")
+			} else {
+				result.LastCheckpoint = record.Seq
+				result.Unsigned = 0
+			}
+		case RecordEntry:
+			result.Unsigned++
+		default:
+			report(line, record.Seq, "unknown record type %q", record.Type)
+		}
+
+		for _, anchor := range anchors {
+			if anchor.Seq != record.Seq {
+				continue
+			}
+			if anchor.Hash != record.Hash {
+				report(line, record.Seq, "record doesn't match anchor %s", anchor)
+			} else if record.Seq > result.Anchored {
+				result.Anchored = record.Seq
+			}
+		}
+		lastSeq = record.Seq
+		lastHash = record.Hash
+	}
+	result.Last = Anchor{Seq: lastSeq, Hash: lastHash}
+	for _, anchor := range anchors {
+		if anchor.Seq > lastSeq {
+			report(line, anchor.Seq, "log ends at record %d before anchor %s, its tail was deleted", lastSeq, anchor)
+		}
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,175 @@
+package Audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestVerifyRequiresUnsignedRecordsToBeAnchored(t *testing.T) {
+	public, private := newKey(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// 4 entries with a checkpoint after the third leave the fourth unsigned
+	writeLog(t, path, private, 4, false)
+
+	result, err := VerifyFile(path, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid() || len(result.Problems) > 0 || result.Unsigned != 1 {
+		t.Fatalf("verified %+v, expected one unsigned record that isn't valid", result)
+	}
+	var output bytes.Buffer
+	result.Write(&output)
+	if !strings.HasPrefix(output.String(), "UNSIGNED ") {
+		t.Fatalf("reported %q", output.String())
+	}
+
+	anchored, err := VerifyFile(path, public, result.Last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !anchored.Valid() {
+		t.Fatalf("anchored log doesn't verify: %+v", anchored)
+	}
+}
+
+func TestVerifyDetectsARewrittenUnsignedRecord(t *testing.T) {
+	public, private := newKey(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeLog(t, path, private, 4, false)
+	before, err := VerifyFile(path, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the unsigned record and recompute its hash, the chain still checks out
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	record := decodeRecord(t, lines[len(lines)-1])
+	record.Entry.Topic = "rewritten"
+	record.Hash, _ = record.computeHash()
+	lines[len(lines)-1] = encodeRecord(t, record)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := VerifyFile(path, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid() {
+		t.Fatal("a rewritten unsigned record verifies")
+	}
+	if anchored, _ := VerifyFile(path, public, before.Last); anchored.Valid() || len(anchored.Problems) == 0 {
+		t.Fatalf("the anchor of the original record didn't detect the rewrite: %+v", anchored)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	public, private := newKey(t)
+	other, _ := newKey(t)
+	for _, c := range []struct {
+		name   string
+		tamper func(t *testing.T, lines []string) []string
+		// key verifies instead of the key that signed
+		key ed25519.PublicKey
+		// anchored verifies with the anchor of the untampered log
+		anchored bool
+	}{
+		{name: "untampered"},
+		{name: "modified entry", tamper: func(t *testing.T, lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"topic":"topic"`, `"topic":"other"`, 1)
+			return lines
+		}},
+		{name: "modified entry with its hash recomputed", tamper: func(t *testing.T, lines []string) []string {
+			record := decodeRecord(t, lines[1])
+			record.Entry.Topic = "other"
+			record.Hash, _ = record.computeHash()
+			lines[1] = encodeRecord(t, record)
+			return lines
+		}},
+		{name: "deleted record", tamper: func(t *testing.T, lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}},
+		{name: "swapped records", tamper: func(t *testing.T, lines []string) []string {
+			lines[0], lines[1] = lines[1], lines[0]
+			return lines
+		}},
+		{name: "forged checkpoint signature", tamper: func(t *testing.T, lines []string) []string {
+			for i, line := range lines {
+				record := decodeRecord(t, line)
+				if record.Type == RecordCheckpoint {
+					record.Signature = strings.Repeat("0", len(record.Signature))
+					lines[i] = encodeRecord(t, record)
+					break
+				}
+			}
+			return lines
+		}},
+		{name: "deleted tail", anchored: true, tamper: func(t *testing.T, lines []string) []string {
+			return lines[:4]
+		}},
+		{name: "another key", key: other},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeLog(t, path, private, 7, true)
+			original, err := VerifyFile(path, public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.tamper != nil {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines := c.tamper(t, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+				if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			key := public
+			if c.key != nil {
+				key = c.key
+			}
+			var anchors []Anchor
+			if c.anchored {
+				anchors = append(anchors, original.Last)
+			}
+			result, err := VerifyFile(path, key, anchors...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tampered := c.tamper != nil || c.key != nil; result.Valid() == tampered {
+				t.Fatalf("verify returned valid %v with the problems %v", result.Valid(), result.Problems)
+			}
+		})
+	}
+}
+
+func decodeRecord(t *testing.T, line string) Record {
+	t.Helper()
+	var record Record
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func encodeRecord(t *testing.T, record Record) string {
+	t.Helper()
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -1,5 +1,7 @@
 package TestDesign
 
+import "fmt"
+
 /*
 This file defines the ICommand interface and its concrete implementations (SubscribeCommand, UnsubscribeCommand, and PublishValueCommand) within the context of a mediator pattern implementation. These command structs encapsulate specific actions that modules can execute, such as subscribing to, unsubscribing from, or publishing values.
 
@@ -30,6 +32,11 @@ type SubscribeCommand struct {
 	topic        string
 }
 
+// NewSubscribeCommand creates the command that subscribes subscriberID to topic of publisherID, send it to publisherID
+func NewSubscribeCommand(subscriberID, publisherID, topic string) *SubscribeCommand {
+	return &SubscribeCommand{subscriberID: subscriberID, publisherID: publisherID, topic: topic}
+}
+
 func (sc *SubscribeCommand) Execute(module *BaseModule) error {
 	module.Mediator.Subscribe(sc.subscriberID, sc.publisherID, sc.topic)
 	return nil
@@ -39,17 +46,42 @@ func (sc *SubscribeCommand) GetTargetID() string {
 	return sc.publisherID
 }
 
+func (sc *SubscribeCommand) GetSubscriberID() string {
+	return sc.subscriberID
+}
+
+func (sc *SubscribeCommand) GetTopic() string {
+	return sc.topic
+}
+
 type UnsubscribeCommand struct {
 	subscriberID string
 	publisherID  string
 	topic        string
 }
 
+// NewUnsubscribeCommand creates the command that undoes NewSubscribeCommand, send it to publisherID
+func NewUnsubscribeCommand(subscriberID, publisherID, topic string) *UnsubscribeCommand {
+	return &UnsubscribeCommand{subscriberID: subscriberID, publisherID: publisherID, topic: topic}
+}
+
 func (uc *UnsubscribeCommand) Execute(module *BaseModule) error {
 	module.Mediator.Unsubscribe(uc.subscriberID, uc.publisherID, uc.topic)
 	return nil
 }
 
+func (uc *UnsubscribeCommand) GetTargetID() string {
+	return uc.publisherID
+}
+
+func (uc *UnsubscribeCommand) GetSubscriberID() string {
+	return uc.subscriberID
+}
+
+func (uc *UnsubscribeCommand) GetTopic() string {
+	return uc.topic
+}
+
 // PublishValueCommand struct
 type PublishValueCommand struct {
 	publisherID string
@@ -57,9 +89,109 @@ type PublishValueCommand struct {
 	value       interface{}
 }
 
+// NewPublishValueCommand creates the command that publishes value on topic of publisherID, send it to publisherID
+func NewPublishValueCommand(publisherID, topic string, value interface{}) *PublishValueCommand {
+	return &PublishValueCommand{publisherID: publisherID, topic: topic, value: value}
+}
+
 func (svc *PublishValueCommand) Execute(module *BaseModule) error {
 	if module.id == svc.publisherID {
 		module.Mediator.NotifySubscribers(svc.publisherID, svc.topic, svc.value)
 	}
 	return nil
 }
+
+func (svc *PublishValueCommand) GetPublisherID() string {
+	return svc.publisherID
+}
+
+func (svc *PublishValueCommand) GetTopic() string {
+	return svc.topic
+}
+
+func (svc *PublishValueCommand) GetValue() interface{} {
+	return svc.value
+}
+
+// HeartbeatCommand tells the controller that the module's background process is still alive
+type HeartbeatCommand struct {
+	moduleID string
+}
+
+func (hc *HeartbeatCommand) Execute(module *BaseModule) error {
+	if module.id == hc.moduleID {
+		module.Mediator.Heartbeat(hc.moduleID)
+	}
+	return nil
+}
+
+func (hc *HeartbeatCommand) GetModuleID() string {
+	return hc.moduleID
+}
+
+// SetStrategyCommand switches the strategy of a CompressorModule or DispenserModule to a registered strategy
+type SetStrategyCommand struct {
+	moduleID   string
+	identifier string
+	params     map[string]interface{}
+}
+
+// NewSetStrategyCommand creates the command that switches the strategy of moduleID to identifier created with
+// params, send it to moduleID. The module publishes the result on ActiveStrategyTopic or StrategyErrorTopic.
+func NewSetStrategyCommand(moduleID, identifier string, params map[string]interface{}) *SetStrategyCommand {
+	return &SetStrategyCommand{moduleID: moduleID, identifier: identifier, params: params}
+}
+
+func (sc *SetStrategyCommand) Execute(module *BaseModule) error {
+	if module.id != sc.moduleID {
+		return nil
+	}
+	holder, ok := module.Owner().(StrategyHolder)
+	if !ok {
+		err := fmt.Errorf("module %s has no strategy to set", module.id)
+		module.publishIfConnected(StrategyErrorTopic, err.Error())
+		return err
+	}
+	return holder.ConfigureStrategy(sc.identifier, sc.params)
+}
+
+func (sc *SetStrategyCommand) GetModuleID() string {
+	return sc.moduleID
+}
+
+func (sc *SetStrategyCommand) GetIdentifier() string {
+	return sc.identifier
+}
+
+func (sc *SetStrategyCommand) GetParams() map[string]interface{} {
+	return sc.params
+}
+
+// ExecuteCommand runs Execute on a CompressorModule or DispenserModule, the result is published on the output
+// topic of the module and an error on its error topic
+type ExecuteCommand struct {
+	moduleID string
+}
+
+// NewExecuteCommand creates the command that runs Execute on moduleID, send it to moduleID
+func NewExecuteCommand(moduleID string) *ExecuteCommand {
+	return &ExecuteCommand{moduleID: moduleID}
+}
+
+func (ec *ExecuteCommand) Execute(module *BaseModule) error {
+	if module.id != ec.moduleID {
+		return nil
+	}
+	executor, ok := module.Owner().(executor)
+	if !ok {
+		err := fmt.Errorf("module %s can't execute", module.id)
+		module.publishIfConnected(ProcessingErrorTopic, ProcessingError{Error: err.Error()})
+		return err
+	}
+	executor.executeAndPublish()
+	return nil
+}
+
+func (ec *ExecuteCommand) GetModuleID() string {
+	return ec.moduleID
+}
@@ -0,0 +1,86 @@
+package DataSources
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrEndOfData is returned by a CSVSource that doesn't loop once every row has been replayed
+var ErrEndOfData = errors.New("end of data")
+
+// CSVSource replays the values of a single column of a CSV file, one row per fetch.
+// Values that parse as a number are published as float64, all others as string.
+type CSVSource struct {
+	sampling
+	values []string
+	loop   bool
+	next   int
+	mu     sync.Mutex
+}
+
+// NewCSVSource reads the column with the given header name from the file at path. The first row of the
+// file has to contain the header names.
+func NewCSVSource(path, column, topic string, period time.Duration, loop bool) (*CSVSource, error) {
+	sampling, err := newSampling(topic, period)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening csv file: %w", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv file: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("csv file has no header row")
+	}
+
+	index := -1
+	for i, name := range records[0] {
+		if name == column {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("csv file has no column %q", column)
+	}
+
+	values := make([]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		if index < len(record) {
+			values = append(values, record[index])
+		}
+	}
+	return &CSVSource{
+		sampling: sampling,
+		values:   values,
+		loop:     loop,
+	}, nil
+}
+
+func (s *CSVSource) Fetch() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.values) {
+		if !s.loop || len(s.values) == 0 {
+			return nil, ErrEndOfData
+		}
+		s.next = 0
+	}
+	value := s.values[s.next]
+	s.next++
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number, nil
+	}
+	return value, nil
+}
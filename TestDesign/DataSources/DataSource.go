@@ -0,0 +1,54 @@
+package DataSources
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+This package contains the data sources a module's background process samples. A DataSource is given to a module at
+construction time; the module then calls Fetch every Period and publishes the result on Topic.
+
+Available sources:
+
+    SineSource, RampSource and NoiseSource simulate signals without any external dependency, which makes them
+    suitable for offline networks and tests.
+
+    CSVSource replays the values of one column of a CSV file.
+
+    HTTPJSONSource performs a GET request with an injectable http.Client and URL and decodes the JSON response.
+    NewRandomNumberSource is the source modules used to be hardwired to, wrapped in a ResilientSource.
+*/
+
+type DataSource interface {
+	// Topic is the topic on which the fetched values are published
+	Topic() string
+	// Period is the time between two fetches
+	Period() time.Duration
+	// Fetch returns the next value of the source
+	Fetch() (interface{}, error)
+}
+
+// ErrInvalidPeriod is returned by the constructors of the built-in sources for a period that isn't positive
+var ErrInvalidPeriod = errors.New("source period must be positive")
+
+// sampling holds the topic and period shared by all built-in sources
+type sampling struct {
+	topic  string
+	period time.Duration
+}
+
+func newSampling(topic string, period time.Duration) (sampling, error) {
+	if period <= 0 {
+		return sampling{}, ErrInvalidPeriod
+	}
+	return sampling{topic: topic, period: period}, nil
+}
+
+func (s sampling) Topic() string {
+	return s.topic
+}
+
+func (s sampling) Period() time.Duration {
+	return s.period
+}
@@ -0,0 +1,106 @@
+package DataSources
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const randomNumberURL = "https://www.randomnumberapi.com/api/v1.0/random?min=1&max=100"
+
+// JSONDecoder turns the body of a response into the value that is published
+type JSONDecoder func(body []byte) (interface{}, error)
+
+// HTTPJSONSource performs a GET request on every fetch and decodes the JSON response
+type HTTPJSONSource struct {
+	sampling
+	client *http.Client
+	url    string
+	decode JSONDecoder
+}
+
+// NewHTTPJSONSource creates a source that fetches url with client. A nil client uses http.DefaultClient and a nil
+// decoder publishes the response as it is decoded by encoding/json.
+func NewHTTPJSONSource(client *http.Client, url, topic string, period time.Duration, decode JSONDecoder) (*HTTPJSONSource, error) {
+	sampling, err := newSampling(topic, period)
+	if err != nil {
+		return nil, err
+	}
+	return newHTTPJSONSource(client, url, sampling, decode), nil
+}
+
+func newHTTPJSONSource(client *http.Client, url string, sampling sampling, decode JSONDecoder) *HTTPJSONSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if decode == nil {
+		decode = decodeAny
+	}
+	return &HTTPJSONSource{
+		sampling: sampling,
+		client:   client,
+		url:      url,
+		decode:   decode,
+	}
+}
+
+// NewRandomNumberSource fetches a random number between 1 and 100 from randomnumberapi.com every 500 ms
+// and publishes it on the "randomInt" topic. The requests are guarded by the default retry policy and breaker.
+func NewRandomNumberSource(client *http.Client) *ResilientSource {
+	source := newHTTPJSONSource(client, randomNumberURL, sampling{topic: "randomInt", period: 500 * time.Millisecond}, decodeRandomNumber)
+	return NewResilientSource(source, DefaultRetryPolicy(), NewCircuitBreaker(DefaultBreakerConfig()))
+}
+
+func (s *HTTPJSONSource) Fetch() (interface{}, error) {
+	return s.FetchContext(context.Background())
+}
+
+// FetchContext fetches the value, aborting the request when ctx is done
+func (s *HTTPJSONSource) FetchContext(ctx context.Context) (interface{}, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the request: %w", err)
+	}
+
+	// Make the HTTP GET request
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error making the request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	// Read the response body
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the response body: %w", err)
+	}
+	return s.decode(body)
+}
+
+func decodeAny(body []byte) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("error unmarshalling the JSON: %w", err)
+	}
+	return value, nil
+}
+
+// decodeRandomNumber decodes the JSON array returned by the random number API and returns its first number
+func decodeRandomNumber(body []byte) (interface{}, error) {
+	var numbers []uint8
+	if err := json.Unmarshal(body, &numbers); err != nil {
+		return nil, fmt.Errorf("error unmarshalling the JSON: %w", err)
+	}
+	if len(numbers) == 0 {
+		return nil, errors.New("response contains no numbers")
+	}
+	return int(numbers[0]), nil
+}
@@ -0,0 +1,366 @@
+package DataSources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"mcs/TestDesign/Timing"
+	"sync"
+	"time"
+)
+
+/*
+This file implements the resilience layer around data sources that depend on external systems. A ResilientSource
+wraps another DataSource and adds:
+
+    Timeouts: every attempt gets its own deadline. Sources that implement ContextSource, like HTTPJSONSource,
+    abort the request when the deadline passes.
+
+    Retries: failed attempts are retried with exponential backoff. The backoff is jittered so modules that fail at
+    the same time don't retry in lockstep.
+
+    Circuit breaker: after a number of consecutive failed fetches the breaker opens and fetches are rejected without
+    touching the source. After a cool-down the breaker half-opens and lets a single trial fetch through, which
+    either closes the breaker again or reopens it. Every state change is published on "<topic>.breaker".
+
+Only the fetch that opens the breaker returns a fatal error. All other failures are returned as a TransientError,
+which a module logs and skips instead of moving to ErrorState. A module in ErrorState stops fetching, it calls
+Recover instead, which runs the half-open trial once the cool-down passed and lets the module resume when the trial
+closed the breaker.
+*/
+
+var (
+	// ErrBreakerOpened is returned by the fetch that made the circuit breaker open
+	ErrBreakerOpened = errors.New("circuit breaker opened")
+	// ErrBreakerOpen is returned, wrapped in a TransientError, for fetches rejected by an open breaker
+	ErrBreakerOpen = errors.New("circuit breaker is open")
+)
+
+// TransientError is a fetch error the source is expected to recover from
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return fmt.Sprintf("transient error: %v", e.Err)
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// ContextSource is implemented by sources that can abort a fetch when the context is done
+type ContextSource interface {
+	FetchContext(ctx context.Context) (interface{}, error)
+}
+
+// ClockedSource is implemented by sources that wait or measure time.
+// A module passes its clock to SetClock when it is registered with a controller.
+type ClockedSource interface {
+	SetClock(clock Timing.Clock)
+}
+
+// RecoveringSource is implemented by sources that can tell when they recovered from the error that moved their
+// module to ErrorState. A module in ErrorState calls Recover every period instead of Fetch.
+type RecoveringSource interface {
+	// Recover returns a fetched value and true once the source recovered
+	Recover() (interface{}, bool)
+}
+
+// Publisher publishes a value on a topic of the module that owns the source
+type Publisher = func(topic string, value interface{})
+
+// PublishingSource is implemented by sources that publish values besides the sampled one.
+// A module passes its PublishToTopic to SetPublisher when it is created.
+type PublishingSource interface {
+	SetPublisher(publisher Publisher)
+}
+
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per fetch, including the first one
+	MaxAttempts int
+	// Timeout is the deadline of a single attempt, zero means no deadline
+	Timeout   time.Duration
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay, zero means no cap
+	MaxDelay time.Duration
+	// Jitter is the fraction, between 0 and 1, by which a backoff delay is randomly shortened
+	Jitter float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Timeout:     2 * time.Second,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Jitter:      0.5,
+	}
+}
+
+// backoff returns the delay before the given retry, starting at 1
+func (p RetryPolicy) backoff(retry int, random *rand.Rand) time.Duration {
+	delay := p.BaseDelay << uint(retry-1)
+	if p.BaseDelay > 0 && (delay <= 0 || delay>>uint(retry-1) != p.BaseDelay) {
+		// The shift overflowed
+		delay = math.MaxInt64
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * random.Float64() * float64(delay))
+	}
+	return delay
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed fetches after which the breaker opens
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before it lets a trial fetch through
+	OpenTimeout time.Duration
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{FailureThreshold: 5, OpenTimeout: 10 * time.Second}
+}
+
+type CircuitBreaker struct {
+	config        BreakerConfig
+	state         BreakerState
+	failures      int
+	openedAt      time.Time
+	trialInFlight bool
+	onChange      func(state BreakerState)
+	clock         Timing.Clock
+	mu            sync.Mutex
+}
+
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 1
+	}
+	return &CircuitBreaker{config: config, clock: Timing.RealClock{}}
+}
+
+func (b *CircuitBreaker) SetClock(clock Timing.Clock) {
+	b.mu.Lock()
+	b.clock = clock
+	b.mu.Unlock()
+}
+
+func (b *CircuitBreaker) GetState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a fetch may go through, half-opening the breaker once the open timeout passed
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	var changed []BreakerState
+	allowed := true
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Since(b.openedAt) < b.config.OpenTimeout {
+			allowed = false
+			break
+		}
+		b.state = BreakerHalfOpen
+		changed = append(changed, b.state)
+		b.trialInFlight = true
+	case BreakerHalfOpen:
+		if b.trialInFlight {
+			allowed = false
+			break
+		}
+		b.trialInFlight = true
+	}
+	b.mu.Unlock()
+	b.notify(changed)
+	return allowed
+}
+
+// record registers the outcome of a fetch and reports whether it made the breaker open
+func (b *CircuitBreaker) record(success bool) bool {
+	b.mu.Lock()
+	var changed []BreakerState
+	opened := false
+	b.trialInFlight = false
+	if success {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.state = BreakerClosed
+			changed = append(changed, b.state)
+		}
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.config.FailureThreshold {
+			b.openedAt = b.clock.Now()
+			b.state = BreakerOpen
+			changed = append(changed, b.state)
+			opened = true
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changed)
+	return opened
+}
+
+// notify is called outside of the lock because the callback may publish through the mediator
+func (b *CircuitBreaker) notify(changed []BreakerState) {
+	if b.onChange == nil {
+		return
+	}
+	for _, state := range changed {
+		b.onChange(state)
+	}
+}
+
+type ResilientSource struct {
+	source    DataSource
+	policy    RetryPolicy
+	breaker   *CircuitBreaker
+	random    *rand.Rand
+	publisher Publisher
+	clock     Timing.Clock
+	mu        sync.Mutex
+}
+
+func NewResilientSource(source DataSource, policy RetryPolicy, breaker *CircuitBreaker) *ResilientSource {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	if breaker == nil {
+		breaker = NewCircuitBreaker(DefaultBreakerConfig())
+	}
+	rs := &ResilientSource{
+		source:  source,
+		policy:  policy,
+		breaker: breaker,
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		clock:   Timing.RealClock{},
+	}
+	breaker.onChange = rs.publishBreakerState
+	return rs
+}
+
+func (rs *ResilientSource) Topic() string {
+	return rs.source.Topic()
+}
+
+func (rs *ResilientSource) Period() time.Duration {
+	return rs.source.Period()
+}
+
+func (rs *ResilientSource) GetBreaker() *CircuitBreaker {
+	return rs.breaker
+}
+
+// BreakerTopic is the topic on which the state of the circuit breaker is published
+func (rs *ResilientSource) BreakerTopic() string {
+	return rs.source.Topic() + ".breaker"
+}
+
+// SetClock sets the clock used for backoff delays and the breaker cool-down
+func (rs *ResilientSource) SetClock(clock Timing.Clock) {
+	rs.mu.Lock()
+	rs.clock = clock
+	rs.mu.Unlock()
+	rs.breaker.SetClock(clock)
+	if inner, ok := rs.source.(ClockedSource); ok {
+		inner.SetClock(clock)
+	}
+}
+
+func (rs *ResilientSource) SetPublisher(publisher Publisher) {
+	rs.mu.Lock()
+	rs.publisher = publisher
+	rs.mu.Unlock()
+	if inner, ok := rs.source.(PublishingSource); ok {
+		inner.SetPublisher(publisher)
+	}
+}
+
+func (rs *ResilientSource) publishBreakerState(state BreakerState) {
+	rs.mu.Lock()
+	publisher := rs.publisher
+	rs.mu.Unlock()
+	if publisher != nil {
+		publisher(rs.BreakerTopic(), state.String())
+	}
+}
+
+func (rs *ResilientSource) Fetch() (interface{}, error) {
+	if !rs.breaker.allow() {
+		return nil, &TransientError{Err: ErrBreakerOpen}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= rs.policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			rs.mu.Lock()
+			delay := rs.policy.backoff(attempt-1, rs.random)
+			clock := rs.clock
+			rs.mu.Unlock()
+			if delay > 0 {
+				clock.Sleep(delay)
+			}
+		}
+		value, err := rs.attempt()
+		if err == nil {
+			rs.breaker.record(true)
+			return value, nil
+		}
+		lastErr = err
+	}
+
+	if rs.breaker.record(false) {
+		return nil, fmt.Errorf("%w after %d failed attempts: %v", ErrBreakerOpened, rs.policy.MaxAttempts, lastErr)
+	}
+	return nil, &TransientError{Err: lastErr}
+}
+
+// Recover runs the half-open trial fetch once the cool-down of the open breaker passed. A successful trial closes
+// the breaker and returns the fetched value, a failed one reopens it. A closed breaker has nothing to recover from.
+func (rs *ResilientSource) Recover() (interface{}, bool) {
+	if rs.breaker.GetState() == BreakerClosed || !rs.breaker.allow() {
+		return nil, false
+	}
+	value, err := rs.attempt()
+	rs.breaker.record(err == nil)
+	return value, err == nil
+}
+
+func (rs *ResilientSource) attempt() (interface{}, error) {
+	contextSource, ok := rs.source.(ContextSource)
+	if !ok || rs.policy.Timeout <= 0 {
+		return rs.source.Fetch()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rs.policy.Timeout)
+	defer cancel()
+	return contextSource.FetchContext(ctx)
+}
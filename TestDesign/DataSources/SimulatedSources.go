@@ -0,0 +1,102 @@
+package DataSources
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SineSource produces offset + amplitude * sin(2π * frequency * t), where t advances by one period per fetch
+type SineSource struct {
+	sampling
+	amplitude float64
+	frequency float64
+	offset    float64
+	sample    int
+	mu        sync.Mutex
+}
+
+func NewSineSource(topic string, period time.Duration, amplitude, frequency, offset float64) (*SineSource, error) {
+	sampling, err := newSampling(topic, period)
+	if err != nil {
+		return nil, err
+	}
+	return &SineSource{
+		sampling:  sampling,
+		amplitude: amplitude,
+		frequency: frequency,
+		offset:    offset,
+	}, nil
+}
+
+func (s *SineSource) Fetch() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := float64(s.sample) * s.period.Seconds()
+	s.sample++
+	return s.offset + s.amplitude*math.Sin(2*math.Pi*s.frequency*t), nil
+}
+
+// RampSource counts from start to end in steps and wraps around to start once end is passed
+type RampSource struct {
+	sampling
+	start   float64
+	end     float64
+	step    float64
+	current float64
+	mu      sync.Mutex
+}
+
+func NewRampSource(topic string, period time.Duration, start, end, step float64) (*RampSource, error) {
+	sampling, err := newSampling(topic, period)
+	if err != nil {
+		return nil, err
+	}
+	return &RampSource{
+		sampling: sampling,
+		start:    start,
+		end:      end,
+		step:     step,
+		current:  start,
+	}, nil
+}
+
+func (s *RampSource) Fetch() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value := s.current
+	s.current += s.step
+	if (s.step > 0 && s.current > s.end) || (s.step < 0 && s.current < s.end) {
+		s.current = s.start
+	}
+	return value, nil
+}
+
+// NoiseSource produces normally distributed values. The same seed always produces the same sequence.
+type NoiseSource struct {
+	sampling
+	mean   float64
+	stdDev float64
+	random *rand.Rand
+	mu     sync.Mutex
+}
+
+func NewNoiseSource(topic string, period time.Duration, mean, stdDev float64, seed int64) (*NoiseSource, error) {
+	sampling, err := newSampling(topic, period)
+	if err != nil {
+		return nil, err
+	}
+	return &NoiseSource{
+		sampling: sampling,
+		mean:     mean,
+		stdDev:   stdDev,
+		random:   rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+func (s *NoiseSource) Fetch() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mean + s.stdDev*s.random.NormFloat64(), nil
+}
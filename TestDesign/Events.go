@@ -0,0 +1,89 @@
+package TestDesign
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+This file defines the controller event mechanism. The MasterController raises an Event whenever something
+noteworthy happens inside the mediator, and any number of listeners can be attached to observe them.
+
+Listeners are invoked synchronously on the goroutine that raised the event, so they should return quickly
+and must not block on the controller themselves.
+*/
+
+type EventType int
+
+const (
+	// EventHeartbeatLost is raised by the watchdog when a module stopped sending heartbeats.
+	EventHeartbeatLost EventType = iota
+	// EventPublished is raised once for every value passed to NotifySubscribers
+	EventPublished
+	// EventNotified is raised for every subscriber a published value was delivered to
+	EventNotified
+	// EventCommand is raised for every command right before it is executed on its target
+	EventCommand
+	EventRegistered
+	EventUnregistered
+	// EventStateChanged is raised when a registered module changes state
+	EventStateChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventHeartbeatLost:
+		return "heartbeatLost"
+	case EventPublished:
+		return "published"
+	case EventNotified:
+		return "notified"
+	case EventCommand:
+		return "command"
+	case EventRegistered:
+		return "registered"
+	case EventUnregistered:
+		return "unregistered"
+	case EventStateChanged:
+		return "stateChanged"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes something that happened inside the MasterController
+type Event struct {
+	Type         EventType
+	Time         time.Time
+	ModuleID     string
+	PublisherID  string
+	SubscriberID string
+	Topic        string
+	Value        interface{}
+	Command      ICommand
+	// State is the state of the module for EventRegistered and the new state for EventStateChanged
+	State         State
+	PreviousState State
+}
+
+type EventListener = func(event Event)
+
+type eventBus struct {
+	listeners []EventListener
+	mu        sync.RWMutex
+}
+
+func (b *eventBus) add(listener EventListener) {
+	b.mu.Lock()
+	b.listeners = append(b.listeners, listener)
+	b.mu.Unlock()
+}
+
+func (b *eventBus) raise(event Event) {
+	b.mu.RLock()
+	listeners := b.listeners
+	b.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,228 @@
+package Faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcs/TestDesign"
+	"mcs/TestDesign/DataSources"
+	"mcs/TestDesign/Timing"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by data sources that failed because of an injected fault
+var ErrInjected = errors.New("injected fault")
+
+type heldCommand struct {
+	command  TestDesign.ICommand
+	targetID string
+	timer    Timing.Timer
+}
+
+// commandFaults is the state the command interceptor needs to reorder commands
+type commandFaults struct {
+	held *heldCommand
+	mu   sync.Mutex
+}
+
+// AttachController routes the commands of mc through the command rules of the injector
+func (i *Injector) AttachController(mc *TestDesign.MasterController) {
+	faults := &commandFaults{}
+	mc.SetCommandInterceptor(func(command TestDesign.ICommand, targetID string, enqueue func(TestDesign.ICommand, string)) {
+		i.interceptCommand(faults, command, targetID, enqueue)
+	})
+}
+
+// DetachController stops injecting command faults into mc
+func (i *Injector) DetachController(mc *TestDesign.MasterController) {
+	mc.SetCommandInterceptor(nil)
+}
+
+func (i *Injector) interceptCommand(faults *commandFaults, command TestDesign.ICommand, targetID string, enqueue func(TestDesign.ICommand, string)) {
+	detail := fmt.Sprintf("%T", command)
+
+	// A held back command is released after the next command, which swaps their order
+	faults.mu.Lock()
+	held := faults.held
+	faults.held = nil
+	faults.mu.Unlock()
+	if held != nil && held.timer.Stop() {
+		defer enqueue(held.command, held.targetID)
+	}
+
+	if rule := i.decide(DropCommand, targetID, detail); rule != nil {
+		return
+	}
+	if rule := i.decide(DelayCommand, targetID, detail); rule != nil {
+		i.clock.AfterFunc(rule.Delay, func() { enqueue(command, targetID) })
+		return
+	}
+	if rule := i.decide(ReorderCommand, targetID, detail); rule != nil {
+		window := rule.Delay
+		if window <= 0 {
+			window = defaultReorderWindow
+		}
+		next := &heldCommand{command: command, targetID: targetID}
+		faults.mu.Lock()
+		faults.held = next
+		// Release the command on its own when no other command comes along in time
+		next.timer = i.clock.AfterFunc(window, func() {
+			faults.mu.Lock()
+			if faults.held == next {
+				faults.held = nil
+			}
+			faults.mu.Unlock()
+			enqueue(command, targetID)
+		})
+		faults.mu.Unlock()
+		return
+	}
+	enqueue(command, targetID)
+	if rule := i.decide(DuplicateCommand, targetID, detail); rule != nil {
+		enqueue(command, targetID)
+	}
+}
+
+// WrapCallback returns a callback that panics or slows down according to the callback rules for moduleID
+func (i *Injector) WrapCallback(moduleID string, callback TestDesign.NotificationCallback) TestDesign.NotificationCallback {
+	return func(valueName string, value interface{}) {
+		i.interceptDelivery(moduleID, valueName, value, func() {
+			if callback != nil {
+				callback(valueName, value)
+			}
+		})
+	}
+}
+
+// DeliveryInterceptor returns an interceptor that panics or slows down the delivery of values to moduleID
+// according to the callback rules, it covers the handlers of typed topics and of processing as well
+func (i *Injector) DeliveryInterceptor(moduleID string) TestDesign.DeliveryInterceptor {
+	return func(valueName string, value interface{}, deliver func()) {
+		i.interceptDelivery(moduleID, valueName, value, deliver)
+	}
+}
+
+func (i *Injector) interceptDelivery(moduleID, valueName string, value interface{}, deliver func()) {
+	detail := fmt.Sprintf("%s=%v", valueName, value)
+	if rule := i.decide(SlowCallback, moduleID, detail); rule != nil {
+		i.clock.Sleep(rule.Delay)
+	}
+	if rule := i.decide(PanicCallback, moduleID, detail); rule != nil {
+		panic(fmt.Sprintf("%v: callback of module %s", ErrInjected, moduleID))
+	}
+	deliver()
+}
+
+type faultySource struct {
+	DataSources.DataSource
+	moduleID string
+	injector *Injector
+}
+
+func (s *faultySource) Fetch() (interface{}, error) {
+	if rule := s.injector.decide(FailFetch, s.moduleID, s.Topic()); rule != nil {
+		return nil, fmt.Errorf("%w: fetch of %s", ErrInjected, s.Topic())
+	}
+	return s.DataSource.Fetch()
+}
+
+// FetchContext fails like Fetch does when a fetch rule matches, and passes ctx on to a wrapped ContextSource so a
+// ResilientSource around the faulty source still aborts an attempt at its timeout
+func (s *faultySource) FetchContext(ctx context.Context) (interface{}, error) {
+	contextSource, ok := s.DataSource.(DataSources.ContextSource)
+	if !ok {
+		return s.Fetch()
+	}
+	if rule := s.injector.decide(FailFetch, s.moduleID, s.Topic()); rule != nil {
+		return nil, fmt.Errorf("%w: fetch of %s", ErrInjected, s.Topic())
+	}
+	return contextSource.FetchContext(ctx)
+}
+
+// SetClock, like SetPublisher and Recover, forwards to the wrapped source, so a wrapped ResilientSource keeps its
+// virtual time, its breaker notifications and its recovery
+func (s *faultySource) SetClock(clock Timing.Clock) {
+	if clocked, ok := s.DataSource.(DataSources.ClockedSource); ok {
+		clocked.SetClock(clock)
+	}
+}
+
+func (s *faultySource) SetPublisher(publisher DataSources.Publisher) {
+	if publishing, ok := s.DataSource.(DataSources.PublishingSource); ok {
+		publishing.SetPublisher(publisher)
+	}
+}
+
+// Recover fails like Fetch does when a fetch rule matches
+func (s *faultySource) Recover() (interface{}, bool) {
+	recovering, ok := s.DataSource.(DataSources.RecoveringSource)
+	if !ok {
+		return nil, false
+	}
+	if rule := s.injector.decide(FailFetch, s.moduleID, s.Topic()); rule != nil {
+		return nil, false
+	}
+	return recovering.Recover()
+}
+
+// WrapDataSource returns a data source whose fetches fail according to the fetch rules for moduleID.
+// Wrap the source inside a ResilientSource to test the retries and the breaker.
+func (i *Injector) WrapDataSource(moduleID string, source DataSources.DataSource) DataSources.DataSource {
+	return &faultySource{DataSource: source, moduleID: moduleID, injector: i}
+}
+
+// AttachModule intercepts the delivery of values to module and wraps its data source. It has to be called before
+// the module transitions to running.
+func (i *Injector) AttachModule(module *TestDesign.BaseModule) {
+	module.SetDeliveryInterceptor(i.DeliveryInterceptor(module.GetId()))
+	if source := module.GetDataSource(); source != nil {
+		module.SetDataSource(i.WrapDataSource(module.GetId(), source))
+	}
+}
+
+// RunStateFaults checks the ForceError rules for every running module of mc each interval until stop is closed
+func (i *Injector) RunStateFaults(mc *TestDesign.MasterController, interval time.Duration, stop <-chan struct{}) {
+	ticker := i.clock.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C():
+				i.forceErrors(mc)
+			}
+		}
+	}()
+}
+
+func (i *Injector) forceErrors(mc *TestDesign.MasterController) {
+	modules := mc.GetModules()
+	ids := make([]string, 0, len(modules))
+	for id := range modules {
+		ids = append(ids, id)
+	}
+	// Visit the modules in a fixed order so the opportunities are numbered the same in every run
+	sort.Strings(ids)
+	for _, id := range ids {
+		module := modules[id]
+		if module.GetState() != TestDesign.RunningState {
+			continue
+		}
+		rule := i.decide(ForceError, module.GetId(), "")
+		if rule == nil {
+			continue
+		}
+		module.SetState(TestDesign.ErrorState)
+		if rule.Delay > 0 {
+			target := module
+			i.clock.AfterFunc(rule.Delay, func() {
+				if target.GetState() == TestDesign.ErrorState {
+					target.ResolveError()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package Faults
+
+import (
+	"context"
+	"errors"
+	"mcs/TestDesign"
+	"mcs/TestDesign/DataSources"
+	"mcs/TestDesign/Timing"
+	"testing"
+	"time"
+)
+
+// blockingSource blocks every fetch until its context is done
+type blockingSource struct{}
+
+func (blockingSource) Topic() string               { return "value" }
+func (blockingSource) Period() time.Duration       { return time.Second }
+func (blockingSource) Fetch() (interface{}, error) { select {} }
+
+func (blockingSource) FetchContext(ctx context.Context) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestFaultySourceKeepsTheAttemptTimeout(t *testing.T) {
+	injector := NewInjector(1, Timing.RealClock{})
+	source := DataSources.NewResilientSource(injector.WrapDataSource("module", blockingSource{}), DataSources.RetryPolicy{MaxAttempts: 1, Timeout: 10 * time.Millisecond}, nil)
+	done := make(chan error, 1)
+	go func() {
+		_, err := source.Fetch()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("fetch returned %v, expected the deadline of the attempt", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the attempt of the wrapped source didn't time out")
+	}
+
+	failing := NewInjector(1, Timing.RealClock{}, Rule{Kind: FailFetch, Every: 1})
+	source = DataSources.NewResilientSource(failing.WrapDataSource("module", blockingSource{}), DataSources.RetryPolicy{MaxAttempts: 1, Timeout: time.Minute}, nil)
+	if _, err := source.Fetch(); !errors.Is(err, ErrInjected) {
+		t.Fatalf("fetch returned %v, expected the injected fault", err)
+	}
+}
+
+func TestCallbackFaultsReachTypedTopicHandlers(t *testing.T) {
+	mc := TestDesign.NewMasterController()
+	module := TestDesign.NewModuleWithDataSource("display", mc, nil)
+	mc.RegisterModule(module)
+	injector := NewInjector(1, Timing.RealClock{}, Rule{Kind: PanicCallback, Every: 1})
+	injector.AttachModule(module)
+
+	// The handler is installed after the module was attached
+	received := 0
+	if err := TestDesign.NewTopic[float64]("temperature").Subscribe(module, "sensor", func(float64) { received++ }); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("the typed topic handler received the value without the injected panic")
+		}
+		if received != 0 {
+			t.Fatalf("handler received %d values", received)
+		}
+	}()
+	module.NotifySubscriberFrom("sensor", "temperature", 21.5)
+}
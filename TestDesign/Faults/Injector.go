@@ -0,0 +1,158 @@
+package Faults
+
+import (
+	"fmt"
+	"mcs/TestDesign/Timing"
+	"sync"
+	"time"
+)
+
+/*
+This package injects faults into a running MasterController for resilience testing. It replaces the hand-rolled
+chaos of main.go with rules that say which fault is injected, where, and how often:
+
+    Command faults delay, drop, duplicate or reorder commands on their way to the command queue.
+    Callback faults make the delivery of values to a module panic or slow down, whichever handler receives them.
+    State faults force modules into ErrorState, optionally resolving the error after a while.
+    Fetch faults make the data source of a module fail.
+
+Every place a fault could be injected is an opportunity. Whether a rule fires on an opportunity is decided by a
+hash of the seed of the Injector, the index of the rule and the number of the opportunity, so a run can be
+reproduced from its seed. Every injected fault is recorded with that opportunity number.
+*/
+
+type Kind string
+
+const (
+	DelayCommand     Kind = "delayCommand"
+	DropCommand      Kind = "dropCommand"
+	DuplicateCommand Kind = "duplicateCommand"
+	ReorderCommand   Kind = "reorderCommand"
+	PanicCallback    Kind = "panicCallback"
+	SlowCallback     Kind = "slowCallback"
+	ForceError       Kind = "forceError"
+	FailFetch        Kind = "failFetch"
+)
+
+// defaultReorderWindow is how long a held back command waits for a command to swap places with
+const defaultReorderWindow = 100 * time.Millisecond
+
+// Rule describes when a fault is injected. A rule with Every set fires on every Every-th opportunity, otherwise it
+// fires with Probability. A rule only fires between After and Until, measured from the creation of the Injector.
+type Rule struct {
+	Kind Kind
+	// Target is the id of the module the rule applies to, empty applies to every module
+	Target      string
+	Probability float64
+	Every       int
+	After       time.Duration
+	Until       time.Duration
+	// Delay is the delay of DelayCommand, the slowdown of SlowCallback, the reorder window of ReorderCommand and
+	// the time ForceError keeps a module in ErrorState. A ForceError without Delay isn't resolved.
+	Delay time.Duration
+	// Limit is the maximum number of faults the rule injects, zero is unlimited
+	Limit int
+}
+
+// Record describes an injected fault
+type Record struct {
+	Seq         int
+	Time        time.Time
+	Kind        Kind
+	Target      string
+	Rule        int
+	Opportunity uint64
+	Detail      string
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("#%d %s %s on %s (rule %d, opportunity %d) %s", r.Seq, r.Time.Format(time.RFC3339Nano), r.Kind, r.Target, r.Rule, r.Opportunity, r.Detail)
+}
+
+type ruleState struct {
+	Rule
+	index         int
+	opportunities uint64
+	injected      int
+}
+
+type Injector struct {
+	seed    int64
+	clock   Timing.Clock
+	start   time.Time
+	rules   []*ruleState
+	records []Record
+	mu      sync.Mutex
+}
+
+func NewInjector(seed int64, clock Timing.Clock, rules ...Rule) *Injector {
+	injector := &Injector{seed: seed, clock: clock, start: clock.Now()}
+	for i, rule := range rules {
+		injector.rules = append(injector.rules, &ruleState{Rule: rule, index: i})
+	}
+	return injector
+}
+
+func (i *Injector) Seed() int64 {
+	return i.seed
+}
+
+func (i *Injector) Records() []Record {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]Record(nil), i.records...)
+}
+
+// decide counts an opportunity for every rule of the kind that applies to target and returns the first rule that
+// fires, or nil
+func (i *Injector) decide(kind Kind, target, detail string) *ruleState {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	elapsed := i.clock.Since(i.start)
+	for _, rule := range i.rules {
+		if rule.Kind != kind || (rule.Target != "" && rule.Target != target) {
+			continue
+		}
+		if elapsed < rule.After || (rule.Until > 0 && elapsed >= rule.Until) {
+			continue
+		}
+		if rule.Limit > 0 && rule.injected >= rule.Limit {
+			continue
+		}
+		rule.opportunities++
+		if !i.fires(rule) {
+			continue
+		}
+		rule.injected++
+		i.records = append(i.records, Record{
+			Seq:         len(i.records) + 1,
+			Time:        i.clock.Now(),
+			Kind:        kind,
+			Target:      target,
+			Rule:        rule.index,
+			Opportunity: rule.opportunities,
+			Detail:      detail,
+		})
+		return rule
+	}
+	return nil
+}
+
+// fires must be called with the lock held
+func (i *Injector) fires(rule *ruleState) bool {
+	if rule.Every > 0 {
+		return rule.opportunities%uint64(rule.Every) == 0
+	}
+	return chance(i.seed, rule.index, rule.opportunities) < rule.Probability
+}
+
+// chance returns a number in [0, 1) that only depends on its arguments, using the splitmix64 finalizer
+func chance(seed int64, rule int, opportunity uint64) float64 {
+	x := uint64(seed) + uint64(rule)*0x9e3779b97f4a7c15 + opportunity*0xbf58476d1ce4e5b9
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / float64(uint64(1)<<53)
+}
@@ -0,0 +1,211 @@
+package TestDesign
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+This file implements the health subsystem of the MasterController. A HealthReport combines several checks into an
+overall status while keeping the detail of every individual check:
+
+    Module checks: one check per registered module, derived from its State. A module in ErrorState is unhealthy,
+    a module that is not (yet) running is degraded.
+
+    Watchdog check: unhealthy when the heartbeat watchdog isn't running, degraded when modules missed heartbeats.
+
+    Command queue check: based on how full the buffered command queue is. A saturated queue means the workers
+    can't keep up or are stuck.
+
+    Custom checks: modules can register their own checks through BaseModule.RegisterHealthCheck.
+
+The overall status is the worst status of all checks. The controller is considered live as long as the watchdog
+and the command queue are not unhealthy, and ready when no check at all is unhealthy. HealthServer.go exposes
+these signals over HTTP.
+*/
+
+type HealthStatus int
+
+const (
+	HealthHealthy HealthStatus = iota
+	HealthDegraded
+	HealthUnhealthy
+)
+
+const (
+	queueDegradedRatio  = 0.5
+	queueUnhealthyRatio = 0.9
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthHealthy:
+		return "healthy"
+	case HealthDegraded:
+		return "degraded"
+	case HealthUnhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
+func (s HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// HealthCheck reports the status of a single aspect of the system with a human readable detail
+type HealthCheck = func() (HealthStatus, string)
+
+type HealthCheckResult struct {
+	Name   string       `json:"name"`
+	Status HealthStatus `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+}
+
+type HealthReport struct {
+	Status HealthStatus        `json:"status"`
+	Live   bool                `json:"live"`
+	Ready  bool                `json:"ready"`
+	Time   time.Time           `json:"time"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+type customHealthCheck struct {
+	owner string
+	check HealthCheck
+}
+
+type healthRegistry struct {
+	checks map[string]customHealthCheck
+	mu     sync.Mutex
+}
+
+// HealthCheckRegistry is implemented by mediators that accept custom health checks
+type HealthCheckRegistry interface {
+	RegisterHealthCheck(owner, name string, check HealthCheck)
+}
+
+// RegisterHealthCheck adds a custom check to the health report. Checks registered with the id of a module as owner
+// are removed when that module is unregistered.
+func (mc *MasterController) RegisterHealthCheck(owner, name string, check HealthCheck) {
+	mc.health.mu.Lock()
+	defer mc.health.mu.Unlock()
+	if mc.health.checks == nil {
+		mc.health.checks = make(map[string]customHealthCheck)
+	}
+	mc.health.checks[owner+":"+name] = customHealthCheck{owner: owner, check: check}
+}
+
+func (mc *MasterController) removeHealthChecks(owner string) {
+	mc.health.mu.Lock()
+	defer mc.health.mu.Unlock()
+	for name, custom := range mc.health.checks {
+		if custom.owner == owner {
+			delete(mc.health.checks, name)
+		}
+	}
+}
+
+// CheckHealth runs all checks and combines them into a HealthReport
+func (mc *MasterController) CheckHealth() HealthReport {
+	report := HealthReport{Time: mc.clock.Now(), Live: true, Ready: true}
+
+	modules := mc.snapshotModules()
+	ids := make([]string, 0, len(modules))
+	for id := range modules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		report.add(moduleHealth(modules[id]), false)
+	}
+	report.add(mc.watchdogHealth(), true)
+	report.add(mc.commandQueueHealth(), true)
+
+	mc.health.mu.Lock()
+	names := make([]string, 0, len(mc.health.checks))
+	for name := range mc.health.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	customs := make([]customHealthCheck, len(names))
+	for i, name := range names {
+		customs[i] = mc.health.checks[name]
+	}
+	mc.health.mu.Unlock()
+
+	for i, custom := range customs {
+		status, detail := custom.check()
+		report.add(HealthCheckResult{Name: names[i], Status: status, Detail: detail}, false)
+	}
+	return report
+}
+
+func (r *HealthReport) add(result HealthCheckResult, liveness bool) {
+	r.Checks = append(r.Checks, result)
+	if result.Status > r.Status {
+		r.Status = result.Status
+	}
+	if result.Status == HealthUnhealthy {
+		r.Ready = false
+		if liveness {
+			r.Live = false
+		}
+	}
+}
+
+func moduleHealth(module *BaseModule) HealthCheckResult {
+	state := module.GetState()
+	result := HealthCheckResult{Name: "module:" + module.GetId(), Detail: "state " + state.String()}
+	switch state {
+	case RunningState:
+		result.Status = HealthHealthy
+	case ErrorState:
+		result.Status = HealthUnhealthy
+	default:
+		result.Status = HealthDegraded
+	}
+	return result
+}
+
+func (mc *MasterController) watchdogHealth() HealthCheckResult {
+	result := HealthCheckResult{Name: "watchdog"}
+	if !mc.watchdog.IsRunning() {
+		result.Status = HealthUnhealthy
+		result.Detail = "watchdog is not running"
+		return result
+	}
+	if expired := mc.watchdog.Expired(); len(expired) > 0 {
+		sort.Strings(expired)
+		result.Status = HealthDegraded
+		result.Detail = "missed heartbeats: " + strings.Join(expired, ", ")
+	}
+	return result
+}
+
+func (mc *MasterController) commandQueueHealth() HealthCheckResult {
+	length, capacity := len(mc.commandQueue), cap(mc.commandQueue)
+	result := HealthCheckResult{Name: "commandQueue", Detail: fmt.Sprintf("%d/%d commands queued", length, capacity)}
+	if capacity == 0 {
+		return result
+	}
+	ratio := float64(length) / float64(capacity)
+	switch {
+	case ratio >= queueUnhealthyRatio:
+		result.Status = HealthUnhealthy
+	case ratio >= queueDegradedRatio:
+		result.Status = HealthDegraded
+	}
+	return result
+}
+
+// RegisterHealthCheck adds a custom check for this module to the health report of its mediator
+func (m *BaseModule) RegisterHealthCheck(name string, check HealthCheck) {
+	if registry, ok := m.Mediator.(HealthCheckRegistry); ok {
+		registry.RegisterHealthCheck(m.id, name, check)
+	}
+}
@@ -0,0 +1,63 @@
+package TestDesign
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+/*
+This file exposes the HealthReport of a MasterController over HTTP so a process supervisor can probe it:
+
+    /healthz  the full report with the detail of every check, 503 when the overall status is unhealthy
+    /livez    200 while the controller is live, 503 otherwise
+    /readyz   200 while the controller is ready, 503 otherwise
+
+All endpoints return the report as JSON.
+*/
+
+func NewHealthHandler(mc *MasterController) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		report := mc.CheckHealth()
+		writeHealthReport(w, report, report.Status != HealthUnhealthy)
+	})
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		report := mc.CheckHealth()
+		writeHealthReport(w, report, report.Live)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := mc.CheckHealth()
+		writeHealthReport(w, report, report.Ready)
+	})
+	return mux
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		fmt.Printf("Error writing health report: %v\n", err)
+	}
+}
+
+// ServeHealth starts serving the health endpoints on addr, for example "127.0.0.1:8081".
+// The returned server can be shut down with Close or Shutdown.
+func (mc *MasterController) ServeHealth(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: NewHealthHandler(mc)}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Health server stopped: %v\n", err)
+		}
+	}()
+	return server, nil
+}
@@ -0,0 +1,158 @@
+package Historian
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Bucket aggregates the numeric samples of a series in [Start, Start+width)
+type Bucket struct {
+	Start time.Time
+	Count int
+	Min   float64
+	Max   float64
+	Avg   float64
+}
+
+// Downsample aggregates the samples of the series in [from, to) into buckets of width, aligned to from. Buckets
+// without numeric samples are left out, non-numeric samples are skipped.
+func (h *Historian) Downsample(publisherID, topic string, from, to time.Time, width time.Duration) ([]Bucket, error) {
+	if width <= 0 {
+		return nil, errors.New("bucket width must be positive")
+	}
+	samples, err := h.Query(publisherID, topic, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return downsample(samples, from, width), nil
+}
+
+// downsample expects the samples in time order, as Query returns them
+func downsample(samples []Sample, from time.Time, width time.Duration) []Bucket {
+	var buckets []Bucket
+	if len(samples) == 0 {
+		return buckets
+	}
+	origin := from
+	if origin.IsZero() {
+		origin = samples[0].Time.Truncate(width)
+	}
+	var sum float64
+	for _, sample := range samples {
+		value, ok := toFloat(sample.Value)
+		if !ok {
+			continue
+		}
+		// Round the offset down, also for samples before the origin
+		offset := sample.Time.Sub(origin)
+		index := offset / width
+		if offset%width < 0 {
+			index--
+		}
+		start := origin.Add(index * width)
+
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			if len(buckets) > 0 {
+				buckets[len(buckets)-1].Avg = sum / float64(buckets[len(buckets)-1].Count)
+			}
+			buckets = append(buckets, Bucket{Start: start, Min: value, Max: value})
+			sum = 0
+		}
+		bucket := &buckets[len(buckets)-1]
+		bucket.Count++
+		sum += value
+		if value < bucket.Min {
+			bucket.Min = value
+		}
+		if value > bucket.Max {
+			bucket.Max = value
+		}
+	}
+	if len(buckets) > 0 {
+		buckets[len(buckets)-1].Avg = sum / float64(buckets[len(buckets)-1].Count)
+	}
+	return buckets
+}
+
+// toFloat converts the numeric values modules publish, and their JSON forms, to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// ExportCSV writes the samples of the series in [from, to) as CSV with the columns time, seq and value
+func (h *Historian) ExportCSV(w io.Writer, publisherID, topic string, from, to time.Time) error {
+	samples, err := h.Query(publisherID, topic, from, to)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "seq", "value"})
+	for _, sample := range samples {
+		writer.Write([]string{sample.Time.Format(time.RFC3339Nano), strconv.FormatUint(sample.Seq, 10), formatValue(sample.Value)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteBucketsCSV writes buckets as CSV with the columns start, count, min, max and avg
+func WriteBucketsCSV(w io.Writer, buckets []Bucket) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"start", "count", "min", "max", "avg"})
+	for _, bucket := range buckets {
+		writer.Write([]string{
+			bucket.Start.Format(time.RFC3339Nano),
+			strconv.Itoa(bucket.Count),
+			strconv.FormatFloat(bucket.Min, 'g', -1, 64),
+			strconv.FormatFloat(bucket.Max, 'g', -1, 64),
+			strconv.FormatFloat(bucket.Avg, 'g', -1, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatValue(value interface{}) string {
+	if f, ok := toFloat(value); ok {
+		if _, isString := value.(string); !isString {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
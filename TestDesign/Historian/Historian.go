@@ -0,0 +1,196 @@
+package Historian
+
+import (
+	"errors"
+	"fmt"
+	"mcs/TestDesign"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+This package keeps the history of the values published through MasterController.NotifySubscribers, which
+subscribers only see one value at a time. Only tracked topics are kept. Every series, the values of one topic of
+one publisher, is kept in a ring buffer of a fixed capacity, so memory stays bounded. With a directory configured
+every value is also appended to segment files on disk, see Segments.go, and queries reach back beyond the ring
+buffer into those segments.
+
+Queries select a time range, Downsample.go aggregates them into buckets and writes them as CSV.
+*/
+
+const defaultCapacity = 10000
+
+type Options struct {
+	// Capacity is the number of samples kept in memory per series, zero uses 10000
+	Capacity int
+	// Dir keeps every sample in segment files below this directory, empty keeps the samples in memory only
+	Dir string
+	// SegmentSamples is the number of samples per segment file, zero uses Capacity
+	SegmentSamples int
+}
+
+type Sample struct {
+	Seq   uint64
+	Time  time.Time
+	Value interface{}
+}
+
+type series struct {
+	publisherID string
+	topic       string
+	ring        *ring
+	nextSeq     uint64
+	segments    *segmentWriter
+}
+
+type Historian struct {
+	options Options
+	tracked map[string]bool
+	series  map[string]*series
+	mu      sync.RWMutex
+}
+
+func New(options Options) *Historian {
+	if options.Capacity <= 0 {
+		options.Capacity = defaultCapacity
+	}
+	if options.SegmentSamples <= 0 {
+		options.SegmentSamples = options.Capacity
+	}
+	return &Historian{options: options, tracked: make(map[string]bool), series: make(map[string]*series)}
+}
+
+// Track keeps the values published on topic by publisherID. An empty publisherID tracks the topic of every publisher.
+func (h *Historian) Track(publisherID, topic string) {
+	h.mu.Lock()
+	h.tracked[seriesKey(publisherID, topic)] = true
+	h.mu.Unlock()
+}
+
+func (h *Historian) isTracked(publisherID, topic string) bool {
+	return h.tracked[seriesKey(publisherID, topic)] || h.tracked[seriesKey("", topic)]
+}
+
+// Attach records the values published through mc from now on
+func (h *Historian) Attach(mc *TestDesign.MasterController) {
+	mc.AddEventListener(func(event TestDesign.Event) {
+		if event.Type != TestDesign.EventPublished {
+			return
+		}
+		if err := h.Record(event.PublisherID, event.Topic, event.Time, event.Value); err != nil {
+			fmt.Printf("Error recording history of %s: %v\n", seriesKey(event.PublisherID, event.Topic), err)
+		}
+	})
+}
+
+// Record adds a value to the series of publisherID and topic when the topic is tracked
+func (h *Historian) Record(publisherID, topic string, t time.Time, value interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.isTracked(publisherID, topic) {
+		return nil
+	}
+	key := seriesKey(publisherID, topic)
+	s := h.series[key]
+	if s == nil {
+		s = &series{publisherID: publisherID, topic: topic, ring: newRing(h.options.Capacity), nextSeq: 1}
+		if h.options.Dir != "" {
+			segments, err := openSegmentWriter(h.options.Dir, publisherID, topic, h.options.SegmentSamples)
+			if err != nil {
+				return err
+			}
+			s.segments = segments
+			s.nextSeq = segments.nextSeq
+		}
+		h.series[key] = s
+	}
+
+	sample := Sample{Seq: s.nextSeq, Time: t, Value: value}
+	s.nextSeq++
+	s.ring.push(sample)
+	if s.segments != nil {
+		return s.segments.write(sample)
+	}
+	return nil
+}
+
+// Series returns the keys of the recorded series as "publisher:topic", sorted
+func (h *Historian) Series() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Query returns the samples of the series with a time in [from, to), oldest first. Samples with the same time are
+// in the order they were recorded. A zero from or to leaves that side of the range open.
+func (h *Historian) Query(publisherID, topic string, from, to time.Time) ([]Sample, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s := h.series[seriesKey(publisherID, topic)]
+	if s == nil {
+		if h.options.Dir == "" {
+			return nil, nil
+		}
+		// The series may only be on disk, from an earlier run
+		samples, err := readSegments(h.options.Dir, publisherID, topic, from, to, 0)
+		sortByTime(samples)
+		return samples, err
+	}
+
+	inMemory := s.ring.samples()
+	var samples []Sample
+	if s.segments != nil && (len(inMemory) == 0 || inMemory[0].Seq > 1) {
+		// The oldest samples are no longer in the ring buffer, or were recorded by an earlier run, read them from disk
+		before := uint64(0)
+		if len(inMemory) > 0 {
+			before = inMemory[0].Seq
+		}
+		older, err := readSegments(h.options.Dir, publisherID, topic, from, to, before)
+		if err != nil {
+			return nil, err
+		}
+		samples = older
+	}
+	for _, sample := range inMemory {
+		if inRange(sample.Time, from, to) {
+			samples = append(samples, sample)
+		}
+	}
+	sortByTime(samples)
+	return samples, nil
+}
+
+// sortByTime orders samples by their time instead of the order they were recorded in, publishers don't always
+// publish in time order
+func sortByTime(samples []Sample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+}
+
+// Close closes the segment files
+func (h *Historian) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var errs []error
+	for _, s := range h.series {
+		if s.segments != nil {
+			errs = append(errs, s.segments.close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func seriesKey(publisherID, topic string) string {
+	return publisherID + ":" + topic
+}
+
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
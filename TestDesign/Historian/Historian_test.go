@@ -0,0 +1,58 @@
+package Historian
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryAndDownsampleOrderSamplesByTime(t *testing.T) {
+	history := New(Options{})
+	history.Track("sensor", "temperature")
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	// A late sample arrives after newer ones
+	for _, sample := range []struct {
+		offset time.Duration
+		value  float64
+	}{{0, 1}, {2 * time.Minute, 3}, {time.Minute, 2}, {-30 * time.Second, 4}} {
+		if err := history.Record("sensor", "temperature", start.Add(sample.offset), sample.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples, err := history.Query("sensor", "temperature", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Time.Before(samples[i-1].Time) {
+			t.Fatalf("sample %d at %s comes after one at %s", i, samples[i].Time, samples[i-1].Time)
+		}
+	}
+
+	buckets, err := history.Downsample("sensor", "temperature", time.Time{}, time.Time{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Bucket{
+		{Start: start.Add(-time.Minute), Count: 1, Min: 4, Max: 4, Avg: 4},
+		{Start: start, Count: 1, Min: 1, Max: 1, Avg: 1},
+		{Start: start.Add(time.Minute), Count: 1, Min: 2, Max: 2, Avg: 2},
+		{Start: start.Add(2 * time.Minute), Count: 1, Min: 3, Max: 3, Avg: 3},
+	}
+	if len(buckets) != len(expected) {
+		t.Fatalf("downsampled to %v, expected %v", buckets, expected)
+	}
+	for i, bucket := range buckets {
+		if !bucket.Start.Equal(expected[i].Start) || bucket.Count != expected[i].Count || bucket.Avg != expected[i].Avg {
+			t.Fatalf("bucket %d is %v, expected %v", i, bucket, expected[i])
+		}
+	}
+}
+
+func TestDownsampleRoundsDownBeforeTheOrigin(t *testing.T) {
+	origin := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	buckets := downsample([]Sample{{Time: origin.Add(-90 * time.Second), Value: 1}, {Time: origin.Add(-10 * time.Second), Value: 2}}, origin, time.Minute)
+	if len(buckets) != 2 || !buckets[0].Start.Equal(origin.Add(-2*time.Minute)) || !buckets[1].Start.Equal(origin.Add(-time.Minute)) {
+		t.Fatalf("downsampled to %v, expected buckets at -2m and -1m", buckets)
+	}
+}
@@ -0,0 +1,32 @@
+package Historian
+
+// ring keeps the last samples of a series in a fixed amount of memory
+type ring struct {
+	buffer []Sample
+	start  int
+	count  int
+}
+
+func newRing(capacity int) *ring {
+	return &ring{buffer: make([]Sample, capacity)}
+}
+
+// push adds a sample, overwriting the oldest one when the ring is full
+func (r *ring) push(sample Sample) {
+	if r.count < len(r.buffer) {
+		r.buffer[(r.start+r.count)%len(r.buffer)] = sample
+		r.count++
+		return
+	}
+	r.buffer[r.start] = sample
+	r.start = (r.start + 1) % len(r.buffer)
+}
+
+// samples returns a copy of the samples, oldest first
+func (r *ring) samples() []Sample {
+	samples := make([]Sample, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		samples = append(samples, r.buffer[(r.start+i)%len(r.buffer)])
+	}
+	return samples
+}
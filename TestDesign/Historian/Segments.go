@@ -0,0 +1,176 @@
+package Historian
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".jsonl"
+)
+
+// segmentSample is a sample as it is stored on disk
+type segmentSample struct {
+	Seq   uint64      `json:"seq"`
+	Time  time.Time   `json:"time"`
+	Value interface{} `json:"value"`
+}
+
+// segmentWriter appends the samples of a series to segment files named after the sequence number of their first
+// sample, starting a new file every maxSamples samples
+type segmentWriter struct {
+	dir        string
+	maxSamples int
+	file       *os.File
+	samples    int
+	nextSeq    uint64
+}
+
+func seriesDir(dir, publisherID, topic string) string {
+	return filepath.Join(dir, url.PathEscape(seriesKey(publisherID, topic)))
+}
+
+// openSegmentWriter continues the sequence numbers of the segments an earlier run left behind
+func openSegmentWriter(dir, publisherID, topic string, maxSamples int) (*segmentWriter, error) {
+	w := &segmentWriter{dir: seriesDir(dir, publisherID, topic), maxSamples: maxSamples, nextSeq: 1}
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating history directory: %w", err)
+	}
+	segments, err := listSegments(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		err := readSegment(segments[len(segments)-1].path, func(sample segmentSample) bool {
+			w.nextSeq = sample.Seq + 1
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *segmentWriter) write(sample Sample) error {
+	if w.file == nil || w.samples >= w.maxSamples {
+		if err := w.close(); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s%020d%s", segmentPrefix, sample.Seq, segmentSuffix)
+		file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("error creating history segment: %w", err)
+		}
+		w.file = file
+		w.samples = 0
+	}
+
+	line, err := json.Marshal(segmentSample{Seq: sample.Seq, Time: sample.Time, Value: sample.Value})
+	if err != nil {
+		return fmt.Errorf("error encoding sample: %w", err)
+	}
+	if _, err := w.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing sample: %w", err)
+	}
+	w.samples++
+	w.nextSeq = sample.Seq + 1
+	return nil
+}
+
+func (w *segmentWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+type segmentFile struct {
+	path     string
+	firstSeq uint64
+}
+
+func listSegments(dir string) ([]segmentFile, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history directory: %w", err)
+	}
+	var segments []segmentFile
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		firstSeq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segmentFile{path: filepath.Join(dir, name), firstSeq: firstSeq})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].firstSeq < segments[j].firstSeq })
+	return segments, nil
+}
+
+// readSegment calls fn for every sample in the file until fn returns false
+func readSegment(path string, fn func(sample segmentSample) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening history segment: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var sample segmentSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return fmt.Errorf("error decoding %s: %w", path, err)
+		}
+		if !fn(sample) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// readSegments returns the samples on disk with a time in [from, to) and a sequence number before beforeSeq, zero
+// reads every sequence number
+func readSegments(dir, publisherID, topic string, from, to time.Time, beforeSeq uint64) ([]Sample, error) {
+	segments, err := listSegments(seriesDir(dir, publisherID, topic))
+	if err != nil {
+		return nil, err
+	}
+	var samples []Sample
+	for _, segment := range segments {
+		if beforeSeq > 0 && segment.firstSeq >= beforeSeq {
+			break
+		}
+		err := readSegment(segment.path, func(sample segmentSample) bool {
+			if beforeSeq > 0 && sample.Seq >= beforeSeq {
+				return false
+			}
+			if inRange(sample.Time, from, to) {
+				samples = append(samples, Sample{Seq: sample.Seq, Time: sample.Time, Value: sample.Value})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,171 @@
+package Journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Strategies"
+	"strings"
+	"time"
+)
+
+/*
+This package records what happens on the line in an append-only journal. A Writer attached to a MasterController
+turns its events into entries: every executed SubscribeCommand, UnsubscribeCommand, PublishValueCommand,
+SetStrategyCommand and ExecuteCommand, every notification delivered to a subscriber, every (un)registration and every
+state change of a module. The parameters of a strategy switch are journaled with their secrets redacted.
+
+Every entry carries a sequence number and a timestamp. Entries are stored as JSON lines in segment files that are
+rotated by size and age, see Writer.go. Reader.go reads them back for tools such as the replay engine.
+*/
+
+type EntryType string
+
+const (
+	EntrySubscribe   EntryType = "subscribe"
+	EntryUnsubscribe EntryType = "unsubscribe"
+	EntryPublish     EntryType = "publish"
+	EntryNotify      EntryType = "notify"
+	EntryRegister    EntryType = "register"
+	EntryUnregister  EntryType = "unregister"
+	EntryStateChange EntryType = "stateChange"
+	EntrySetStrategy EntryType = "setStrategy"
+	EntryExecute     EntryType = "execute"
+)
+
+type Entry struct {
+	Seq           uint64          `json:"seq"`
+	Time          time.Time       `json:"time"`
+	Type          EntryType       `json:"type"`
+	ModuleID      string          `json:"module,omitempty"`
+	PublisherID   string          `json:"publisher,omitempty"`
+	SubscriberID  string          `json:"subscriber,omitempty"`
+	Topic         string          `json:"topic,omitempty"`
+	Value         json.RawMessage `json:"value,omitempty"`
+	State         string          `json:"state,omitempty"`
+	PreviousState string          `json:"previousState,omitempty"`
+	// Strategy and Params are the identifier and the redacted parameters of a strategy switch
+	Strategy string                 `json:"strategy,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+}
+
+// DecodeValue returns the value of the entry as decoded by encoding/json
+func (e Entry) DecodeValue() (interface{}, error) {
+	if len(e.Value) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(e.Value, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// EncodeValue returns the JSON form of value. Values that can't be marshalled are stored as their %v string.
+func EncodeValue(value interface{}) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%v", value))
+	}
+	return data
+}
+
+// EntryFromEvent converts a controller event to an entry without sequence number. It reports false for events
+// that aren't journaled.
+func EntryFromEvent(event TestDesign.Event) (Entry, bool) {
+	entry := Entry{Time: event.Time, ModuleID: event.ModuleID}
+	switch event.Type {
+	case TestDesign.EventCommand:
+		switch command := event.Command.(type) {
+		case *TestDesign.SubscribeCommand:
+			entry.Type = EntrySubscribe
+			entry.SubscriberID = command.GetSubscriberID()
+			entry.PublisherID = command.GetTargetID()
+			entry.Topic = command.GetTopic()
+		case *TestDesign.UnsubscribeCommand:
+			entry.Type = EntryUnsubscribe
+			entry.SubscriberID = command.GetSubscriberID()
+			entry.PublisherID = command.GetTargetID()
+			entry.Topic = command.GetTopic()
+		case *TestDesign.PublishValueCommand:
+			entry.Type = EntryPublish
+			entry.PublisherID = command.GetPublisherID()
+			entry.Topic = command.GetTopic()
+			entry.Value = EncodeValue(command.GetValue())
+		case *TestDesign.SetStrategyCommand:
+			entry.Type = EntrySetStrategy
+			entry.ModuleID = command.GetModuleID()
+			entry.Strategy, entry.Params = redactStrategy(command.GetIdentifier(), command.GetParams())
+		case *TestDesign.ExecuteCommand:
+			entry.Type = EntryExecute
+			entry.ModuleID = command.GetModuleID()
+		default:
+			return entry, false
+		}
+	case TestDesign.EventNotified:
+		entry.Type = EntryNotify
+		entry.PublisherID = event.PublisherID
+		entry.SubscriberID = event.SubscriberID
+		entry.Topic = event.Topic
+		entry.Value = EncodeValue(event.Value)
+	case TestDesign.EventRegistered:
+		entry.Type = EntryRegister
+		entry.State = event.State.String()
+	case TestDesign.EventUnregistered:
+		entry.Type = EntryUnregister
+	case TestDesign.EventStateChanged:
+		entry.Type = EntryStateChange
+		entry.State = event.State.String()
+		entry.PreviousState = event.PreviousState.String()
+	default:
+		return entry, false
+	}
+	return entry, true
+}
+
+// redactStrategy splits the parameters off identifier and redacts the secret ones, like Strategies.Registry.Describe.
+// The journal doesn't know the kind of the module, so a parameter is redacted when it is secret for any kind the
+// identifier resolves to, and every parameter is redacted when it resolves to none.
+func redactStrategy(identifier string, params map[string]interface{}) (string, map[string]interface{}) {
+	var redacted map[string]interface{}
+	resolved := false
+	for _, kind := range []string{Strategies.KindCompressor, Strategies.KindDispenser} {
+		name, described, err := Strategies.DefaultRegistry.Describe(kind, identifier, params)
+		if err != nil {
+			continue
+		}
+		if !resolved {
+			identifier, redacted, resolved = name, described, true
+			continue
+		}
+		for param, value := range described {
+			if value == Strategies.Redacted {
+				redacted[param] = value
+			}
+		}
+	}
+	if resolved {
+		return identifier, emptyToNil(redacted)
+	}
+	identifier, query, _ := strings.Cut(identifier, "?")
+	redacted = make(map[string]interface{}, len(params))
+	if merged, err := Strategies.ParseParams(query); err == nil {
+		for param := range merged {
+			redacted[param] = Strategies.Redacted
+		}
+	}
+	for param := range params {
+		redacted[param] = Strategies.Redacted
+	}
+	return identifier, emptyToNil(redacted)
+}
+
+func emptyToNil(params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
@@ -0,0 +1,182 @@
+package Journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errStop ends an iteration early without an error
+var errStop = errors.New("stop iteration")
+
+// maxEntryBytes is the size of the longest line, newline included, that can be read back
+const maxEntryBytes = 16 << 20
+
+type Segment struct {
+	Path     string
+	FirstSeq uint64
+	Size     int64
+}
+
+type Reader struct {
+	dir      string
+	segments []Segment
+}
+
+// OpenReader lists the segments in dir. Segments written after OpenReader returned aren't read.
+func OpenReader(dir string) (*Reader, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal directory: %w", err)
+	}
+	reader := &Reader{dir: dir}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		firstSeq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, fmt.Errorf("error reading journal segment: %w", err)
+		}
+		reader.segments = append(reader.segments, Segment{Path: filepath.Join(dir, name), FirstSeq: firstSeq, Size: info.Size()})
+	}
+	sort.Slice(reader.segments, func(i, j int) bool { return reader.segments[i].FirstSeq < reader.segments[j].FirstSeq })
+	return reader, nil
+}
+
+func (r *Reader) Segments() []Segment {
+	return append([]Segment(nil), r.segments...)
+}
+
+// Iterate calls fn for every entry with a sequence number of at least fromSeq, in order, until fn returns an error
+func (r *Reader) Iterate(fromSeq uint64, fn func(entry Entry) error) error {
+	for i, segment := range r.segments {
+		// Skip segments that only hold entries before fromSeq
+		if i+1 < len(r.segments) && r.segments[i+1].FirstSeq <= fromSeq {
+			continue
+		}
+		if err := iterateSegment(segment, fromSeq, fn); err != nil {
+			if errors.Is(err, errStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func iterateSegment(segment Segment, fromSeq uint64, fn func(entry Entry) error) error {
+	file, err := os.Open(segment.Path)
+	if err != nil {
+		return fmt.Errorf("error opening journal segment: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxEntryBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("error decoding %s line %d: %w", segment.Path, line, err)
+		}
+		if entry.Seq < fromSeq {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ReadAll returns every entry of the journal
+func (r *Reader) ReadAll() ([]Entry, error) {
+	var entries []Entry
+	err := r.Iterate(0, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// Range returns the entries with a sequence number from fromSeq up to and including toSeq
+func (r *Reader) Range(fromSeq, toSeq uint64) ([]Entry, error) {
+	var entries []Entry
+	err := r.Iterate(fromSeq, func(entry Entry) error {
+		if entry.Seq > toSeq {
+			return errStop
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// Last returns the last entry of the journal and reports false when the journal is empty
+func (r *Reader) Last() (Entry, bool, error) {
+	var last Entry
+	found := false
+	for i := len(r.segments) - 1; i >= 0 && !found; i-- {
+		err := iterateSegment(r.segments[i], 0, func(entry Entry) error {
+			last = entry
+			found = true
+			return nil
+		})
+		if err != nil {
+			return last, false, err
+		}
+	}
+	return last, found, nil
+}
+
+// repairTail truncates the last line of segment when a crash left it behind incomplete or undecodable, so the
+// journal can be read and appended to again. It returns the number of bytes it removed.
+func repairTail(segment Segment) (int64, error) {
+	file, err := os.OpenFile(segment.Path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error opening journal segment: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset, lastStart int64
+	var last []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lastStart, last = offset, line
+			offset += int64(len(line))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading journal segment: %w", err)
+		}
+	}
+	if last == nil {
+		return 0, nil
+	}
+	var entry Entry
+	if last[len(last)-1] == '\n' && json.Unmarshal(last, &entry) == nil {
+		return 0, nil
+	}
+	if err := file.Truncate(lastStart); err != nil {
+		return 0, fmt.Errorf("error truncating journal segment: %w", err)
+	}
+	return offset - lastStart, nil
+}
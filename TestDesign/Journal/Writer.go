@@ -0,0 +1,176 @@
+package Journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Timing"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".jsonl"
+
+	defaultMaxSegmentBytes = 16 << 20
+)
+
+type Config struct {
+	// Dir is the directory the segment files are written to, it is created when it doesn't exist
+	Dir string
+	// MaxSegmentBytes rotates the segment before it grows beyond this size, zero uses 16 MiB
+	MaxSegmentBytes int64
+	// MaxSegmentAge rotates the segment once it is this old, zero disables rotation by age
+	MaxSegmentAge time.Duration
+	// Clock timestamps the entries and measures the segment age, nil uses the real clock
+	Clock Timing.Clock
+}
+
+type Writer struct {
+	config    Config
+	file      *os.File
+	size      int64
+	createdAt time.Time
+	nextSeq   uint64
+	closed    bool
+	mu        sync.Mutex
+}
+
+// Open opens the journal in config.Dir for appending. The sequence numbers continue after the last entry that is
+// already in the directory. A last entry that a crash left half written is removed.
+func Open(config Config) (*Writer, error) {
+	if config.Dir == "" {
+		return nil, errors.New("journal directory is not set")
+	}
+	if config.MaxSegmentBytes <= 0 {
+		config.MaxSegmentBytes = defaultMaxSegmentBytes
+	}
+	if config.Clock == nil {
+		config.Clock = Timing.RealClock{}
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating journal directory: %w", err)
+	}
+
+	w := &Writer{config: config, nextSeq: 1}
+	reader, err := OpenReader(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if segments := reader.Segments(); len(segments) > 0 {
+		removed, err := repairTail(segments[len(segments)-1])
+		if err != nil {
+			return nil, err
+		}
+		if removed > 0 {
+			fmt.Printf("Removed %d bytes of an incomplete journal entry from %s\n", removed, segments[len(segments)-1].Path)
+		}
+	}
+	if last, ok, err := reader.Last(); err != nil {
+		return nil, err
+	} else if ok {
+		w.nextSeq = last.Seq + 1
+	}
+	return w, nil
+}
+
+// Attach journals the events of mc from now on
+func (w *Writer) Attach(mc *TestDesign.MasterController) {
+	mc.AddEventListener(func(event TestDesign.Event) {
+		entry, ok := EntryFromEvent(event)
+		if !ok {
+			return
+		}
+		if _, err := w.Append(entry); err != nil {
+			fmt.Printf("Error writing journal entry: %v\n", err)
+		}
+	})
+}
+
+// Append assigns the next sequence number to entry, timestamps it when it has no time yet and writes it
+func (w *Writer) Append(entry Entry) (Entry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return entry, errors.New("journal is closed")
+	}
+
+	entry.Seq = w.nextSeq
+	if entry.Time.IsZero() {
+		entry.Time = w.config.Clock.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("error encoding journal entry: %w", err)
+	}
+	line = append(line, '\n')
+	if len(line) > maxEntryBytes {
+		return entry, fmt.Errorf("journal entry of %d bytes exceeds the maximum of %d", len(line), maxEntryBytes)
+	}
+
+	if err := w.rotateIfNeeded(int64(len(line)), entry.Seq); err != nil {
+		return entry, err
+	}
+	if _, err := w.file.Write(line); err != nil {
+		return entry, fmt.Errorf("error writing journal entry: %w", err)
+	}
+	w.size += int64(len(line))
+	w.nextSeq++
+	return entry, nil
+}
+
+// rotateIfNeeded must be called with the lock held. It starts a new segment, named after the sequence number of its
+// first entry, when there is none or the current one is too big or too old.
+func (w *Writer) rotateIfNeeded(lineSize int64, seq uint64) error {
+	if w.file != nil {
+		tooBig := w.size > 0 && w.size+lineSize > w.config.MaxSegmentBytes
+		tooOld := w.config.MaxSegmentAge > 0 && w.config.Clock.Since(w.createdAt) >= w.config.MaxSegmentAge
+		if !tooBig && !tooOld {
+			return nil
+		}
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("error closing journal segment: %w", err)
+		}
+		w.file = nil
+	}
+
+	path := filepath.Join(w.config.Dir, segmentName(seq))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error creating journal segment: %w", err)
+	}
+	w.file = file
+	w.size = 0
+	w.createdAt = w.config.Clock.Now()
+	return nil
+}
+
+// Sync flushes the current segment to disk
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func segmentName(firstSeq uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, firstSeq, segmentSuffix)
+}
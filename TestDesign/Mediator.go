@@ -3,6 +3,10 @@ package TestDesign
 import (
 	"errors"
 	"fmt"
+	"mcs/TestDesign/Strategies"
+	"mcs/TestDesign/Timing"
+	"reflect"
+	"sort"
 	"sync"
 )
 
@@ -33,13 +37,29 @@ type IMediator interface {
 	Subscribe(subscriberID, publisherID, valueName string)
 	Unsubscribe(subscriberID, publisherID, valueName string)
 	NotifySubscribers(publisherID, valueName string, value interface{})
+	Heartbeat(moduleID string)
 }
 
+// CommandInterceptor is called for every command sent to the controller instead of queueing it directly. It decides
+// if, when and how often the command is passed on to enqueue.
+type CommandInterceptor = func(command ICommand, targetID string, enqueue func(command ICommand, targetID string))
+
+// commandQueueSize is the number of commands that can be queued before SendCommand blocks
+const commandQueueSize = 256
+
 // MasterController struct
 type MasterController struct {
 	modules       map[string]*BaseModule
 	subscriptions map[string]map[string]bool
 	commandQueue  chan commandWithTargetID // Command queue channel
+	clock         Timing.Clock
+	watchdog      *Watchdog
+	health        healthRegistry
+	events        eventBus
+	interceptor   CommandInterceptor
+	topicTypes    TopicTypes
+	pending       int // Commands that were sent but haven't finished executing
+	idle          *sync.Cond
 	wg            sync.WaitGroup
 	mu            sync.Mutex
 }
@@ -49,11 +69,19 @@ type commandWithTargetID struct {
 }
 
 func NewMasterController() *MasterController {
+	return NewMasterControllerWithClock(Timing.RealClock{})
+}
+
+// NewMasterControllerWithClock creates a controller that takes all its time from clock. Modules registered with the
+// controller use the same clock, so a Timing.VirtualClock makes the whole system run in virtual time.
+func NewMasterControllerWithClock(clock Timing.Clock) *MasterController {
 	mc := &MasterController{
+		clock:         clock,
 		modules:       make(map[string]*BaseModule),
 		subscriptions: make(map[string]map[string]bool),
-		commandQueue:  make(chan commandWithTargetID), // Initialize the command queue channel
+		commandQueue:  make(chan commandWithTargetID, commandQueueSize), // Initialize the command queue channel
 	}
+	mc.idle = sync.NewCond(&sync.Mutex{})
 
 	// Start a goroutine to process commands from the queue
 	numWorkers := 5 // Adjust based on your needs
@@ -62,11 +90,51 @@ func NewMasterController() *MasterController {
 		go mc.processCommands()
 	}
 
+	mc.watchdog = NewWatchdog(mc, defaultWatchdogCheckInterval)
+	mc.watchdog.Start()
+
 	return mc
 }
 
+// GetModules returns a copy of the registered modules
 func (mc *MasterController) GetModules() map[string]*BaseModule {
-	return mc.modules
+	return mc.snapshotModules()
+}
+
+// snapshotModules returns a copy of the registered modules that is safe to iterate without holding the lock
+func (mc *MasterController) snapshotModules() map[string]*BaseModule {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	modules := make(map[string]*BaseModule, len(mc.modules))
+	for id, module := range mc.modules {
+		modules[id] = module
+	}
+	return modules
+}
+
+func (mc *MasterController) GetClock() Timing.Clock {
+	return mc.clock
+}
+
+func (mc *MasterController) GetWatchdog() *Watchdog {
+	return mc.watchdog
+}
+
+// Heartbeat records that the module is still alive
+func (mc *MasterController) Heartbeat(moduleID string) {
+	mc.watchdog.Beat(moduleID)
+}
+
+// AddEventListener registers a listener that is called for every event raised by the controller
+func (mc *MasterController) AddEventListener(listener EventListener) {
+	mc.events.add(listener)
+}
+
+func (mc *MasterController) raiseEvent(event Event) {
+	if event.Time.IsZero() {
+		event.Time = mc.clock.Now()
+	}
+	mc.events.raise(event)
 }
 
 func (mc *MasterController) processCommands() {
@@ -75,7 +143,8 @@ func (mc *MasterController) processCommands() {
 		mc.mu.Lock()
 		if targetModule := mc.modules[command.targetID]; targetModule != nil {
 			mc.mu.Unlock()
-			if err := command.command.Execute(targetModule); err != nil {
+			mc.raiseEvent(Event{Type: EventCommand, ModuleID: command.targetID, Command: command.command})
+			if err := executeCommand(command.command, targetModule); err != nil {
 				// Handle error, e.g., log it
 				fmt.Printf("Error executing command: %v\n", err)
 			}
@@ -83,9 +152,20 @@ func (mc *MasterController) processCommands() {
 			mc.mu.Unlock()
 			// Optionally, handle the case where the target module is not found
 		}
+		mc.commandDone()
 	}
 }
 
+// executeCommand turns a panic in a command, or in a callback it runs, into an error so the worker survives
+func executeCommand(command ICommand, module *BaseModule) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("command %T panicked: %v", command, r)
+		}
+	}()
+	return command.Execute(module)
+}
+
 func (mc *MasterController) DisplaySubscriptions() {
 	fmt.Println("--------------------")
 	for s, m := range mc.subscriptions {
@@ -105,12 +185,29 @@ func (mc *MasterController) Subscribe(subscriberID, publisherID, valueName strin
 	mc.mu.Unlock() // Unlock after writing
 }
 
+// DeclareTopic records the type of a typed topic, see Topic. Subscribers that expect another type are reported, they
+// drop the values of the topic.
+func (mc *MasterController) DeclareTopic(publisherID, topic string, valueType reflect.Type) error {
+	mismatches, err := mc.topicTypes.Declare(publisherID, topic, valueType)
+	for _, mismatch := range mismatches {
+		fmt.Printf("MasterController: %s expects %s from %s:%s, which is declared as %s\n", mismatch.SubscriberID, mismatch.Expected, publisherID, topic, valueType)
+	}
+	return err
+}
+
+// ExpectTopic records the type a subscriber of a typed topic expects, see Topic
+func (mc *MasterController) ExpectTopic(subscriberID, publisherID, topic string, valueType reflect.Type) error {
+	return mc.topicTypes.Expect(subscriberID, publisherID, topic, valueType)
+}
+
 func (mc *MasterController) Wait() {
 	mc.wg.Wait()
 }
 
 func (mc *MasterController) Unsubscribe(subscriberID, publisherID, valueName string) {
 	key := publisherID + ":" + valueName
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 	if subscribers, exists := mc.subscriptions[key]; exists {
 		// Check if the subscriber is actually subscribed
 		if _, subscribed := subscribers[subscriberID]; subscribed {
@@ -127,43 +224,159 @@ func (mc *MasterController) Unsubscribe(subscriberID, publisherID, valueName str
 
 func (mc *MasterController) NotifySubscribers(publisherID, valueName string, value interface{}) {
 	key := publisherID + ":" + valueName
-	if subscribers, exists := mc.subscriptions[key]; exists {
-		for subscriberID := range subscribers {
-			if module := mc.GetModule(subscriberID); module != nil && module.GetState() != ErrorState {
-				module.NotifySubscriber(valueName, value)
-			}
+	if err := mc.topicTypes.Check(publisherID, valueName, value); err != nil {
+		fmt.Printf("MasterController dropped a value: %v\n", err)
+		return
+	}
+	mc.raiseEvent(Event{Type: EventPublished, PublisherID: publisherID, Topic: valueName, Value: value})
+
+	// Copy the subscribers so callbacks can (un)subscribe without a concurrent map access
+	mc.mu.Lock()
+	subscriberIDs := make([]string, 0, len(mc.subscriptions[key]))
+	for subscriberID := range mc.subscriptions[key] {
+		subscriberIDs = append(subscriberIDs, subscriberID)
+	}
+	mc.mu.Unlock()
+
+	for _, subscriberID := range subscriberIDs {
+		if module := mc.GetModule(subscriberID); module != nil && module.GetState() != ErrorState {
+			module.NotifySubscriberFrom(publisherID, valueName, value)
+			mc.raiseEvent(Event{Type: EventNotified, ModuleID: subscriberID, PublisherID: publisherID, SubscriberID: subscriberID, Topic: valueName, Value: value})
 		}
 	}
 }
 
 func (mc *MasterController) RegisterModule(module interface{}) error {
+	var base *BaseModule
 	if m, ok := module.(*BaseModule); ok {
-		mc.modules[m.id] = m
+		base = m
 	} else if sm, ok := module.(*CompressorModule); ok {
-		mc.modules[sm.id] = sm.BaseModule
+		base = sm.BaseModule
 	} else if sm, ok := module.(*DispenserModule); ok {
-		mc.modules[sm.id] = sm.BaseModule
+		base = sm.BaseModule
 	} else {
 		return errors.New("module not supported")
 	}
+	base.SetClock(mc.clock)
+	base.setStateListener(mc.moduleStateChanged)
+	mc.mu.Lock()
+	mc.modules[base.id] = base
+	mc.mu.Unlock()
+	mc.raiseEvent(Event{Type: EventRegistered, ModuleID: base.id, State: base.GetState()})
 	return nil
 }
 
+func (mc *MasterController) moduleStateChanged(moduleID string, previous, state State) {
+	mc.raiseEvent(Event{Type: EventStateChanged, ModuleID: moduleID, PreviousState: previous, State: state})
+}
+
 func (mc *MasterController) UnregisterModule(moduleId string) error {
 	//Can add something in here that notifies modules if their subscribed module unregisters
-	if mc.modules[moduleId] != nil {
-		delete(mc.modules, moduleId)
-	} else {
+	mc.mu.Lock()
+	module := mc.modules[moduleId]
+	if module == nil {
+		mc.mu.Unlock()
 		return errors.New("module id not found")
 	}
+	delete(mc.modules, moduleId)
+	mc.mu.Unlock()
+	module.setStateListener(nil)
+	if processing, ok := module.Owner().(streamProcessor); ok {
+		processing.StopProcessing()
+	}
+	mc.topicTypes.Forget(moduleId)
+	mc.removeHealthChecks(moduleId)
+	mc.raiseEvent(Event{Type: EventUnregistered, ModuleID: moduleId})
 	return nil
 }
 
+// SetCommandInterceptor routes every command sent from now on through interceptor, nil removes it
+func (mc *MasterController) SetCommandInterceptor(interceptor CommandInterceptor) {
+	mc.mu.Lock()
+	mc.interceptor = interceptor
+	mc.mu.Unlock()
+}
+
 func (mc *MasterController) SendCommand(command ICommand, targetID string) {
+	mc.mu.Lock()
+	interceptor := mc.interceptor
+	mc.mu.Unlock()
+	if interceptor != nil {
+		interceptor(command, targetID, mc.enqueue)
+		return
+	}
+	mc.enqueue(command, targetID)
+}
+
+func (mc *MasterController) enqueue(command ICommand, targetID string) {
 	// Send the command with its target ID to the commandQueue channel
+	mc.idle.L.Lock()
+	mc.pending++
+	mc.idle.L.Unlock()
 	mc.commandQueue <- commandWithTargetID{command: command, targetID: targetID}
 }
 
+func (mc *MasterController) commandDone() {
+	mc.idle.L.Lock()
+	mc.pending--
+	if mc.pending == 0 {
+		mc.idle.Broadcast()
+	}
+	mc.idle.L.Unlock()
+}
+
+// Pending returns the number of commands that were sent but haven't finished executing
+func (mc *MasterController) Pending() int {
+	mc.idle.L.Lock()
+	defer mc.idle.L.Unlock()
+	return mc.pending
+}
+
+// WaitIdle blocks until every command that was sent, including the commands sent while executing them, has been
+// executed
+func (mc *MasterController) WaitIdle() {
+	mc.idle.L.Lock()
+	for mc.pending > 0 {
+		mc.idle.Wait()
+	}
+	mc.idle.L.Unlock()
+}
+
 func (mc *MasterController) GetModule(id string) *BaseModule {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 	return mc.modules[id]
 }
+
+// ConfigureStrategies switches the strategy of every registered module named in configs, such as the configs of
+// Strategies.LoadConfigs, with ConfigureStrategy. A module that isn't registered, holds no strategy or holds a
+// strategy of another kind than its config is reported in the returned error, the other modules are configured.
+func (mc *MasterController) ConfigureStrategies(configs map[string]Strategies.Config) error {
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var errs []error
+	for _, id := range ids {
+		config := configs[id]
+		module := mc.GetModule(id)
+		if module == nil {
+			errs = append(errs, fmt.Errorf("strategy config %s: module isn't registered", id))
+			continue
+		}
+		holder, ok := module.Owner().(StrategyHolder)
+		if !ok {
+			errs = append(errs, fmt.Errorf("strategy config %s: module has no strategy to set", id))
+			continue
+		}
+		if kind := holder.ActiveStrategy().Kind; config.Kind != kind {
+			errs = append(errs, fmt.Errorf("strategy config %s: module holds a %s, not a %s", id, kind, config.Kind))
+			continue
+		}
+		if err := holder.ConfigureStrategy(config.Strategy, config.Params); err != nil {
+			errs = append(errs, fmt.Errorf("strategy config %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
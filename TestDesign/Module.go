@@ -3,8 +3,12 @@ package TestDesign
 import (
 	"errors"
 	"fmt"
+	"mcs/TestDesign/DataSources"
 	"mcs/TestDesign/Strategies"
-	"mcs/TestDesign/Strategies/CompressorStrategies"
+	"mcs/TestDesign/Timing"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,6 +43,31 @@ const (
 	ErrorState
 )
 
+func (s State) String() string {
+	switch s {
+	case InitState:
+		return "init"
+	case RunningState:
+		return "running"
+	case ShutdownState:
+		return "shutdown"
+	case ErrorState:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseState returns the state whose String is s
+func ParseState(s string) (State, error) {
+	for _, state := range []State{InitState, RunningState, ShutdownState, ErrorState} {
+		if state.String() == s {
+			return state, nil
+		}
+	}
+	return InitState, fmt.Errorf("unknown state %q", s)
+}
+
 type Module interface {
 	Execute() (interface{}, error)
 }
@@ -50,34 +79,124 @@ type BaseModule struct {
 	Mediator IMediator
 	state    State
 	stopChan chan byte
+	// started is set while the background process runs, only then is stopChan read
+	started   bool
+	heartbeat HeartbeatConfig
+	source    DataSources.DataSource
+	clock     Timing.Clock
+	onState   func(moduleID string, previous, state State)
+	owner     interface{}
+	// handlers are the callbacks of the typed topics the module subscribed to, by publisher and topic. They return
+	// false for a value of the wrong type.
+	handlers map[string]func(value interface{}) bool
+	// intercept runs around the delivery of every value, see SetDeliveryInterceptor
+	intercept DeliveryInterceptor
+	mu        sync.Mutex
 }
 
+// NewModule creates a module whose background process publishes random numbers from randomnumberapi.com
 func NewModule(id string, controller IMediator) *BaseModule {
+	return NewModuleWithDataSource(id, controller, DataSources.NewRandomNumberSource(nil))
+}
+
+// NewModuleWithDataSource creates a module whose background process samples source. A nil source
+// disables sampling, the background process then only sends heartbeats.
+func NewModuleWithDataSource(id string, controller IMediator, source DataSources.DataSource) *BaseModule {
 	module := &BaseModule{
 		id:       id,
 		Mediator: controller,
 		state:    InitState, // Initialize the state to InitState
 		stopChan: make(chan byte),
+		source:   source,
+		clock:    Timing.RealClock{},
+	}
+	if publishing, ok := source.(DataSources.PublishingSource); ok {
+		publishing.SetPublisher(module.publishFromSource)
 	}
 	return module
 }
 
+func (m *BaseModule) GetDataSource() DataSources.DataSource {
+	return m.source
+}
+
+// SetDataSource replaces the data source of the module, it has to be called before TransitionToRunning to take effect
+func (m *BaseModule) SetDataSource(source DataSources.DataSource) {
+	m.source = source
+	if publishing, ok := source.(DataSources.PublishingSource); ok {
+		publishing.SetPublisher(m.publishFromSource)
+	}
+	if clocked, ok := source.(DataSources.ClockedSource); ok {
+		clocked.SetClock(m.GetClock())
+	}
+}
+
+// SetClock sets the clock of the module and its data source. RegisterModule sets it to the clock of the controller,
+// it has to be set before TransitionToRunning to take effect.
+func (m *BaseModule) SetClock(clock Timing.Clock) {
+	m.mu.Lock()
+	m.clock = clock
+	m.mu.Unlock()
+	if clocked, ok := m.source.(DataSources.ClockedSource); ok {
+		clocked.SetClock(clock)
+	}
+}
+
+func (m *BaseModule) GetClock() Timing.Clock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock
+}
+
 func (m *BaseModule) GetId() string {
 	return m.id
 }
 
 func (m *BaseModule) GetState() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.state
 }
 
 func (m *BaseModule) SetState(state State) {
+	m.mu.Lock()
+	previous := m.state
 	m.state = state
+	listener := m.onState
+	m.mu.Unlock()
+	if listener != nil && previous != state {
+		listener(m.id, previous, state)
+	}
+}
+
+// setStateListener is used by the controller the module is registered with to observe state changes
+func (m *BaseModule) setStateListener(listener func(moduleID string, previous, state State)) {
+	m.mu.Lock()
+	m.onState = listener
+	m.mu.Unlock()
+}
+
+// SetHeartbeatConfig configures the heartbeats the background process sends to the controller.
+// It has to be called before TransitionToRunning to take effect.
+func (m *BaseModule) SetHeartbeatConfig(config HeartbeatConfig) {
+	m.mu.Lock()
+	m.heartbeat = config
+	m.mu.Unlock()
+}
+
+func (m *BaseModule) GetHeartbeatConfig() HeartbeatConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.heartbeat
 }
 
 func (m *BaseModule) TransitionToRunning() {
-	if m.state == InitState {
+	if m.GetState() == InitState {
 		fmt.Printf("BaseModule %s is transitioning to idle state.\n", m.id)
-		m.state = RunningState
+		m.SetState(RunningState)
+		m.mu.Lock()
+		m.started = true
+		m.mu.Unlock()
 		go m.startBackgroundProcess() // Start the background process in a goroutine
 	} else {
 		fmt.Printf("BaseModule %s is already in idle state.\n", m.id)
@@ -89,130 +208,444 @@ func (m *BaseModule) ResolveError() {
 }
 
 func (m *BaseModule) startBackgroundProcess() {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
+	clock := m.GetClock()
+	var sample <-chan time.Time // nil when the module has no data source, so it never fires
+	if m.source != nil && m.source.Period() <= 0 {
+		// The built-in sources reject such a period when they are created, other sources can still have one
+		m.SetState(ErrorState)
+		fmt.Printf("BaseModule %s encountered an error: data source period %v isn't positive\n", m.id, m.source.Period())
+	} else if m.source != nil {
+		ticker := clock.NewTicker(m.source.Period())
+		defer ticker.Stop()
+		sample = ticker.C()
+	}
+	var heartbeat <-chan time.Time // nil when heartbeats are disabled, so it never fires
+	if config := m.GetHeartbeatConfig(); config.Interval > 0 {
+		heartbeatTicker := clock.NewTicker(config.Interval)
+		defer heartbeatTicker.Stop()
+		heartbeat = heartbeatTicker.C()
+		m.sendHeartbeat()
+	}
+	paused := false
 	for {
 		select {
 		case <-m.stopChan:
 			fmt.Printf("BaseModule %s background process stopped.\n", m.id)
 			return
-		case <-ticker.C:
+		case <-heartbeat:
+			m.sendHeartbeat()
+		case <-sample:
 			// Check if the module is in ErrorState
-			if m.state == ErrorState {
-				fmt.Printf("BaseModule %s is in error state, pausing background process.\n", m.id)
-				// Pause the process by waiting for a signal to resume
-				<-m.stopChan // This will block until the module is signaled to resume
-				continue     // Skip the rest of the loop iteration
+			if m.GetState() == ErrorState {
+				// A source that recovers, such as a ResilientSource whose breaker closed again, resumes the module
+				if recovering, ok := m.source.(DataSources.RecoveringSource); ok {
+					if value, recovered := recovering.Recover(); recovered {
+						fmt.Printf("BaseModule %s data source recovered, resuming background process.\n", m.id)
+						m.SetState(RunningState)
+						m.PublishToTopic(m.source.Topic(), value)
+						paused = false
+						continue
+					}
+				}
+				// Pause the process by skipping samples until the module is back in RunningState
+				if !paused {
+					fmt.Printf("BaseModule %s is in error state, pausing background process.\n", m.id)
+					paused = true
+				}
+				continue // Skip the rest of the loop iteration
 			}
-			number, err := fetchRandomNumber()
-			if err != nil {
-				m.SetState(ErrorState) // Transition to ErrorState on error
+			paused = false
+			value, err := m.source.Fetch()
+			var transient *DataSources.TransientError
+			if errors.As(err, &transient) {
+				fmt.Printf("BaseModule %s skipped a sample: %v\n", m.id, err)
+				continue
+			} else if err != nil {
+				m.SetState(ErrorState) // Transition to ErrorState on error, the next tick pauses the process
 				fmt.Printf("BaseModule %s encountered an error: %v\n", m.id, err)
-				return
+				continue
 			}
-			m.PublishToTopic("randomInt", number)
+			m.PublishToTopic(m.source.Topic(), value)
 		}
 	}
 }
 
+func (m *BaseModule) sendHeartbeat() {
+	m.Mediator.SendCommand(&HeartbeatCommand{moduleID: m.id}, m.id)
+}
+
 func (m *BaseModule) resolveErrorAndResume() {
 	// Hypothetical error resolution logic here
 	fmt.Printf("BaseModule %s error resolved, resuming background process.\n", m.id)
-	m.SetState(RunningState) // Transition back to RunningState
-	m.stopChan <- 1          // Send a signal to resume the background process
+	m.SetState(RunningState) // Transition back to RunningState, the next sample resumes the background process
 }
 
+// StopBackgroundProcess stops a running module. A module that was set to RunningState without TransitionToRunning
+// has no background process, it only transitions to ShutdownState.
 func (m *BaseModule) StopBackgroundProcess() {
-	if m.state == RunningState {
-		m.state = ShutdownState // Transition to Shutdown state
-		m.stopChan <- 0         // Signal the background process to stop
+	if m.GetState() == RunningState {
+		m.SetState(ShutdownState) // Transition to Shutdown state
+		m.mu.Lock()
+		started := m.started
+		m.started = false
+		m.mu.Unlock()
+		if started {
+			m.stopChan <- 0 // Signal the background process to stop
+		}
 	}
 }
 
 type NotificationCallback = func(valueName string, value interface{})
 
+// DeliveryInterceptor runs around the delivery of a value to a module, deliver hands the value to the handler of
+// its topic or to the NotificationCallback
+type DeliveryInterceptor = func(valueName string, value interface{}, deliver func())
+
 // NotifySubscriber notifies the module about a value change
 func (m *BaseModule) NotifySubscriber(valueName string, value interface{}) {
-	if m.notifier != nil {
-		m.notifier(valueName, value)
-	} else {
-		fmt.Printf("BaseModule %s received %s value update: %v\n", m.id, valueName, value)
+	m.deliver(valueName, value, func() {
+		if m.notifier != nil {
+			m.notifier(valueName, value)
+		} else {
+			fmt.Printf("BaseModule %s received %s value update: %v\n", m.id, valueName, value)
+		}
+	})
+}
+
+// NotifySubscriberFrom notifies the module about a value change of a topic of publisherID, which the mediators do.
+// A value of a typed topic the module subscribed to goes to the handler of that topic, any other value goes to
+// NotifySubscriber.
+func (m *BaseModule) NotifySubscriberFrom(publisherID, valueName string, value interface{}) {
+	m.mu.Lock()
+	handler := m.handlers[publisherID+":"+valueName]
+	m.mu.Unlock()
+	if handler == nil {
+		m.NotifySubscriber(valueName, value)
+		return
+	}
+	m.deliver(valueName, value, func() {
+		if !handler(value) {
+			fmt.Printf("BaseModule %s dropped %s:%s value of type %T\n", m.id, publisherID, valueName, value)
+		}
+	})
+}
+
+// SetDeliveryInterceptor makes interceptor run around the delivery of every value to the module, whichever
+// handler or callback receives it, nil removes it
+func (m *BaseModule) SetDeliveryInterceptor(interceptor DeliveryInterceptor) {
+	m.mu.Lock()
+	m.intercept = interceptor
+	m.mu.Unlock()
+}
+
+func (m *BaseModule) deliver(valueName string, value interface{}, deliver func()) {
+	m.mu.Lock()
+	intercept := m.intercept
+	m.mu.Unlock()
+	if intercept == nil {
+		deliver()
+		return
 	}
+	intercept(valueName, value, deliver)
 }
 
 func (m *BaseModule) SetNotificationCallback(callback NotificationCallback) {
 	m.notifier = callback
 }
 
+func (m *BaseModule) GetNotificationCallback() NotificationCallback {
+	return m.notifier
+}
+
+// setTopicHandler makes handler receive the values of topic of publisherID instead of the NotificationCallback,
+// nil removes it
+func (m *BaseModule) setTopicHandler(publisherID, topic string, handler func(value interface{}) bool) {
+	key := publisherID + ":" + topic
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if handler == nil {
+		delete(m.handlers, key)
+		return
+	}
+	if m.handlers == nil {
+		m.handlers = make(map[string]func(value interface{}) bool)
+	}
+	m.handlers[key] = handler
+}
+
 func (m *BaseModule) SubscribeToTopic(topic string, target string) {
-	if m.state != ErrorState {
-		m.Mediator.SendCommand(&SubscribeCommand{subscriberID: m.id, publisherID: target, topic: topic}, target)
+	if m.GetState() != ErrorState {
+		m.Mediator.SendCommand(NewSubscribeCommand(m.id, target, topic), target)
 	}
 }
 
 func (m *BaseModule) UnsubscribeFromTopic(topic string, target string) {
-	if m.state != ErrorState {
-		m.Mediator.SendCommand(&UnsubscribeCommand{subscriberID: m.id, publisherID: target, topic: topic}, target)
+	if m.GetState() != ErrorState {
+		m.Mediator.SendCommand(NewUnsubscribeCommand(m.id, target, topic), target)
 	}
 }
 
 func (m *BaseModule) PublishToTopic(topic string, value interface{}) {
-	if m.state != ErrorState {
-		m.Mediator.SendCommand(&PublishValueCommand{publisherID: m.id, topic: topic, value: value}, m.id)
+	if m.GetState() != ErrorState {
+		m.Mediator.SendCommand(NewPublishValueCommand(m.id, topic, value), m.id)
+	}
+}
+
+// publishFromSource publishes the values a data source publishes besides its samples. Unlike PublishToTopic it
+// publishes in ErrorState too, a circuit breaker reports that it half-opened while its module is in ErrorState.
+func (m *BaseModule) publishFromSource(topic string, value interface{}) {
+	m.Mediator.SendCommand(NewPublishValueCommand(m.id, topic, value), m.id)
+}
+
+// publishIfConnected publishes like PublishToTopic, for modules that may be used without a controller
+func (m *BaseModule) publishIfConnected(topic string, value interface{}) {
+	if m.Mediator != nil {
+		m.PublishToTopic(topic, value)
+	}
+}
+
+// SetOwner sets the module that embeds this BaseModule. Commands are executed on the BaseModule, they reach the
+// embedding module, such as a CompressorModule, through Owner.
+func (m *BaseModule) SetOwner(owner interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.owner = owner
+}
+
+// Owner returns the module that embeds this BaseModule, or the BaseModule itself when no owner was set
+func (m *BaseModule) Owner() interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owner == nil {
+		return m
+	}
+	return m.owner
+}
+
+const (
+	// ActiveStrategyTopic is the topic CompressorModule and DispenserModule publish their ActiveStrategy on when it
+	// was switched by ConfigureStrategy or a SetStrategyCommand
+	ActiveStrategyTopic = "activeStrategy"
+	// StrategyErrorTopic is the topic they publish the reason on when a switch was rejected
+	StrategyErrorTopic = "strategyError"
+)
+
+// ActiveStrategies and StrategyErrors are ActiveStrategyTopic and StrategyErrorTopic as typed topics
+var (
+	ActiveStrategies = NewTopic[ActiveStrategy](ActiveStrategyTopic)
+	StrategyErrors   = NewTopic[string](StrategyErrorTopic)
+)
+
+// ActiveStrategy describes the strategy of a module, its secret parameters are redacted
+type ActiveStrategy struct {
+	Kind string
+	// Strategy is the identifier the strategy was created with, empty when it was set with SetStrategy
+	Strategy string
+	Params   map[string]interface{}
+}
+
+// StrategyHolder is implemented by the modules whose strategy a SetStrategyCommand can switch
+type StrategyHolder interface {
+	ConfigureStrategy(identifier string, params map[string]interface{}) error
+	ActiveStrategy() ActiveStrategy
+}
+
+// strategySlot holds the strategy of a module, it is swapped atomically so Execute always runs either the old or
+// the new strategy
+type strategySlot struct {
+	kind   string
+	active atomic.Value
+}
+
+type slotContent struct {
+	strategy Strategies.Strategy
+	info     ActiveStrategy
+}
+
+// execute runs value through the strategy
+func (s *strategySlot) execute(value interface{}) (interface{}, error) {
+	strategy, _ := s.load()
+	if strategy == nil {
+		return nil, errors.New("execute wasn't set correctly")
+	}
+	return strategy.Execute(value)
+}
+
+func (s *strategySlot) load() (Strategies.Strategy, ActiveStrategy) {
+	content, _ := s.active.Load().(*slotContent)
+	if content == nil {
+		return nil, ActiveStrategy{Kind: s.kind}
+	}
+	return content.strategy, content.info
+}
+
+// set swaps in strategy. A strategy that reports, such as the adaptive compressor, publishes its reports on the
+// topics of module.
+func (s *strategySlot) set(module *BaseModule, strategy Strategies.Strategy, info ActiveStrategy) {
+	if reporting, ok := strategy.(Strategies.Reporting); ok {
+		reporting.SetReporter(module.publishIfConnected)
+	}
+	s.active.Store(&slotContent{strategy: strategy, info: info})
+}
+
+// swap sets strategy like set does and returns the strategy it replaced
+func (s *strategySlot) swap(module *BaseModule, strategy Strategies.Strategy, info ActiveStrategy) (Strategies.Strategy, ActiveStrategy) {
+	if reporting, ok := strategy.(Strategies.Reporting); ok {
+		reporting.SetReporter(module.publishIfConnected)
+	}
+	previous, _ := s.active.Swap(&slotContent{strategy: strategy, info: info}).(*slotContent)
+	if previous == nil {
+		previous = &slotContent{info: ActiveStrategy{Kind: s.kind}}
+	}
+	s.swapped(module, previous.info, info)
+	return previous.strategy, previous.info
+}
+
+// compareAndSwap swaps in strategy like swap does, but only while the slot holds old, which must be comparable
+// such as a pointer. It reports whether it swapped.
+func (s *strategySlot) compareAndSwap(module *BaseModule, old, strategy Strategies.Strategy, info ActiveStrategy) bool {
+	for {
+		current, _ := s.active.Load().(*slotContent)
+		if current == nil || current.strategy != old {
+			return false
+		}
+		if reporting, ok := strategy.(Strategies.Reporting); ok {
+			reporting.SetReporter(module.publishIfConnected)
+		}
+		if s.active.CompareAndSwap(current, &slotContent{strategy: strategy, info: info}) {
+			s.swapped(module, current.info, info)
+			return true
+		}
+	}
+}
+
+// swapped publishes info when it names another strategy than previous
+func (s *strategySlot) swapped(module *BaseModule, previous, info ActiveStrategy) {
+	if info.Strategy != "" && !reflect.DeepEqual(info, previous) {
+		module.publishIfConnected(ActiveStrategyTopic, info)
 	}
 }
 
+// configure creates the registered strategy identifier with params and swaps it in, the strategy is kept when
+// that fails
+func (s *strategySlot) configure(module *BaseModule, identifier string, params map[string]interface{}) error {
+	strategy, err := Strategies.CreateWithParams(s.kind, identifier, params)
+	if err != nil {
+		module.publishIfConnected(StrategyErrorTopic, err.Error())
+		return err
+	}
+	name, redacted, _ := Strategies.DefaultRegistry.Describe(s.kind, identifier, params)
+	info := ActiveStrategy{Kind: s.kind, Strategy: name, Params: redacted}
+	s.set(module, strategy, info)
+	module.publishIfConnected(ActiveStrategyTopic, info)
+	return nil
+}
+
 type CompressorModule struct {
 	*BaseModule
 	specialValue interface{}
-	compressor   func(interface{}) (interface{}, error)
+	compressor   strategySlot
+	processing   processor
 }
 
 func (cm *CompressorModule) Execute() (interface{}, error) {
-	if cm.compressor == nil {
-		return nil, errors.New("execute wasn't set correctly")
-	}
-	return cm.compressor(cm.specialValue)
+	return cm.compressor.execute(cm.specialValue)
+}
+
+// SetStrategy sets the compressor, a CompressorStrategies.CompressorFunc or any other Strategies.Strategy
+func (cm *CompressorModule) SetStrategy(strategy Strategies.Strategy) {
+	cm.compressor.set(cm.BaseModule, strategy, ActiveStrategy{Kind: Strategies.KindCompressor})
+}
+
+// ConfigureStrategy replaces the compressor with the registered compressor identifier created with params and
+// publishes it on ActiveStrategyTopic, the compressor is kept when the parameters aren't valid
+func (cm *CompressorModule) ConfigureStrategy(identifier string, params map[string]interface{}) error {
+	return cm.compressor.configure(cm.BaseModule, identifier, params)
+}
+
+func (cm *CompressorModule) ActiveStrategy() ActiveStrategy {
+	_, info := cm.compressor.load()
+	return info
 }
 
-func (cm *CompressorModule) SetStrategy(strategy CompressorStrategies.CompressorFunc) {
-	cm.compressor = strategy
+// SwapStrategy atomically replaces the compressor and returns the compressor it replaced, info describes the new
+// compressor and is published on ActiveStrategyTopic when it names another strategy than before
+func (cm *CompressorModule) SwapStrategy(strategy Strategies.Strategy, info ActiveStrategy) (Strategies.Strategy, ActiveStrategy) {
+	info.Kind = Strategies.KindCompressor
+	return cm.compressor.swap(cm.BaseModule, strategy, info)
+}
+
+// CompareAndSwapStrategy replaces the compressor like SwapStrategy, but only while the compressor is still old. It
+// reports whether it replaced it, a compressor set in the meantime is kept.
+func (cm *CompressorModule) CompareAndSwapStrategy(old, strategy Strategies.Strategy, info ActiveStrategy) bool {
+	info.Kind = Strategies.KindCompressor
+	return cm.compressor.compareAndSwap(cm.BaseModule, old, strategy, info)
 }
 
 func NewCompressorModule(id string, controller IMediator, specialValue interface{}) *CompressorModule {
-	return &CompressorModule{
+	module := &CompressorModule{
 		BaseModule:   NewModule(id, controller),
 		specialValue: specialValue,
+		compressor:   strategySlot{kind: Strategies.KindCompressor},
 	}
+	module.SetOwner(module)
+	return module
 }
 
 type DispenserModule struct {
 	*BaseModule
 	specialValue interface{}
-	dispenser    Strategies.Strategy
+	dispenser    strategySlot
+	processing   processor
 }
 
 func (dm *DispenserModule) Execute() (interface{}, error) {
-	if dm.dispenser == nil {
-		return nil, errors.New("execute wasn't set correctly")
-	}
-	return dm.dispenser.Execute(dm.specialValue)
+	return dm.dispenser.execute(dm.specialValue)
 }
 
 func (dm *DispenserModule) SetStrategy(strategy Strategies.Strategy) {
-	dm.dispenser = strategy
+	dm.dispenser.set(dm.BaseModule, strategy, ActiveStrategy{Kind: Strategies.KindDispenser})
+}
+
+// ConfigureStrategy replaces the dispenser with the registered dispenser identifier created with params and
+// publishes it on ActiveStrategyTopic, the dispenser is kept when the parameters aren't valid
+func (dm *DispenserModule) ConfigureStrategy(identifier string, params map[string]interface{}) error {
+	return dm.dispenser.configure(dm.BaseModule, identifier, params)
+}
+
+func (dm *DispenserModule) ActiveStrategy() ActiveStrategy {
+	_, info := dm.dispenser.load()
+	return info
+}
+
+// SwapStrategy atomically replaces the dispenser and returns the dispenser it replaced, like
+// CompressorModule.SwapStrategy
+func (dm *DispenserModule) SwapStrategy(strategy Strategies.Strategy, info ActiveStrategy) (Strategies.Strategy, ActiveStrategy) {
+	info.Kind = Strategies.KindDispenser
+	return dm.dispenser.swap(dm.BaseModule, strategy, info)
+}
+
+// CompareAndSwapStrategy replaces the dispenser only while it is still old, like
+// CompressorModule.CompareAndSwapStrategy
+func (dm *DispenserModule) CompareAndSwapStrategy(old, strategy Strategies.Strategy, info ActiveStrategy) bool {
+	info.Kind = Strategies.KindDispenser
+	return dm.dispenser.compareAndSwap(dm.BaseModule, old, strategy, info)
 }
 
 func NewDispenserModule(id string, controller IMediator, specialValue interface{}) *DispenserModule {
-	return &DispenserModule{
+	module := &DispenserModule{
 		BaseModule:   NewModule(id, controller),
 		specialValue: specialValue,
+		dispenser:    strategySlot{kind: Strategies.KindDispenser},
 	}
+	module.SetOwner(module)
+	return module
 }
 
 // IModuleFactory interface
 type IModuleFactory interface {
 	CreateModule(id string, controller IMediator) *BaseModule
+	CreateModuleWithDataSource(id string, controller IMediator, source DataSources.DataSource) *BaseModule
 	CreateCompressorModule(id string, controller IMediator, specialValue interface{}) *CompressorModule
 	CreateDispenserModule(id string, controller IMediator, specialValue interface{}) *DispenserModule
 }
@@ -224,6 +657,10 @@ func (f *DefaultModuleFactory) CreateModule(id string, controller IMediator) *Ba
 	return NewModule(id, controller)
 }
 
+func (f *DefaultModuleFactory) CreateModuleWithDataSource(id string, controller IMediator, source DataSources.DataSource) *BaseModule {
+	return NewModuleWithDataSource(id, controller, source)
+}
+
 func (f *DefaultModuleFactory) CreateCompressorModule(id string, controller IMediator, specialValue interface{}) *CompressorModule {
 	return NewCompressorModule(id, controller, specialValue)
 }
@@ -0,0 +1,243 @@
+package TestDesign
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+/*
+This file contains the stream-processing mode of CompressorModule and DispenserModule. A module in this mode
+subscribes to an input topic, runs every value it receives through its strategy and publishes the result on its
+output topic. A value the strategy can't process is reported as a ProcessingError on the error topic instead, so
+a bad value never stops the stream.
+
+ExecuteCommand runs Execute on the special value of a module and publishes the result the same way.
+
+The values are processed on a worker of the controller, but their results are published from an outbox with its own
+goroutine. A worker that sends a command blocks while the command queue is full, so workers that publish results
+themselves can block each other until nothing drains the queue anymore. The outbox holds at most maxPending results,
+it drops the results that don't fit and reports how many on the error topic. Stopping the processing discards the
+results that weren't published yet.
+*/
+
+const (
+	// ProcessedTopic is the default output topic
+	ProcessedTopic = "processed"
+	// ProcessingErrorTopic is the default error topic
+	ProcessingErrorTopic = "processingError"
+)
+
+// ProcessingErrors is ProcessingErrorTopic as a typed topic
+var ProcessingErrors = NewTopic[ProcessingError](ProcessingErrorTopic)
+
+type ProcessingConfig struct {
+	// InputPublisher and InputTopic are the topic the module processes the values of
+	InputPublisher string
+	InputTopic     string
+	// OutputTopic defaults to ProcessedTopic and ErrorTopic to ProcessingErrorTopic
+	OutputTopic string
+	ErrorTopic  string
+}
+
+// ProcessingError is published on the error topic for every value that couldn't be processed
+type ProcessingError struct {
+	// Topic is the topic the value was received on, empty for an ExecuteCommand
+	Topic string
+	Error string
+}
+
+// processor is the stream-processing mode of a module, run processes a value with the strategy of the module
+type processor struct {
+	config ProcessingConfig
+	active bool
+	outbox outbox
+	mu     sync.Mutex
+}
+
+type publication struct {
+	topic string
+	value interface{}
+}
+
+// maxPending is the number of results an outbox holds, results posted while it is full are dropped and reported
+// on the error topic once it drained
+const maxPending = 1000
+
+// outbox publishes the results of a module in order from its own goroutine, which runs while results are pending
+type outbox struct {
+	pending  []publication
+	draining bool
+	// dropped is the number of results dropped since the last report, which goes to droppedTopic
+	dropped      int
+	droppedTopic string
+	// generation changes when the pending results are discarded, a drain goroutine of an earlier generation stops
+	// and results posted for it are dropped
+	generation uint64
+	mu         sync.Mutex
+}
+
+// current returns the generation results are posted for
+func (o *outbox) current() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.generation
+}
+
+func (o *outbox) post(module *BaseModule, generation uint64, topic, errorTopic string, value interface{}) {
+	o.mu.Lock()
+	if generation != o.generation {
+		o.mu.Unlock()
+		return
+	}
+	if len(o.pending) >= maxPending {
+		o.dropped++
+		o.droppedTopic = errorTopic
+		o.mu.Unlock()
+		return
+	}
+	o.pending = append(o.pending, publication{topic: topic, value: value})
+	if o.draining {
+		o.mu.Unlock()
+		return
+	}
+	o.draining = true
+	o.mu.Unlock()
+	go o.drain(module, generation)
+}
+
+func (o *outbox) drain(module *BaseModule, generation uint64) {
+	for {
+		o.mu.Lock()
+		if generation != o.generation {
+			o.mu.Unlock()
+			return
+		}
+		batch, dropped, droppedTopic := o.pending, o.dropped, o.droppedTopic
+		o.pending, o.dropped = nil, 0
+		if len(batch) == 0 && dropped == 0 {
+			o.draining = false
+			o.mu.Unlock()
+			return
+		}
+		o.mu.Unlock()
+		for _, publication := range batch {
+			if o.current() != generation {
+				return
+			}
+			module.publishIfConnected(publication.topic, publication.value)
+		}
+		if dropped > 0 {
+			module.publishIfConnected(droppedTopic, ProcessingError{Error: fmt.Sprintf("dropped %d results, %d were waiting to be published", dropped, maxPending)})
+		}
+	}
+}
+
+// discard drops the pending results and stops the drain goroutine
+func (o *outbox) discard() {
+	o.mu.Lock()
+	o.generation++
+	o.pending, o.dropped, o.draining = nil, 0, false
+	o.mu.Unlock()
+}
+
+func (p *processor) start(module *BaseModule, config ProcessingConfig, run func(value interface{}) (interface{}, error)) error {
+	if config.InputPublisher == "" || config.InputTopic == "" {
+		return errors.New("processing needs an input publisher and topic")
+	}
+	if config.OutputTopic == "" {
+		config.OutputTopic = ProcessedTopic
+	}
+	if config.ErrorTopic == "" {
+		config.ErrorTopic = ProcessingErrorTopic
+	}
+	if config.InputPublisher == module.id && (config.InputTopic == config.OutputTopic || config.InputTopic == config.ErrorTopic) {
+		return errors.New("processing can't take its input from its own output")
+	}
+
+	p.mu.Lock()
+	if p.active {
+		p.mu.Unlock()
+		return errors.New("module is already processing, stop it first")
+	}
+	p.config, p.active = config, true
+	p.mu.Unlock()
+
+	// Only the values of the input publisher are processed, the same topic of other publishers still goes to the
+	// NotificationCallback
+	generation := p.outbox.current()
+	module.setTopicHandler(config.InputPublisher, config.InputTopic, func(value interface{}) bool {
+		p.publish(module, generation, config.InputTopic, run, value)
+		return true
+	})
+	module.SubscribeToTopic(config.InputTopic, config.InputPublisher)
+	return nil
+}
+
+// stop unsubscribes from the input and discards the results that weren't published yet
+func (p *processor) stop(module *BaseModule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return
+	}
+	module.UnsubscribeFromTopic(p.config.InputTopic, p.config.InputPublisher)
+	module.setTopicHandler(p.config.InputPublisher, p.config.InputTopic, nil)
+	p.outbox.discard()
+	p.active = false
+}
+
+// topics returns the output and error topic, the defaults when the module isn't processing
+func (p *processor) topics() (string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return ProcessedTopic, ProcessingErrorTopic
+	}
+	return p.config.OutputTopic, p.config.ErrorTopic
+}
+
+// publish runs value through run and posts the result or the error to the outbox for generation
+func (p *processor) publish(module *BaseModule, generation uint64, topic string, run func(value interface{}) (interface{}, error), value interface{}) {
+	output, errorTopic := p.topics()
+	result, err := run(value)
+	if err != nil {
+		p.outbox.post(module, generation, errorTopic, errorTopic, ProcessingError{Topic: topic, Error: err.Error()})
+		return
+	}
+	p.outbox.post(module, generation, output, errorTopic, result)
+}
+
+// executor is implemented by the modules an ExecuteCommand can run
+type executor interface {
+	executeAndPublish()
+}
+
+// streamProcessor is implemented by the modules that can process a stream, unregistering one stops the processing
+type streamProcessor interface {
+	StopProcessing()
+}
+
+func (cm *CompressorModule) StartProcessing(config ProcessingConfig) error {
+	return cm.processing.start(cm.BaseModule, config, cm.compressor.execute)
+}
+
+func (cm *CompressorModule) StopProcessing() {
+	cm.processing.stop(cm.BaseModule)
+}
+
+func (cm *CompressorModule) executeAndPublish() {
+	cm.processing.publish(cm.BaseModule, cm.processing.outbox.current(), "", cm.compressor.execute, cm.specialValue)
+}
+
+func (dm *DispenserModule) StartProcessing(config ProcessingConfig) error {
+	return dm.processing.start(dm.BaseModule, config, dm.dispenser.execute)
+}
+
+func (dm *DispenserModule) StopProcessing() {
+	dm.processing.stop(dm.BaseModule)
+}
+
+func (dm *DispenserModule) executeAndPublish() {
+	dm.processing.publish(dm.BaseModule, dm.processing.outbox.current(), "", dm.dispenser.execute, dm.specialValue)
+}
@@ -0,0 +1,101 @@
+package TestDesign
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingMediator records the published values, the first publication blocks until release is closed
+type blockingMediator struct {
+	IMediator
+	entered   chan struct{}
+	release   chan struct{}
+	published []*PublishValueCommand
+	mu        sync.Mutex
+}
+
+func newBlockingMediator() *blockingMediator {
+	return &blockingMediator{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (b *blockingMediator) SendCommand(command ICommand, targetID string) {
+	publish, ok := command.(*PublishValueCommand)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	b.published = append(b.published, publish)
+	first := len(b.published) == 1
+	b.mu.Unlock()
+	if first {
+		close(b.entered)
+		<-b.release
+	}
+}
+
+func (b *blockingMediator) publications() []*PublishValueCommand {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*PublishValueCommand(nil), b.published...)
+}
+
+type strategyFunc func(value interface{}) (interface{}, error)
+
+func (f strategyFunc) Execute(value interface{}) (interface{}, error) {
+	return f(value)
+}
+
+func identity(value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+func TestOutboxDropsResultsBeyondItsCapacity(t *testing.T) {
+	mediator := newBlockingMediator()
+	module := NewCompressorModule("compressor", mediator, nil)
+	var p processor
+	p.publish(module.BaseModule, 0, "", identity, -1)
+	<-mediator.entered
+	const posted = maxPending + 500
+	for i := 0; i < posted; i++ {
+		p.publish(module.BaseModule, 0, "", identity, i)
+	}
+	close(mediator.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mediator.publications()) < maxPending+2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	published := mediator.publications()
+	if len(published) != maxPending+2 {
+		t.Fatalf("published %d values, expected %d results and the report of the dropped ones", len(published), maxPending+1)
+	}
+	report, ok := published[len(published)-1].value.(ProcessingError)
+	if !ok || published[len(published)-1].topic != ProcessingErrorTopic || !strings.Contains(report.Error, "dropped 500 results") {
+		t.Fatalf("published %v on %s, expected the dropped results to be reported", published[len(published)-1].value, published[len(published)-1].topic)
+	}
+}
+
+func TestStopProcessingDiscardsPendingResults(t *testing.T) {
+	mediator := newBlockingMediator()
+	module := NewCompressorModule("compressor", mediator, nil)
+	module.SetStrategy(strategyFunc(identity))
+	if err := module.StartProcessing(ProcessingConfig{InputPublisher: "sensor", InputTopic: "temperature"}); err != nil {
+		t.Fatal(err)
+	}
+	module.NotifySubscriberFrom("sensor", "temperature", 1)
+	<-mediator.entered
+	for i := 2; i <= 10; i++ {
+		module.NotifySubscriberFrom("sensor", "temperature", i)
+	}
+	module.StopProcessing()
+	close(mediator.release)
+	// A value still on its way when the processing stopped isn't processed either
+	module.NotifySubscriberFrom("sensor", "temperature", 11)
+
+	time.Sleep(50 * time.Millisecond)
+	if published := mediator.publications(); len(published) != 1 {
+		t.Fatalf("published %d values after the processing stopped, expected only the one that was publishing", len(published))
+	}
+}
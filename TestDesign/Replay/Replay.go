@@ -0,0 +1,322 @@
+package Replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Journal"
+	"mcs/TestDesign/Timing"
+	"sync"
+	"time"
+)
+
+/*
+This package replays a journal written by the Journal package to reproduce what happened on site. The Engine
+re-drives the recorded registrations, state changes, subscriptions and publishes into a fresh MasterController that
+runs on a virtual clock set to the recorded times, and compares the notifications of the replay with the recorded
+ones.
+
+A recorded notification belongs to the step of the publish it came from. Notifications without a recorded publish,
+such as the heartbeat lost notifications of the watchdog, are replayed by notifying the subscribers directly.
+Every notification that is recorded but not replayed, or replayed but not recorded, is reported as a divergence.
+*/
+
+type Options struct {
+	// Speed scales the time between entries: 1 replays in real time, 10 ten times faster. Zero doesn't wait at all.
+	Speed float64
+	// Clock waits between the steps of Run, nil uses the real clock
+	Clock Timing.Clock
+	// NewModule creates the module with id for the replay. Nil creates a BaseModule without data source and with a
+	// silent notification callback.
+	NewModule func(id string, mc *TestDesign.MasterController) interface{}
+}
+
+type Notification struct {
+	PublisherID  string
+	SubscriberID string
+	Topic        string
+	Value        json.RawMessage
+}
+
+func (n Notification) String() string {
+	return fmt.Sprintf("%s -> %s %s = %s", n.PublisherID, n.SubscriberID, n.Topic, string(n.Value))
+}
+
+// key identifies equal notifications, values are compared in their canonical JSON form
+func (n Notification) key() string {
+	return n.PublisherID + "|" + n.SubscriberID + "|" + n.Topic + "|" + canonical(n.Value)
+}
+
+// Step is a journal entry that drives the replay together with the notifications it should cause
+type Step struct {
+	Entry       Journal.Entry
+	Expected    []Notification
+	Observed    []Notification
+	Divergences []Divergence
+}
+
+type Engine struct {
+	options  Options
+	clock    *Timing.VirtualClock
+	mc       *TestDesign.MasterController
+	steps    []*Step
+	next     int
+	report   Report
+	observed []Notification
+	mu       sync.Mutex
+}
+
+// New prepares the replay of entries. Modules that are used before the journal registers them are registered
+// before the first step.
+func New(entries []Journal.Entry, options Options) (*Engine, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("journal is empty")
+	}
+	if options.Clock == nil {
+		options.Clock = Timing.RealClock{}
+	}
+	if options.NewModule == nil {
+		options.NewModule = newSilentModule
+	}
+
+	e := &Engine{options: options, clock: Timing.NewVirtualClock(entries[0].Time)}
+	e.mc = TestDesign.NewMasterControllerWithClock(e.clock)
+	// The recorded heartbeat losses are replayed from the journal, the watchdog of the replay would only interfere
+	e.mc.GetWatchdog().Stop()
+	e.mc.AddEventListener(e.record)
+
+	for _, id := range unregisteredModules(entries) {
+		if err := e.mc.RegisterModule(options.NewModule(id, e.mc)); err != nil {
+			return nil, fmt.Errorf("error registering module %s: %w", id, err)
+		}
+	}
+	e.steps = plan(entries)
+	return e, nil
+}
+
+// Controller returns the controller the journal is replayed into
+func (e *Engine) Controller() *TestDesign.MasterController {
+	return e.mc
+}
+
+// Remaining returns the number of steps that haven't been replayed yet
+func (e *Engine) Remaining() int {
+	return len(e.steps) - e.next
+}
+
+// Peek returns the step Next replays, it reports false when the replay is done
+func (e *Engine) Peek() (Step, bool) {
+	if e.next >= len(e.steps) {
+		return Step{}, false
+	}
+	return *e.steps[e.next], true
+}
+
+// Next replays a single step and waits until the controller is idle. It reports false when the replay is done.
+func (e *Engine) Next() (Step, bool) {
+	if e.next >= len(e.steps) {
+		return Step{}, false
+	}
+	step := e.steps[e.next]
+	e.next++
+
+	e.clock.Set(step.Entry.Time)
+	if err := e.apply(step.Entry); err != nil {
+		step.Divergences = append(step.Divergences, Divergence{Seq: step.Entry.Seq, Time: step.Entry.Time, Kind: DivergenceError, Detail: err.Error()})
+	}
+	e.mc.WaitIdle()
+
+	e.mu.Lock()
+	step.Observed = e.observed
+	e.observed = nil
+	e.mu.Unlock()
+
+	step.Divergences = append(step.Divergences, compare(step)...)
+	e.report.Steps++
+	e.report.Divergences = append(e.report.Divergences, step.Divergences...)
+	return *step, true
+}
+
+// Run replays the remaining steps, waiting between them according to Options.Speed
+func (e *Engine) Run() Report {
+	var previous time.Time
+	for {
+		step, ok := e.Peek()
+		if !ok {
+			break
+		}
+		if e.options.Speed > 0 && !previous.IsZero() {
+			if wait := time.Duration(float64(step.Entry.Time.Sub(previous)) / e.options.Speed); wait > 0 {
+				e.options.Clock.Sleep(wait)
+			}
+		}
+		previous = step.Entry.Time
+		e.Next()
+	}
+	return e.Report()
+}
+
+// Report returns the result of the steps replayed so far
+func (e *Engine) Report() Report {
+	report := e.report
+	report.Divergences = append([]Divergence(nil), e.report.Divergences...)
+	report.Remaining = e.Remaining()
+	return report
+}
+
+func (e *Engine) record(event TestDesign.Event) {
+	if event.Type != TestDesign.EventNotified {
+		return
+	}
+	notification := Notification{
+		PublisherID:  event.PublisherID,
+		SubscriberID: event.SubscriberID,
+		Topic:        event.Topic,
+		Value:        Journal.EncodeValue(event.Value),
+	}
+	e.mu.Lock()
+	e.observed = append(e.observed, notification)
+	e.mu.Unlock()
+}
+
+func (e *Engine) apply(entry Journal.Entry) error {
+	switch entry.Type {
+	case Journal.EntryRegister:
+		if err := e.mc.RegisterModule(e.options.NewModule(entry.ModuleID, e.mc)); err != nil {
+			return err
+		}
+		// A module can be registered in any state, such as a module that was already running
+		if entry.State == "" {
+			return nil
+		}
+		state, err := TestDesign.ParseState(entry.State)
+		if err != nil {
+			return err
+		}
+		e.mc.GetModule(entry.ModuleID).SetState(state)
+	case Journal.EntryUnregister:
+		return e.mc.UnregisterModule(entry.ModuleID)
+	case Journal.EntryStateChange:
+		state, err := TestDesign.ParseState(entry.State)
+		if err != nil {
+			return err
+		}
+		module := e.mc.GetModule(entry.ModuleID)
+		if module == nil {
+			return fmt.Errorf("module %s isn't registered", entry.ModuleID)
+		}
+		module.SetState(state)
+	case Journal.EntrySubscribe:
+		e.mc.SendCommand(TestDesign.NewSubscribeCommand(entry.SubscriberID, entry.PublisherID, entry.Topic), entry.PublisherID)
+	case Journal.EntryUnsubscribe:
+		e.mc.SendCommand(TestDesign.NewUnsubscribeCommand(entry.SubscriberID, entry.PublisherID, entry.Topic), entry.PublisherID)
+	case Journal.EntryPublish:
+		value, err := entry.DecodeValue()
+		if err != nil {
+			return err
+		}
+		e.mc.SendCommand(TestDesign.NewPublishValueCommand(entry.PublisherID, entry.Topic, value), entry.PublisherID)
+	case Journal.EntryNotify:
+		value, err := entry.DecodeValue()
+		if err != nil {
+			return err
+		}
+		e.mc.NotifySubscribers(entry.PublisherID, entry.Topic, value)
+	default:
+		return fmt.Errorf("can't replay entry type %q", entry.Type)
+	}
+	return nil
+}
+
+func newSilentModule(id string, mc *TestDesign.MasterController) interface{} {
+	module := TestDesign.NewModuleWithDataSource(id, mc, nil)
+	module.SetNotificationCallback(func(string, interface{}) {})
+	return module
+}
+
+// unregisteredModules returns the modules that are used by entries before they are registered, in order of use
+func unregisteredModules(entries []Journal.Entry) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	use := func(id string) {
+		if id == "" || id == TestDesign.WatchdogID || seen[id] {
+			return
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	for _, entry := range entries {
+		if entry.Type == Journal.EntryRegister && !seen[entry.ModuleID] {
+			seen[entry.ModuleID] = true
+			continue
+		}
+		use(entry.ModuleID)
+		use(entry.PublisherID)
+		use(entry.SubscriberID)
+	}
+	return ids
+}
+
+// plan turns the entries into steps. A notification is added to the earliest publish of the same value on the
+// same topic that hasn't notified the subscriber yet, entries are journaled concurrently so it doesn't have to
+// follow the publish directly. Strategy switches and executions aren't replayed: the modules of a replay hold no
+// strategy, and the secret parameters of a switch aren't in the journal.
+func plan(entries []Journal.Entry) []*Step {
+	var steps []*Step
+	sources := make(map[string][]*Step)
+	for _, entry := range entries {
+		switch entry.Type {
+		case Journal.EntryNotify:
+			notification := Notification{PublisherID: entry.PublisherID, SubscriberID: entry.SubscriberID, Topic: entry.Topic, Value: entry.Value}
+			key := entry.PublisherID + "|" + entry.Topic + "|" + canonical(entry.Value)
+			if source := firstWithout(sources[key], notification.SubscriberID); source != nil {
+				source.Expected = append(source.Expected, notification)
+				continue
+			}
+			step := &Step{Entry: entry, Expected: []Notification{notification}}
+			sources[key] = append(sources[key], step)
+			steps = append(steps, step)
+		case Journal.EntryPublish:
+			step := &Step{Entry: entry}
+			key := entry.PublisherID + "|" + entry.Topic + "|" + canonical(entry.Value)
+			sources[key] = append(sources[key], step)
+			steps = append(steps, step)
+		case Journal.EntryRegister, Journal.EntryUnregister, Journal.EntryStateChange, Journal.EntrySubscribe, Journal.EntryUnsubscribe:
+			steps = append(steps, &Step{Entry: entry})
+		}
+	}
+	return steps
+}
+
+func firstWithout(steps []*Step, subscriberID string) *Step {
+	for _, step := range steps {
+		notified := false
+		for _, notification := range step.Expected {
+			if notification.SubscriberID == subscriberID {
+				notified = true
+				break
+			}
+		}
+		if !notified {
+			return step
+		}
+	}
+	return nil
+}
+
+// canonical returns value re-encoded by encoding/json, so equal values compare equal regardless of key order
+func canonical(value json.RawMessage) string {
+	if len(value) == 0 {
+		return "null"
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return string(value)
+	}
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		return string(value)
+	}
+	return string(data)
+}
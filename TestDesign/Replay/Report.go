@@ -0,0 +1,81 @@
+package Replay
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+type DivergenceKind string
+
+const (
+	// DivergenceMissing is a recorded notification the replay didn't deliver
+	DivergenceMissing DivergenceKind = "missing"
+	// DivergenceUnexpected is a notification the replay delivered that wasn't recorded
+	DivergenceUnexpected DivergenceKind = "unexpected"
+	// DivergenceError is an entry that couldn't be replayed
+	DivergenceError DivergenceKind = "error"
+)
+
+type Divergence struct {
+	// Seq is the sequence number of the journal entry of the step
+	Seq          uint64
+	Time         time.Time
+	Kind         DivergenceKind
+	Notification Notification
+	Detail       string
+}
+
+func (d Divergence) String() string {
+	if d.Kind == DivergenceError {
+		return fmt.Sprintf("#%d %s: %s", d.Seq, d.Kind, d.Detail)
+	}
+	return fmt.Sprintf("#%d %s notification %s", d.Seq, d.Kind, d.Notification)
+}
+
+type Report struct {
+	Steps       int
+	Remaining   int
+	Divergences []Divergence
+}
+
+func (r Report) Passed() bool {
+	return len(r.Divergences) == 0
+}
+
+func (r Report) Write(w io.Writer) {
+	for _, divergence := range r.Divergences {
+		fmt.Fprintf(w, "  %s %s\n", divergence.Time.Format(time.RFC3339Nano), divergence)
+	}
+	status := "PASS"
+	if !r.Passed() {
+		status = "FAIL"
+	}
+	fmt.Fprintf(w, "%s %d steps replayed, %d divergences\n", status, r.Steps, len(r.Divergences))
+	if r.Remaining > 0 {
+		fmt.Fprintf(w, "  %d steps not replayed\n", r.Remaining)
+	}
+}
+
+// compare returns a divergence for every notification that is only expected or only observed by step
+func compare(step *Step) []Divergence {
+	observed := make(map[string]int)
+	for _, notification := range step.Observed {
+		observed[notification.key()]++
+	}
+	var divergences []Divergence
+	for _, notification := range step.Expected {
+		if observed[notification.key()] > 0 {
+			observed[notification.key()]--
+			continue
+		}
+		divergences = append(divergences, Divergence{Seq: step.Entry.Seq, Time: step.Entry.Time, Kind: DivergenceMissing, Notification: notification})
+	}
+	for _, notification := range step.Observed {
+		if observed[notification.key()] > 0 {
+			observed[notification.key()]--
+			divergences = append(divergences, Divergence{Seq: step.Entry.Seq, Time: step.Entry.Time, Kind: DivergenceUnexpected, Notification: notification})
+		}
+	}
+	return divergences
+}
@@ -0,0 +1,258 @@
+package Rollout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Strategies"
+	"mcs/TestDesign/Timing"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+This file contains the rollout mode. A Rollout promotes a candidate strategy across a group of modules in stages:
+every stage makes the candidate the active strategy of some more modules and lets them soak for a while. The
+promoted modules keep running the strategy the candidate replaced in its shadow, so the stats of a promoted module
+describe the candidate from the other side: ActiveErrors are the candidate's errors and Mismatches are the inputs
+on which it disagreed with the strategy it replaced. When the error or mismatch rate of the promoted modules crosses
+its threshold, every promoted module gets its previous strategy back.
+*/
+
+type Options struct {
+	// Stages are the number of modules each stage promotes, modules left after the last stage are promoted by a
+	// final stage. Empty promotes one module first and the rest after it.
+	Stages []int
+	// Soak is how long each stage runs before the next one starts, 0 is a minute
+	Soak time.Duration
+	// CheckEvery is how often the thresholds are checked while a stage soaks, 0 is a tenth of Soak
+	CheckEvery time.Duration
+	// MaxErrorRate and MaxMismatchRate are the highest error and mismatch rate of the candidate that are accepted
+	MaxErrorRate    float64
+	MaxMismatchRate float64
+	// MinInputs is the number of inputs the promoted modules need before the thresholds are checked, a stage that
+	// soaked without them fails, 0 is 1 so a candidate is never promoted without any evidence
+	MinInputs int
+	// Compare is the CompareFunc of the shadows, nil is Equal
+	Compare CompareFunc
+	// Clock paces the stages, nil is Timing.RealClock
+	Clock Timing.Clock
+}
+
+type StageReport struct {
+	Modules []string
+	// Stats are the stats of every promoted module at the end of the stage
+	Stats  ShadowStats
+	Passed bool
+}
+
+type Report struct {
+	Strategy   string
+	Stages     []StageReport
+	Promoted   []string
+	RolledBack bool
+	// Reason is why the rollout was rolled back
+	Reason string
+}
+
+// ErrorRate is the share of the inputs the candidate failed on in a rollout
+func (s StageReport) ErrorRate() float64 {
+	if s.Stats.Inputs == 0 {
+		return 0
+	}
+	return float64(s.Stats.ActiveErrors) / float64(s.Stats.Inputs)
+}
+
+func (r Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "rollout of %s\n", r.Strategy)
+	for i, stage := range r.Stages {
+		result := "passed"
+		if !stage.Passed {
+			result = "failed"
+		}
+		fmt.Fprintf(w, "  stage %d %s: %s, %d inputs, error rate %.3f, mismatch rate %.3f\n", i+1, result,
+			strings.Join(stage.Modules, ","), stage.Stats.Inputs, stage.ErrorRate(), stage.Stats.MismatchRate())
+	}
+	if r.RolledBack {
+		fmt.Fprintf(w, "  rolled back: %s\n", r.Reason)
+	} else {
+		fmt.Fprintf(w, "  promoted on %s\n", strings.Join(r.Promoted, ","))
+	}
+}
+
+var ErrAborted = errors.New("rollout aborted")
+
+type Rollout struct {
+	targets    []Target
+	candidates []Strategies.Strategy
+	info       TestDesign.ActiveStrategy
+	options    Options
+	abort      chan struct{}
+	abortOnce  sync.Once
+}
+
+// New creates the registered strategy identifier with params for every target, each gets its own instance since
+// strategies such as the adaptive compressor keep state. Every target must hold a strategy of the same kind.
+func New(targets []Target, identifier string, params map[string]interface{}, options Options) (*Rollout, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("rollout has no modules")
+	}
+	kind := targets[0].ActiveStrategy().Kind
+	rollout := &Rollout{targets: targets, options: options, abort: make(chan struct{})}
+	for _, target := range targets {
+		if target.ActiveStrategy().Kind != kind {
+			return nil, fmt.Errorf("module %s holds a %s, expected a %s", target.GetId(), target.ActiveStrategy().Kind, kind)
+		}
+		candidate, err := Strategies.CreateWithParams(kind, identifier, params)
+		if err != nil {
+			return nil, err
+		}
+		rollout.candidates = append(rollout.candidates, candidate)
+	}
+	name, redacted, err := Strategies.DefaultRegistry.Describe(kind, identifier, params)
+	if err != nil {
+		return nil, err
+	}
+	rollout.info = TestDesign.ActiveStrategy{Kind: kind, Strategy: name, Params: redacted}
+
+	if rollout.options.Soak <= 0 {
+		rollout.options.Soak = time.Minute
+	}
+	if rollout.options.CheckEvery <= 0 {
+		rollout.options.CheckEvery = rollout.options.Soak / 10
+	}
+	if rollout.options.MinInputs <= 0 {
+		rollout.options.MinInputs = 1
+	}
+	if rollout.options.Clock == nil {
+		rollout.options.Clock = Timing.RealClock{}
+	}
+	return rollout, nil
+}
+
+// stages splits the targets into the stages of the options
+func (r *Rollout) stages() [][]int {
+	sizes := r.options.Stages
+	if len(sizes) == 0 {
+		sizes = []int{1}
+	}
+	var stages [][]int
+	next := 0
+	for _, size := range sizes {
+		if size <= 0 || next == len(r.targets) {
+			continue
+		}
+		var stage []int
+		for ; size > 0 && next < len(r.targets); size-- {
+			stage = append(stage, next)
+			next++
+		}
+		stages = append(stages, stage)
+	}
+	if next < len(r.targets) {
+		var stage []int
+		for ; next < len(r.targets); next++ {
+			stage = append(stage, next)
+		}
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+// Run promotes the candidate stage by stage and blocks until every module runs it or the rollout was rolled back.
+// A rollout that was rolled back because of its thresholds returns its report without an error.
+func (r *Rollout) Run() (Report, error) {
+	report := Report{Strategy: r.info.Strategy}
+	var shadows []*Shadow
+	rollback := func(reason string) {
+		for _, shadow := range shadows {
+			shadow.Stop()
+		}
+		report.Promoted = nil
+		report.RolledBack, report.Reason = true, reason
+	}
+
+	for _, stage := range r.stages() {
+		stageReport := StageReport{}
+		for _, i := range stage {
+			info := r.info
+			shadow, err := installShadow(r.targets[i], r.candidates[i], r.options.Compare, &info)
+			if err != nil {
+				rollback(err.Error())
+				report.Stages = append(report.Stages, stageReport)
+				return report, err
+			}
+			shadows = append(shadows, shadow)
+			stageReport.Modules = append(stageReport.Modules, r.targets[i].GetId())
+			report.Promoted = append(report.Promoted, r.targets[i].GetId())
+		}
+
+		reason, err := r.soak(shadows, &stageReport.Stats)
+		stageReport.Passed = reason == "" && err == nil
+		report.Stages = append(report.Stages, stageReport)
+		if err != nil {
+			rollback(err.Error())
+			return report, err
+		}
+		if reason != "" {
+			rollback(reason)
+			return report, nil
+		}
+	}
+
+	for _, shadow := range shadows {
+		shadow.commit(r.info)
+	}
+	return report, nil
+}
+
+// soak lets the promoted modules run for the soak time and returns why they failed, if they did
+func (r *Rollout) soak(shadows []*Shadow, stats *ShadowStats) (string, error) {
+	clock := r.options.Clock
+	begin := clock.Now()
+	for {
+		wait := r.options.CheckEvery
+		if left := r.options.Soak - clock.Since(begin); left < wait {
+			wait = left
+		}
+		select {
+		case <-r.abort:
+			return "", ErrAborted
+		case <-clock.After(wait):
+		}
+
+		*stats = ShadowStats{}
+		for _, shadow := range shadows {
+			stats.add(shadow.Stats())
+		}
+		done := clock.Since(begin) >= r.options.Soak
+		if stats.Inputs < r.options.MinInputs {
+			if done {
+				return fmt.Sprintf("%d inputs after %v, expected %d", stats.Inputs, r.options.Soak, r.options.MinInputs), nil
+			}
+		} else if reason := r.check(*stats); reason != "" {
+			return reason, nil
+		}
+		if done {
+			return "", nil
+		}
+	}
+}
+
+func (r *Rollout) check(stats ShadowStats) string {
+	errorRate := StageReport{Stats: stats}.ErrorRate()
+	if errorRate > r.options.MaxErrorRate {
+		return fmt.Sprintf("error rate %.3f exceeds %.3f", errorRate, r.options.MaxErrorRate)
+	}
+	if mismatchRate := stats.MismatchRate(); mismatchRate > r.options.MaxMismatchRate {
+		return fmt.Sprintf("mismatch rate %.3f exceeds %.3f", mismatchRate, r.options.MaxMismatchRate)
+	}
+	return ""
+}
+
+// Abort rolls a running rollout back, Run returns ErrAborted
+func (r *Rollout) Abort() {
+	r.abortOnce.Do(func() { close(r.abort) })
+}
@@ -0,0 +1,306 @@
+package Rollout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Strategies"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+This package switches the strategy of CompressorModules and DispenserModules without risking a production line.
+
+In shadow mode a candidate strategy runs next to the active strategy of a module on the same inputs. The module
+keeps using the output of the active strategy, the candidate runs in the background and its output is only
+compared with it, and the mismatches, latencies and errors of both are recorded in ShadowStats. A candidate that
+panics is counted as failing, and inputs that arrive while the candidate is still busy with maxShadowed earlier
+ones aren't compared, so the candidate never slows down or breaks the module. The result of the active strategy is
+recorded for every input.
+
+Stopping a shadow gives the module back the strategy it had only while the module still runs the shadow, a strategy
+set in the meantime, such as by a SetStrategyCommand, is kept.
+
+In rollout mode, see Rollout.go, the candidate is promoted across a group of modules in stages, and every promoted
+module keeps running its previous strategy in the shadow, so the rollout is rolled back as soon as the candidate
+errors or disagrees with it too often.
+*/
+
+// Target is a module whose strategy can be shadowed and rolled out, CompressorModule and DispenserModule are
+type Target interface {
+	GetId() string
+	ActiveStrategy() TestDesign.ActiveStrategy
+	SwapStrategy(strategy Strategies.Strategy, info TestDesign.ActiveStrategy) (Strategies.Strategy, TestDesign.ActiveStrategy)
+	CompareAndSwapStrategy(old, strategy Strategies.Strategy, info TestDesign.ActiveStrategy) bool
+}
+
+// CompareFunc reports whether the outputs of the active and the candidate strategy agree
+type CompareFunc func(active, candidate interface{}) bool
+
+// Equal is the default CompareFunc, []byte and strings with the same content agree. Strategies whose output differs
+// on every run, such as the encryption dispenser, need a CompareFunc that decodes the outputs first.
+func Equal(active, candidate interface{}) bool {
+	a, aBytes := asBytes(active)
+	c, cBytes := asBytes(candidate)
+	if aBytes && cBytes {
+		return bytes.Equal(a, c)
+	}
+	return reflect.DeepEqual(active, candidate)
+}
+
+func asBytes(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	default:
+		return nil, false
+	}
+}
+
+// maxMismatches is the number of mismatches ShadowStats keeps as examples
+const maxMismatches = 10
+
+type Mismatch struct {
+	Input     interface{}
+	Active    interface{}
+	Candidate interface{}
+}
+
+type ShadowStats struct {
+	// Inputs are the inputs the active strategy ran on, ActiveErrors and ActiveLatency cover all of them
+	Inputs       int
+	ActiveErrors int
+	// Compared are the inputs both strategies processed without an error and whose outputs were compared
+	Compared        int
+	Mismatches      int
+	CandidateErrors int
+	// ActiveLatency and CandidateLatency are the total time each strategy spent on the inputs
+	ActiveLatency    time.Duration
+	CandidateLatency time.Duration
+	// Skipped are the inputs the active strategy processed but the candidate didn't run on because it was busy
+	Skipped int
+	// Examples are the first mismatches
+	Examples []Mismatch
+}
+
+// MismatchRate is the share of the compared inputs on which both strategies disagreed
+func (s ShadowStats) MismatchRate() float64 {
+	if s.Compared == 0 {
+		return 0
+	}
+	return float64(s.Mismatches) / float64(s.Compared)
+}
+
+// CandidateErrorRate is the share of the inputs the candidate ran on that it failed on while the active strategy
+// didn't
+func (s ShadowStats) CandidateErrorRate() float64 {
+	ran := s.Compared + s.CandidateErrors
+	if ran == 0 {
+		return 0
+	}
+	return float64(s.CandidateErrors) / float64(ran)
+}
+
+func (s *ShadowStats) add(other ShadowStats) {
+	s.Inputs += other.Inputs
+	s.Compared += other.Compared
+	s.Mismatches += other.Mismatches
+	s.ActiveErrors += other.ActiveErrors
+	s.CandidateErrors += other.CandidateErrors
+	s.ActiveLatency += other.ActiveLatency
+	s.CandidateLatency += other.CandidateLatency
+	s.Skipped += other.Skipped
+	for _, example := range other.Examples {
+		if len(s.Examples) < maxMismatches {
+			s.Examples = append(s.Examples, example)
+		}
+	}
+}
+
+// maxShadowed is the number of inputs the candidate runs on at the same time
+const maxShadowed = 4
+
+// shadowStrategy returns the output of active and compares the output of candidate with it
+type shadowStrategy struct {
+	active    Strategies.Strategy
+	candidate Strategies.Strategy
+	compare   CompareFunc
+	stats     ShadowStats
+	// inFlight holds a token for every input the candidate is running on
+	inFlight chan struct{}
+	mu       sync.Mutex
+}
+
+func newShadowStrategy(compare CompareFunc) *shadowStrategy {
+	return &shadowStrategy{compare: compare, inFlight: make(chan struct{}, maxShadowed)}
+}
+
+func (s *shadowStrategy) Execute(value interface{}) (interface{}, error) {
+	s.mu.Lock()
+	active, candidate := s.active, s.candidate
+	s.mu.Unlock()
+	if active == nil {
+		return nil, ErrNoStrategy
+	}
+
+	begin := time.Now()
+	output, err := execute(active, value)
+	s.mu.Lock()
+	s.stats.Inputs++
+	s.stats.ActiveLatency += time.Since(begin)
+	if err != nil {
+		// There is nothing to compare the candidate with
+		s.stats.ActiveErrors++
+		s.mu.Unlock()
+		return output, err
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		s.mu.Lock()
+		s.stats.Skipped++
+		s.mu.Unlock()
+		return output, err
+	}
+	go func() {
+		defer func() { <-s.inFlight }()
+		begin := time.Now()
+		candidateOutput, candidateErr := execute(candidate, value)
+		s.record(value, output, candidateOutput, candidateErr, time.Since(begin))
+	}()
+	return output, err
+}
+
+// record compares the output of the candidate with the output of the active strategy
+func (s *shadowStrategy) record(value, output, candidateOutput interface{}, candidateErr error, candidateLatency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.CandidateLatency += candidateLatency
+	if candidateErr != nil {
+		s.stats.CandidateErrors++
+		return
+	}
+	s.stats.Compared++
+	if !s.compare(output, candidateOutput) {
+		s.stats.Mismatches++
+		if len(s.stats.Examples) < maxMismatches {
+			s.stats.Examples = append(s.stats.Examples, Mismatch{Input: value, Active: output, Candidate: candidateOutput})
+		}
+	}
+}
+
+// wait blocks until the candidate finished the inputs it is running on, later inputs are skipped
+func (s *shadowStrategy) wait() {
+	for i := 0; i < maxShadowed; i++ {
+		s.inFlight <- struct{}{}
+	}
+}
+
+// execute turns a panic of strategy into an error. In a rollout the active strategy is the candidate, so neither
+// may break the module.
+func execute(strategy Strategies.Strategy, value interface{}) (output interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("strategy panicked: %v", r)
+		}
+	}()
+	return strategy.Execute(value)
+}
+
+func (s *shadowStrategy) snapshot() ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Examples = append([]Mismatch(nil), s.stats.Examples...)
+	return stats
+}
+
+// Shadow runs a candidate strategy in the shadow of the active strategy of a module
+type Shadow struct {
+	target   Target
+	shadow   *shadowStrategy
+	original Strategies.Strategy
+	info     TestDesign.ActiveStrategy
+	stopped  bool
+	mu       sync.Mutex
+}
+
+// ErrNoStrategy is returned when a module has no strategy to compare a candidate with
+var ErrNoStrategy = errors.New("module has no active strategy")
+
+// StartShadow creates the registered strategy identifier with params and runs it in the shadow of the strategy of
+// target until Stop is called. A nil compare is Equal.
+func StartShadow(target Target, identifier string, params map[string]interface{}, compare CompareFunc) (*Shadow, error) {
+	info := target.ActiveStrategy()
+	candidate, err := Strategies.CreateWithParams(info.Kind, identifier, params)
+	if err != nil {
+		return nil, err
+	}
+	return installShadow(target, candidate, compare, nil)
+}
+
+// installShadow swaps a shadowStrategy into target. Without promoted the active strategy of target stays active and
+// other runs in its shadow; with promoted other becomes active, described by promoted, and the strategy it replaced
+// runs in its shadow.
+func installShadow(target Target, other Strategies.Strategy, compare CompareFunc, promoted *TestDesign.ActiveStrategy) (*Shadow, error) {
+	if compare == nil {
+		compare = Equal
+	}
+	info := target.ActiveStrategy()
+	if promoted != nil {
+		info = *promoted
+	}
+	// The shadow is locked until it knows the strategy it replaced, so it never executes without it
+	shadow := newShadowStrategy(compare)
+	shadow.mu.Lock()
+	original, originalInfo := target.SwapStrategy(shadow, info)
+	shadow.active, shadow.candidate = original, other
+	if promoted != nil {
+		shadow.active, shadow.candidate = other, original
+	}
+	shadow.mu.Unlock()
+	if original == nil {
+		target.CompareAndSwapStrategy(shadow, original, originalInfo)
+		return nil, fmt.Errorf("module %s: %w", target.GetId(), ErrNoStrategy)
+	}
+	return &Shadow{target: target, shadow: shadow, original: original, info: originalInfo}, nil
+}
+
+func (s *Shadow) Stats() ShadowStats {
+	return s.shadow.snapshot()
+}
+
+// commit replaces the shadow with the strategy it was running as active, described by info, unless the module was
+// given another strategy in the meantime
+func (s *Shadow) commit(info TestDesign.ActiveStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.shadow.mu.Lock()
+		active := s.shadow.active
+		s.shadow.mu.Unlock()
+		s.target.CompareAndSwapStrategy(s.shadow, active, info)
+		s.stopped = true
+	}
+}
+
+// Stop restores the strategy the module had before the shadow started and returns the final stats, once the
+// candidate finished the inputs it was running on. A module that was given another strategy while the shadow ran
+// keeps it.
+func (s *Shadow) Stop() ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.target.CompareAndSwapStrategy(s.shadow, s.original, s.info)
+		s.stopped = true
+		s.shadow.wait()
+	}
+	return s.shadow.snapshot()
+}
@@ -0,0 +1,87 @@
+package Rollout
+
+import (
+	"errors"
+	"mcs/TestDesign"
+	_ "mcs/TestDesign/Strategies/CompressorStrategies"
+	"sync/atomic"
+	"testing"
+)
+
+type strategyFunc func(value interface{}) (interface{}, error)
+
+func (f strategyFunc) Execute(value interface{}) (interface{}, error) {
+	return f(value)
+}
+
+func TestShadowRecordsActiveErrorsWhileTheCandidateIsBusy(t *testing.T) {
+	module := TestDesign.NewCompressorModule("compressor", nil, "value")
+	release := make(chan struct{})
+	defer close(release)
+	module.SetStrategy(strategyFunc(func(value interface{}) (interface{}, error) {
+		<-release
+		return value, nil
+	}))
+	var calls int32
+	failing := strategyFunc(func(value interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) > maxShadowed {
+			return nil, errors.New("candidate failed")
+		}
+		return value, nil
+	})
+	// In a rollout the candidate is active and the strategy it replaced, here a slow one, runs in the shadow
+	shadow, err := installShadow(module, failing, nil, &TestDesign.ActiveStrategy{Strategy: "failing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const inputs = 20
+	for i := 0; i < inputs; i++ {
+		module.Execute()
+	}
+	stats := shadow.Stats()
+	if stats.Inputs != inputs || stats.ActiveErrors != inputs-maxShadowed {
+		t.Fatalf("recorded %d inputs and %d active errors, expected %d and %d", stats.Inputs, stats.ActiveErrors, inputs, inputs-maxShadowed)
+	}
+	if rate := (StageReport{Stats: stats}).ErrorRate(); rate < 0.5 {
+		t.Fatalf("error rate %.3f hides the failures of the candidate", rate)
+	}
+}
+
+func TestShadowStopKeepsAStrategySetWhileItRan(t *testing.T) {
+	module := TestDesign.NewCompressorModule("compressor", nil, "value")
+	if err := module.ConfigureStrategy("v3", nil); err != nil {
+		t.Fatal(err)
+	}
+	shadow, err := StartShadow(module, "v2", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := module.ConfigureStrategy("v4", nil); err != nil {
+		t.Fatal(err)
+	}
+	shadow.Stop()
+	if active := module.ActiveStrategy().Strategy; active != "v4" {
+		t.Fatalf("module runs %s after the shadow stopped, expected the v4 set while it ran", active)
+	}
+}
+
+func TestShadowStopRestoresTheOriginalStrategy(t *testing.T) {
+	module := TestDesign.NewCompressorModule("compressor", nil, "value")
+	if err := module.ConfigureStrategy("v3", nil); err != nil {
+		t.Fatal(err)
+	}
+	shadow, err := StartShadow(module, "v2", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := module.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	stats := shadow.Stop()
+	if stats.Inputs != 1 || stats.Compared != 1 || stats.Mismatches != 1 {
+		t.Fatalf("stats %+v, expected one compared input that mismatched", stats)
+	}
+	if active := module.ActiveStrategy().Strategy; active != "v3" {
+		t.Fatalf("module runs %s after the shadow stopped, expected v3", active)
+	}
+}
@@ -0,0 +1,343 @@
+package Scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mcs/TestDesign"
+	"mcs/TestDesign/DataSources"
+	"mcs/TestDesign/mcstest"
+	"sort"
+	"time"
+)
+
+/*
+This file runs a Scenario against a MasterController under a virtual clock, using an mcstest.Harness. Before a step
+the clock is advanced to the time of the step, the action is performed and the clock is advanced through the
+expectation window while the notifications delivered by the controller are collected.
+
+Available actions:
+
+    subscribe, unsubscribe   module subscribes to, or unsubscribes from, topic of target
+    publish                  module publishes value on topic
+    setState                 module is put in state ("init", "running", "shutdown" or "error")
+    resolveError             module resolves its error and resumes its background process
+    unregister, register     module is unregistered from, or registered with, the controller. With "for" an
+                             unregistered module is registered again after that time
+    unregisterRandom         count modules chosen with seed are unregistered, and registered again after "for"
+    wait                     nothing happens, the step only checks its expectation
+*/
+
+// defaultResolution is the step size of the virtual clock when no module has a shorter period
+const defaultResolution = 100 * time.Millisecond
+
+type StepResult struct {
+	Index  int
+	Name   string
+	Action string
+	Passed bool
+	Err    error
+	// Diff lists the expected and received notifications: "- " is expected but missing, "+ " is received but not
+	// expected, "  " is both
+	Diff []string
+}
+
+type Report struct {
+	Scenario string
+	Steps    []StepResult
+}
+
+func (r Report) Passed() bool {
+	for _, step := range r.Steps {
+		if !step.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "Scenario %s\n", r.Scenario)
+	passed := 0
+	for _, step := range r.Steps {
+		status := "FAIL"
+		if step.Passed {
+			status = "PASS"
+			passed++
+		}
+		fmt.Fprintf(w, "  %s step %d %s (%s)\n", status, step.Index+1, step.Name, step.Action)
+		if step.Err != nil {
+			fmt.Fprintf(w, "      error: %v\n", step.Err)
+		}
+		if !step.Passed {
+			for _, line := range step.Diff {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintf(w, "  %d/%d steps passed\n", passed, len(r.Steps))
+}
+
+type runner struct {
+	scenario   *Scenario
+	harness    *mcstest.Harness
+	modules    map[string]*TestDesign.BaseModule
+	start      time.Time
+	resolution time.Duration
+}
+
+// Run executes the scenario and reports the result of every step
+func Run(scenario *Scenario) Report {
+	r := &runner{
+		scenario:   scenario,
+		harness:    mcstest.NewHarness(),
+		modules:    make(map[string]*TestDesign.BaseModule),
+		resolution: defaultResolution,
+	}
+	defer r.harness.Close()
+	r.start = r.harness.Clock.Now()
+
+	report := Report{Scenario: scenario.Name}
+	if err := r.setup(); err != nil {
+		report.Steps = append(report.Steps, StepResult{Name: "setup", Action: "setup", Err: err})
+		return report
+	}
+	for i, step := range scenario.Steps {
+		report.Steps = append(report.Steps, r.runStep(i, step))
+	}
+	return report
+}
+
+func (r *runner) setup() error {
+	for _, spec := range r.scenario.Modules {
+		source, err := newSource(spec.Source)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", spec.ID, err)
+		}
+		module := r.harness.NewModule(spec.ID, source)
+		module.SetNotificationCallback(func(string, interface{}) {})
+		if source != nil {
+			r.useResolution(source.Period())
+		}
+		if spec.Heartbeat != nil {
+			config := TestDesign.HeartbeatConfig{Interval: time.Duration(spec.Heartbeat.Interval), GracePeriod: time.Duration(spec.Heartbeat.Grace)}
+			module.SetHeartbeatConfig(config)
+			r.useResolution(config.Interval)
+		}
+		r.modules[spec.ID] = module
+	}
+	for _, spec := range r.scenario.Modules {
+		if spec.Running {
+			r.modules[spec.ID].TransitionToRunning()
+		}
+	}
+	r.harness.Settle()
+	return nil
+}
+
+func (r *runner) useResolution(period time.Duration) {
+	if period > 0 && period < r.resolution {
+		r.resolution = period
+	}
+}
+
+func newSource(spec *SourceSpec) (DataSources.DataSource, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	period := time.Duration(spec.Period)
+	switch spec.Type {
+	case "ramp":
+		return DataSources.NewRampSource(spec.Topic, period, spec.Start, spec.End, spec.Step)
+	case "sine":
+		return DataSources.NewSineSource(spec.Topic, period, spec.Amplitude, spec.Frequency, spec.Offset)
+	case "noise":
+		return DataSources.NewNoiseSource(spec.Topic, period, spec.Offset, spec.StdDev, spec.Seed)
+	case "csv":
+		return DataSources.NewCSVSource(spec.File, spec.Column, spec.Topic, period, spec.Loop)
+	default:
+		return nil, fmt.Errorf("unknown source type %q", spec.Type)
+	}
+}
+
+func (r *runner) runStep(index int, step Step) StepResult {
+	result := StepResult{Index: index, Name: step.Name, Action: step.Action}
+	if result.Name == "" {
+		result.Name = step.Action
+	}
+
+	if wait := r.start.Add(time.Duration(step.At)).Sub(r.harness.Clock.Now()); wait > 0 {
+		r.harness.Advance(wait, r.resolution)
+	}
+	r.harness.ClearNotifications()
+
+	if err := r.perform(step); err != nil {
+		result.Err = err
+		return result
+	}
+	r.harness.Settle()
+
+	if step.Expect == nil {
+		result.Passed = true
+		return result
+	}
+	r.harness.Advance(time.Duration(step.Expect.Within), r.resolution)
+	result.Passed, result.Diff = compare(step.Expect, r.harness.Notifications())
+	return result
+}
+
+func (r *runner) module(id string) (*TestDesign.BaseModule, error) {
+	module, ok := r.modules[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q", id)
+	}
+	return module, nil
+}
+
+func (r *runner) perform(step Step) error {
+	if step.Action == "wait" {
+		return nil
+	}
+	if step.Action == "unregisterRandom" {
+		return r.unregisterRandom(step)
+	}
+
+	module, err := r.module(step.Module)
+	if err != nil {
+		return err
+	}
+	switch step.Action {
+	case "subscribe":
+		module.SubscribeToTopic(step.Topic, step.Target)
+	case "unsubscribe":
+		module.UnsubscribeFromTopic(step.Topic, step.Target)
+	case "publish":
+		module.PublishToTopic(step.Topic, step.Value)
+	case "setState":
+		state, err := TestDesign.ParseState(step.State)
+		if err != nil {
+			return err
+		}
+		module.SetState(state)
+	case "resolveError":
+		module.ResolveError()
+	case "register":
+		return r.harness.Controller.RegisterModule(module)
+	case "unregister":
+		return r.unregister(module, time.Duration(step.For))
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+	return nil
+}
+
+func (r *runner) unregister(module *TestDesign.BaseModule, duration time.Duration) error {
+	if err := r.harness.Controller.UnregisterModule(module.GetId()); err != nil {
+		return err
+	}
+	if duration > 0 {
+		r.harness.Clock.AfterFunc(duration, func() {
+			if err := r.harness.Controller.RegisterModule(module); err != nil {
+				fmt.Printf("Error registering module %s: %v\n", module.GetId(), err)
+			}
+		})
+	}
+	return nil
+}
+
+func (r *runner) unregisterRandom(step Step) error {
+	ids := make([]string, 0, len(r.modules))
+	for id := range r.harness.Controller.GetModules() {
+		ids = append(ids, id)
+	}
+	// Sort before shuffling so the same seed always picks the same modules
+	sort.Strings(ids)
+	random := rand.New(rand.NewSource(step.Seed))
+	random.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if step.Count < len(ids) {
+		ids = ids[:step.Count]
+	}
+	for _, id := range ids {
+		if err := r.unregister(r.modules[id], time.Duration(step.For)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compare matches every expected notification with one received notification
+func compare(expect *Expectation, received []mcstest.Notification) (bool, []string) {
+	sort.SliceStable(received, func(i, j int) bool { return received[i].Time.Before(received[j].Time) })
+	used := make([]bool, len(received))
+	passed := true
+	var diff []string
+
+	for _, expected := range expect.Notifications {
+		found := false
+		for i, notification := range received {
+			if !used[i] && matches(expected, notification) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if found {
+			diff = append(diff, "  "+formatExpected(expected))
+		} else {
+			passed = false
+			diff = append(diff, "- "+formatExpected(expected))
+		}
+	}
+	for i, notification := range received {
+		if used[i] {
+			continue
+		}
+		if expect.Exact {
+			passed = false
+		}
+		diff = append(diff, "+ "+formatReceived(notification))
+	}
+	return passed, diff
+}
+
+func matches(expected ExpectedNotification, notification mcstest.Notification) bool {
+	if expected.Publisher != "" && expected.Publisher != notification.PublisherID {
+		return false
+	}
+	if expected.Subscriber != "" && expected.Subscriber != notification.SubscriberID {
+		return false
+	}
+	if expected.Topic != "" && expected.Topic != notification.Topic {
+		return false
+	}
+	return expected.Value == nil || formatValue(expected.Value) == formatValue(notification.Value)
+}
+
+// formatValue compares values by their JSON form, so the 1 of a scenario file matches an int or a float64
+func formatValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func formatExpected(expected ExpectedNotification) string {
+	value := "*"
+	if expected.Value != nil {
+		value = formatValue(expected.Value)
+	}
+	return fmt.Sprintf("%s -> %s %s=%s", orAny(expected.Publisher), orAny(expected.Subscriber), orAny(expected.Topic), value)
+}
+
+func formatReceived(notification mcstest.Notification) string {
+	return fmt.Sprintf("%s -> %s %s=%s", notification.PublisherID, notification.SubscriberID, notification.Topic, formatValue(notification.Value))
+}
+
+func orAny(text string) string {
+	if text == "" {
+		return "*"
+	}
+	return text
+}
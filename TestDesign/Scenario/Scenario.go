@@ -0,0 +1,134 @@
+package Scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+/*
+This file defines the scenario format. A scenario is a JSON file that describes a set of modules and a list of
+steps. Each step performs an action on the MasterController at a point in virtual time and may expect a set of
+notifications to be delivered within a time window after the action:
+
+    {
+        "name": "error state",
+        "modules": [
+            {"id": "module1", "running": true, "source": {"type": "ramp", "topic": "x", "period": "500ms", "step": 1, "end": 100}},
+            {"id": "module2"}
+        ],
+        "steps": [
+            {"name": "subscribe", "action": "subscribe", "module": "module2", "target": "module1", "topic": "x",
+             "expect": {"within": "1s", "notifications": [{"publisher": "module1", "subscriber": "module2", "topic": "x", "value": 0}]}},
+            {"name": "error", "at": "5s", "action": "setState", "module": "module1", "state": "error",
+             "expect": {"within": "10s", "exact": true}}
+        ]
+    }
+
+Durations use the syntax of time.ParseDuration. See Runner.go for the available actions.
+*/
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string like \"500ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Scenario struct {
+	Name    string       `json:"name"`
+	Modules []ModuleSpec `json:"modules"`
+	Steps   []Step       `json:"steps"`
+}
+
+type ModuleSpec struct {
+	ID      string      `json:"id"`
+	Running bool        `json:"running"`
+	Source  *SourceSpec `json:"source,omitempty"`
+	// Heartbeat enables heartbeats and the watchdog for the module
+	Heartbeat *HeartbeatSpec `json:"heartbeat,omitempty"`
+}
+
+// SourceSpec describes a simulated data source, Type is one of "ramp", "sine", "noise" or "csv"
+type SourceSpec struct {
+	Type      string   `json:"type"`
+	Topic     string   `json:"topic"`
+	Period    Duration `json:"period"`
+	Start     float64  `json:"start"`
+	End       float64  `json:"end"`
+	Step      float64  `json:"step"`
+	Amplitude float64  `json:"amplitude"`
+	Frequency float64  `json:"frequency"`
+	Offset    float64  `json:"offset"`
+	StdDev    float64  `json:"stdDev"`
+	Seed      int64    `json:"seed"`
+	File      string   `json:"file"`
+	Column    string   `json:"column"`
+	Loop      bool     `json:"loop"`
+}
+
+type HeartbeatSpec struct {
+	Interval Duration `json:"interval"`
+	Grace    Duration `json:"grace"`
+}
+
+type Step struct {
+	Name string `json:"name"`
+	// At is the time since the start of the scenario at which the action is performed. Steps are performed in
+	// order, a step whose time already passed is performed straight away.
+	At     Duration    `json:"at"`
+	Action string      `json:"action"`
+	Module string      `json:"module"`
+	Target string      `json:"target"`
+	Topic  string      `json:"topic"`
+	Value  interface{} `json:"value"`
+	State  string      `json:"state"`
+	// For is how long an unregistered module stays unregistered, zero keeps it unregistered
+	For    Duration     `json:"for"`
+	Count  int          `json:"count"`
+	Seed   int64        `json:"seed"`
+	Expect *Expectation `json:"expect,omitempty"`
+}
+
+type Expectation struct {
+	// Within is the length of the window after the action in which notifications are collected
+	Within        Duration               `json:"within"`
+	Notifications []ExpectedNotification `json:"notifications"`
+	// Exact makes every notification in the window that wasn't expected a failure
+	Exact bool `json:"exact"`
+}
+
+type ExpectedNotification struct {
+	Publisher  string      `json:"publisher"`
+	Subscriber string      `json:"subscriber"`
+	Topic      string      `json:"topic"`
+	Value      interface{} `json:"value"`
+}
+
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scenario: %w", err)
+	}
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("error parsing scenario %s: %w", path, err)
+	}
+	if scenario.Name == "" {
+		scenario.Name = path
+	}
+	return &scenario, nil
+}
@@ -0,0 +1,313 @@
+package CompressorStrategies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mcs/TestDesign/Strategies"
+	"mcs/TestDesign/Timing"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+This file contains the adaptive compressor, for payloads where it isn't known in advance which compressor suits them
+best. It keeps the most recent payloads, and every TrialEvery payloads it compresses them with every candidate,
+scores each candidate with a cost function and switches to the cheapest. The candidates are reversible compressors
+from Strategies.DefaultRegistry, by default all of them, so compressors registered by other packages are trialled
+too. Each candidate compresses through its codec (see NewStrategyCodec), so Reverse decodes the output whichever
+candidate was selected at the time. A trial decodes the output of every candidate as well, and a candidate whose
+output doesn't decode to the payload, such as gzip turning a map into its %v string, isn't selected.
+
+Every trial is reported as a Decision on DecisionTopic and the running totals as AdaptiveStats on StatsTopic.
+CompressorModule publishes them when it is given an adaptive compressor.
+*/
+
+const (
+	DecisionTopic = "compressorDecision"
+	StatsTopic    = "compressorStats"
+)
+
+// TrialResult is how a candidate did on the payloads of a trial
+type TrialResult struct {
+	Strategy string
+	// RawBytes is the size of the payloads as JSON, the reference the ratio is computed against
+	RawBytes        int
+	CompressedBytes int
+	Ratio           float64
+	// CPUTime is the time the candidate spent compressing the payloads
+	CPUTime time.Duration
+	Cost    float64
+	// Error is set when the candidate couldn't compress a payload or its output didn't decode to the payload, it
+	// isn't selected then
+	Error string `json:",omitempty"`
+}
+
+type Decision struct {
+	Time time.Time
+	// Payload is the number of payloads compressed before the trial
+	Payload  int
+	Previous string
+	Selected string
+	Switched bool
+	Results  []TrialResult
+}
+
+type AdaptiveStats struct {
+	Strategy        string
+	Payloads        int
+	Trials          int
+	Switches        int
+	CompressedBytes int
+}
+
+// CostFunc scores a trial result, lower is better
+type CostFunc func(result TrialResult) float64
+
+// SizeCost selects the candidate with the smallest output
+func SizeCost(result TrialResult) float64 {
+	return float64(result.CompressedBytes)
+}
+
+// WeightedCost weighs the output size in bytes against the compression time in microseconds
+func WeightedCost(byteWeight, microsecondWeight float64) CostFunc {
+	return func(result TrialResult) float64 {
+		return byteWeight*float64(result.CompressedBytes) + microsecondWeight*float64(result.CPUTime.Microseconds())
+	}
+}
+
+type AdaptiveOptions struct {
+	// Candidates are the identifiers of the registered compressors to trial, parameters can follow them like they
+	// can in Strategies.Create. Empty trials the latest version of every reversible compressor that is registered.
+	Candidates []string
+	// TrialEvery is the number of payloads between trials, 0 is 100. The first payload is always trialled.
+	TrialEvery int
+	// Window is the number of recent payloads a trial compresses, 0 is 8
+	Window int
+	// Cost scores the candidates, nil is SizeCost
+	Cost CostFunc
+	// Clock timestamps the decisions, nil is Timing.RealClock. Compression time is always measured in real time.
+	Clock Timing.Clock
+}
+
+type AdaptiveCompressor struct {
+	options  AdaptiveOptions
+	codecs   []Codec
+	current  Codec
+	recent   []interface{}
+	stats    AdaptiveStats
+	reporter Strategies.Reporter
+	mu       sync.Mutex
+}
+
+func NewAdaptiveCompressor(options AdaptiveOptions) (*AdaptiveCompressor, error) {
+	if options.TrialEvery <= 0 {
+		options.TrialEvery = 100
+	}
+	if options.Window <= 0 {
+		options.Window = 8
+	}
+	if options.Cost == nil {
+		options.Cost = SizeCost
+	}
+	if options.Clock == nil {
+		options.Clock = Timing.RealClock{}
+	}
+	a := &AdaptiveCompressor{options: options}
+	if len(options.Candidates) == 0 {
+		a.codecs = registeredCodecs()
+		if len(a.codecs) == 0 {
+			return nil, errors.New("adaptive compressor has no reversible compressors to trial")
+		}
+	}
+	for _, identifier := range options.Candidates {
+		codec, err := NewStrategyCodec(identifier, nil)
+		if err != nil {
+			return nil, fmt.Errorf("adaptive candidate %q: %w", identifier, err)
+		}
+		a.codecs = append(a.codecs, codec)
+	}
+	a.current = a.codecs[0]
+	a.stats.Strategy = a.current.ID()
+	return a, nil
+}
+
+// registeredCodecs returns the codecs of the latest version of every reversible compressor in the registry that
+// can be created without parameters, other than the adaptive compressor itself
+func registeredCodecs() []Codec {
+	latest := map[string]Strategies.Descriptor{}
+	var names []string
+	for _, descriptor := range Strategies.List(Strategies.KindCompressor) {
+		if !descriptor.Reversible || descriptor.Name == adaptiveName {
+			continue
+		}
+		if _, seen := latest[descriptor.Name]; !seen {
+			names = append(names, descriptor.Name)
+		}
+		latest[descriptor.Name] = descriptor
+	}
+	var codecs []Codec
+	for _, name := range names {
+		if codec, err := NewStrategyCodec(latest[name].ID(), nil); err == nil {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+func (a *AdaptiveCompressor) SetReporter(reporter Strategies.Reporter) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reporter = reporter
+}
+
+// Current returns the identifier of the codec that compresses now
+func (a *AdaptiveCompressor) Current() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current.ID()
+}
+
+func (a *AdaptiveCompressor) Stats() AdaptiveStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
+
+// Execute compresses value with the selected codec, trialling the candidates first when it is time to
+func (a *AdaptiveCompressor) Execute(value interface{}) (interface{}, error) {
+	a.mu.Lock()
+	a.recent = append(a.recent, value)
+	if len(a.recent) > a.options.Window {
+		a.recent = a.recent[1:]
+	}
+	var decision *Decision
+	if a.stats.Payloads%a.options.TrialEvery == 0 {
+		decision = a.trial()
+	}
+	codec := a.current
+	a.mu.Unlock()
+
+	output, err := codec.Encode(value)
+
+	a.mu.Lock()
+	a.stats.Payloads++
+	a.stats.CompressedBytes += len(output)
+	stats, reporter := a.stats, a.reporter
+	a.mu.Unlock()
+
+	if decision != nil && reporter != nil {
+		reporter(DecisionTopic, *decision)
+		reporter(StatsTopic, stats)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Reverse decodes the output of Execute, whichever candidate produced it. The candidates decode their own output
+// with the parameters they were created with, other output is left to Decode.
+func (a *AdaptiveCompressor) Reverse(value interface{}) (interface{}, error) {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("can't decompress %T, expected []byte", value)
+	}
+	header, _, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, codec := range a.codecs {
+		if codec.ID() == header.ID && codec.Version() == header.Version {
+			return codec.Decode(data)
+		}
+	}
+	return Decode(data)
+}
+
+// trial scores every candidate on the recent payloads and selects the cheapest, a.mu is held
+func (a *AdaptiveCompressor) trial() *Decision {
+	rawBytes := 0
+	for _, payload := range a.recent {
+		rawBytes += jsonSize(payload)
+	}
+	decision := &Decision{Time: a.options.Clock.Now(), Payload: a.stats.Payloads, Previous: a.current.ID()}
+	best, bestCost := a.current, math.Inf(1)
+	for _, codec := range a.codecs {
+		result := TrialResult{Strategy: codec.ID(), RawBytes: rawBytes}
+		for _, payload := range a.recent {
+			begin := time.Now()
+			output, err := codec.Encode(payload)
+			result.CPUTime += time.Since(begin)
+			if err != nil {
+				result.Error = err.Error()
+				break
+			}
+			result.CompressedBytes += len(output)
+			// Only the compression is timed, decoding checks that the candidate doesn't lose the payload
+			decoded, err := codec.Decode(output)
+			if err != nil {
+				result.Error = fmt.Sprintf("decoding its output: %v", err)
+				break
+			}
+			if !sameValue(payload, decoded) {
+				result.Error = fmt.Sprintf("its output decodes to %T, not to the %T payload", decoded, payload)
+				break
+			}
+		}
+		if result.Error == "" {
+			if result.CompressedBytes > 0 {
+				result.Ratio = float64(rawBytes) / float64(result.CompressedBytes)
+			}
+			result.Cost = a.options.Cost(result)
+			if result.Cost < bestCost {
+				best, bestCost = codec, result.Cost
+			}
+		}
+		decision.Results = append(decision.Results, result)
+	}
+	a.stats.Trials++
+	if best != a.current {
+		a.current = best
+		a.stats.Switches++
+		a.stats.Strategy = best.ID()
+		decision.Switched = true
+	}
+	decision.Selected = a.current.ID()
+	return decision
+}
+
+// sameValue reports whether decoded is value, or has the same JSON when value went through a codec that decodes to
+// the types encoding/json decodes to
+func sameValue(value, decoded interface{}) bool {
+	if reflect.DeepEqual(value, decoded) {
+		return true
+	}
+	var expected, actual interface{}
+	if !jsonValue(value, &expected) || !jsonValue(decoded, &actual) {
+		return false
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+// jsonValue decodes the JSON of value into target
+func jsonValue(value interface{}, target *interface{}) bool {
+	data, err := json.Marshal(value)
+	return err == nil && json.Unmarshal(data, target) == nil
+}
+
+// jsonSize is the size of the JSON of value, or of its %v string when it has no JSON
+func jsonSize(value interface{}) int {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return len(fmt.Sprintf("%v", value))
+	}
+	return len(data)
+}
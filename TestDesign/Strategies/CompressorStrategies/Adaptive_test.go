@@ -0,0 +1,51 @@
+package CompressorStrategies
+
+import (
+	"testing"
+)
+
+func TestAdaptiveCompressorDoesNotSelectLossyCandidates(t *testing.T) {
+	adaptive, err := NewAdaptiveCompressor(AdaptiveOptions{TrialEvery: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]interface{}, 200)
+	for i := range payload {
+		payload[i] = map[string]interface{}{"pressure": 0, "temperature": 21.5, "sensor": "a"}
+	}
+	for i := 0; i < 3; i++ {
+		output, err := adaptive.Execute(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := adaptive.Reverse(output)
+		if err != nil {
+			t.Fatalf("reversing the output of %s: %v", adaptive.Current(), err)
+		}
+		if !sameValue(payload, decoded) {
+			t.Fatalf("%s decoded the payload to %T", adaptive.Current(), decoded)
+		}
+	}
+	if current := adaptive.Current(); current == "gzip" || current == "reverse" {
+		t.Fatalf("selected %s, which turns the payload into its %%v string", current)
+	}
+}
+
+func TestAdaptiveCompressorRoundTripsBytes(t *testing.T) {
+	adaptive, err := NewAdaptiveCompressor(AdaptiveOptions{TrialEvery: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	output, err := adaptive.Execute(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := adaptive.Reverse(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameValue(payload, decoded) {
+		t.Fatalf("%s decoded %q to %v", adaptive.Current(), payload, decoded)
+	}
+}
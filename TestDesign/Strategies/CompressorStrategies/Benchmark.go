@@ -0,0 +1,175 @@
+package CompressorStrategies
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// Signal is a batch of samples shaped like the streams modules publish
+type Signal struct {
+	Name string
+	// Value is the batch that is compressed
+	Value interface{}
+	// RawBytes is the size of the batch in its fixed-size binary form, 8 bytes per timestamp or float
+	RawBytes int
+	// Strategies are the identifiers of the compressors that accept the batch
+	Strategies []string
+}
+
+type BenchmarkResult struct {
+	Signal          string
+	Strategy        string
+	Samples         int
+	RawBytes        int
+	CompressedBytes int
+	// Ratio is RawBytes divided by CompressedBytes
+	Ratio    float64
+	Duration time.Duration
+	// RoundTrip reports whether the decoder restored the batch, it is false for strategies without a decoder
+	RoundTrip bool
+	Err       error
+}
+
+// BenchmarkSignals generates realistic batches of samples, the same seed generates the same batches
+func BenchmarkSignals(samples int, seed int64) []Signal {
+	random := rand.New(rand.NewSource(seed))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Sampled every second, with an occasional missed sample
+	regular := make([]time.Time, 0, samples)
+	for t := start; len(regular) < samples; t = t.Add(time.Second) {
+		if random.Float64() < 0.01 {
+			continue
+		}
+		regular = append(regular, t)
+	}
+
+	// Sampled every 100ms with a few milliseconds of jitter
+	jittered := make([]time.Time, samples)
+	for i := range jittered {
+		jitter := time.Duration(random.Intn(5)-2) * time.Millisecond
+		jittered[i] = start.Add(time.Duration(i)*100*time.Millisecond + jitter)
+	}
+
+	// A temperature with a daily cycle and sensor noise, reported with one decimal
+	temperature := make([]float64, samples)
+	for i := range temperature {
+		value := 20 + 5*math.Sin(2*math.Pi*float64(i)/86400) + random.NormFloat64()*0.05
+		temperature[i] = math.Round(value*10) / 10
+	}
+
+	// A pressure that wanders around 1013 hPa, reported with two decimals
+	pressure := make([]Point, samples)
+	value := 1013.0
+	for i := range pressure {
+		value += random.NormFloat64() * 0.02
+		pressure[i] = Point{Time: regular[i], Value: math.Round(value*100) / 100}
+	}
+
+	// A valve that switches every few minutes
+	valve := make([]bool, samples)
+	open := false
+	for i := range valve {
+		if random.Float64() < 0.005 {
+			open = !open
+		}
+		valve[i] = open
+	}
+
+	// Module states: running, with a rare error that is resolved after a while
+	states := make([]int, samples)
+	state := 1
+	for i := range states {
+		switch {
+		case state == 1 && random.Float64() < 0.001:
+			state = 3
+		case state == 3 && random.Float64() < 0.05:
+			state = 1
+		}
+		states[i] = state
+	}
+
+	return []Signal{
+		{Name: "timestamps every second", Value: regular, RawBytes: 8 * samples, Strategies: []string{"v1", "v2", "v5"}},
+		{Name: "timestamps with jitter", Value: jittered, RawBytes: 8 * samples, Strategies: []string{"v1", "v2", "v5"}},
+		{Name: "temperature", Value: temperature, RawBytes: 8 * samples, Strategies: []string{"v1", "v2", "v6"}},
+		{Name: "pressure points", Value: pressure, RawBytes: 16 * samples, Strategies: []string{"v1", "v2", "v6"}},
+		{Name: "valve", Value: valve, RawBytes: samples, Strategies: []string{"v1", "v2", "v7"}},
+		{Name: "module states", Value: states, RawBytes: 8 * samples, Strategies: []string{"v1", "v2", "v7"}},
+	}
+}
+
+// RunBenchmarks compresses every signal with the strategies that accept it and checks the round trip of the
+// strategies that have a decoder
+func RunBenchmarks(samples int, seed int64) []BenchmarkResult {
+	factory := &CompressorStrategyFactory{}
+	var results []BenchmarkResult
+	for _, signal := range BenchmarkSignals(samples, seed) {
+		for _, identifier := range signal.Strategies {
+			result := BenchmarkResult{Signal: signal.Name, Strategy: identifier, Samples: samples, RawBytes: signal.RawBytes}
+			compressor, err := factory.CreateStrategy(identifier)
+			if err != nil {
+				result.Err = err
+				results = append(results, result)
+				continue
+			}
+
+			begin := time.Now()
+			output, err := compressor.Execute(signal.Value)
+			result.Duration = time.Since(begin)
+			if err != nil {
+				result.Err = err
+				results = append(results, result)
+				continue
+			}
+			compressed := output.([]byte)
+			result.CompressedBytes = len(compressed)
+			result.Ratio = float64(result.RawBytes) / float64(len(compressed))
+
+			if decompressor, err := factory.CreateDecompressor(identifier); err == nil {
+				decoded, err := decompressor(compressed)
+				result.Err = err
+				result.RoundTrip = err == nil && sameSamples(signal.Value, decoded)
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// sameSamples compares a batch with its decoded form, slices of integers decode to []int64
+func sameSamples(original, decoded interface{}) bool {
+	if reflect.DeepEqual(original, decoded) {
+		return true
+	}
+	values := reflect.ValueOf(original)
+	decodedInts, ok := decoded.([]int64)
+	if !ok || values.Kind() != reflect.Slice || values.Len() != len(decodedInts) {
+		return false
+	}
+	for i, value := range decodedInts {
+		if integerAt(values, i) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func WriteBenchmarks(w io.Writer, results []BenchmarkResult) {
+	fmt.Fprintf(w, "%-24s %-8s %10s %12s %8s %12s %s\n", "signal", "strategy", "raw", "compressed", "ratio", "duration", "round trip")
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(w, "%-24s %-8s error: %v\n", result.Signal, result.Strategy, result.Err)
+			continue
+		}
+		roundTrip := "-"
+		if result.RoundTrip {
+			roundTrip = "ok"
+		}
+		fmt.Fprintf(w, "%-24s %-8s %10d %12d %8.2f %12s %s\n", result.Signal, result.Strategy, result.RawBytes, result.CompressedBytes, result.Ratio, result.Duration, roundTrip)
+	}
+}
@@ -0,0 +1,67 @@
+package CompressorStrategies
+
+import "errors"
+
+var errShortData = errors.New("compressed data is truncated")
+
+// bitWriter packs bits most significant first
+type bitWriter struct {
+	data  []byte
+	count uint8 // bits used in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.count == 0 || w.count == 8 {
+		w.data = append(w.data, 0)
+		w.count = 0
+	}
+	if bit {
+		w.data[len(w.data)-1] |= 1 << (7 - w.count)
+	}
+	w.count++
+}
+
+// writeBits writes the lowest n bits of value
+func (w *bitWriter) writeBits(value uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(value&(1<<uint(i)) != 0)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
+
+type bitReader struct {
+	data []byte
+	pos  int // bit position
+}
+
+// remaining is the number of bits left to read
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.data)*8 {
+		return false, errShortData
+	}
+	bit := r.data[r.pos/8]&(1<<(7-uint(r.pos%8))) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	var value uint64
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value <<= 1
+		if bit {
+			value |= 1
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,225 @@
+package CompressorStrategies
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"mcs/TestDesign/Strategies"
+	"strconv"
+	"strings"
+)
+
+/*
+This file pairs every compressor strategy with a decoder in a Codec. The output of a Codec starts with a header
+that describes it:
+
+    "MCS"    magic, 3 bytes
+    n        length of the strategy identifier, 1 byte
+    id       the strategy identifier, such as "v3", n bytes
+    version  the version of the encoding of the strategy, 1 byte
+
+Decode reads the header and picks the decoder of that strategy and version, so data can be decoded without knowing
+which strategy, or which version of it, produced it. A strategy that changes its encoding registers a codec with a
+new version and keeps the codec of the old version, so data written before the change can still be decoded.
+
+Every other reversible compressor in Strategies.DefaultRegistry gets a codec from NewStrategyCodec, its header
+holds the name and version it is registered under, and Decode creates it from the registry to decode its output.
+*/
+
+var codecMagic = []byte("MCS")
+
+type Codec interface {
+	ID() string
+	Version() uint8
+	// Encode compresses value and prefixes the header
+	Encode(value interface{}) ([]byte, error)
+	// Decode restores the value from the output of Encode, header included
+	Decode(data []byte) (interface{}, error)
+}
+
+type Header struct {
+	ID      string
+	Version uint8
+}
+
+type funcCodec struct {
+	id      string
+	version uint8
+	encode  func(interface{}) ([]byte, error)
+	decode  DecompressorFunc
+}
+
+func (c *funcCodec) ID() string {
+	return c.id
+}
+
+func (c *funcCodec) Version() uint8 {
+	return c.version
+}
+
+func (c *funcCodec) Encode(value interface{}) ([]byte, error) {
+	payload, err := c.encode(value)
+	if err != nil {
+		return nil, err
+	}
+	data := appendCodecHeader(nil, Header{ID: c.id, Version: c.version})
+	return append(data, payload...), nil
+}
+
+func (c *funcCodec) Decode(data []byte) (interface{}, error) {
+	header, payload, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.ID != c.id || header.Version != c.version {
+		return nil, fmt.Errorf("data was encoded by %s version %d, not by %s version %d", header.ID, header.Version, c.id, c.version)
+	}
+	return c.decode(payload)
+}
+
+// codecs holds every version of every codec, the latest version of a strategy is the one that encodes
+var codecs = map[Header]Codec{}
+var latestCodecs = map[string]Codec{}
+
+func registerCodec(codec Codec) {
+	codecs[Header{ID: codec.ID(), Version: codec.Version()}] = codec
+	if latest := latestCodecs[codec.ID()]; latest == nil || latest.Version() < codec.Version() {
+		latestCodecs[codec.ID()] = codec
+	}
+}
+
+func init() {
+	registerCodec(&funcCodec{id: "v1", version: 1, encode: bytesOf(CompressorV1), decode: DecompressorV1})
+	registerCodec(&funcCodec{id: "v2", version: 1, encode: bytesOf(CompressorV2), decode: DecompressorV2})
+	registerCodec(&funcCodec{id: "v3", version: 1, encode: bytesOf(CompressorV3), decode: DecompressorV3})
+	registerCodec(&funcCodec{id: "v4", version: 1, encode: bytesOf(CompressorV4), decode: DecompressorV4})
+	registerCodec(&funcCodec{id: "v5", version: 1, encode: bytesOf(CompressorV5), decode: DecompressorV5})
+	registerCodec(&funcCodec{id: "v6", version: 1, encode: bytesOf(CompressorV6), decode: DecompressorV6})
+	registerCodec(&funcCodec{id: "v7", version: 1, encode: bytesOf(CompressorV7), decode: DecompressorV7})
+}
+
+// CreateCodec returns the latest version of the codec of the compressor strategy with identifier, or the codec of
+// NewStrategyCodec when identifier names a registered strategy without one
+func (f *CompressorStrategyFactory) CreateCodec(identifier string) (Codec, error) {
+	if codec := latestCodecs[identifier]; codec != nil {
+		return codec, nil
+	}
+	return NewStrategyCodec(identifier, nil)
+}
+
+// Decode decodes the output of any codec
+func Decode(data []byte) (interface{}, error) {
+	header, _, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	codec := codecs[header]
+	if codec == nil {
+		if codec, err = NewStrategyCodec(header.ID+"@"+strconv.Itoa(int(header.Version)), nil); err != nil {
+			return nil, fmt.Errorf("no codec for %s version %d: %w", header.ID, header.Version, err)
+		}
+	}
+	return codec.Decode(data)
+}
+
+// strategyCodec is the codec of a reversible compressor in the registry
+type strategyCodec struct {
+	id       string
+	version  uint8
+	strategy Strategies.ReversibleStrategy
+}
+
+// NewStrategyCodec creates the reversible compressor identifier from Strategies.DefaultRegistry with params, like
+// Strategies.CreateWithParams, and returns a codec that encodes with it. Its output can be decoded by Decode as long
+// as the strategy doesn't need other parameters than its defaults to reverse it.
+func NewStrategyCodec(identifier string, params map[string]interface{}) (Codec, error) {
+	name, _, _ := strings.Cut(identifier, "?")
+	registration, err := Strategies.DefaultRegistry.Lookup(Strategies.KindCompressor, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(registration.Name) > math.MaxUint8 || registration.Version > math.MaxUint8 {
+		return nil, fmt.Errorf("compressor strategy %s doesn't fit in a codec header", registration.ID())
+	}
+	strategy, err := Strategies.CreateWithParams(Strategies.KindCompressor, identifier, params)
+	if err != nil {
+		return nil, err
+	}
+	reversible, ok := strategy.(Strategies.ReversibleStrategy)
+	if !ok {
+		return nil, fmt.Errorf("compressor strategy %s isn't reversible", registration.ID())
+	}
+	return &strategyCodec{id: registration.Name, version: uint8(registration.Version), strategy: reversible}, nil
+}
+
+func (c *strategyCodec) ID() string {
+	return c.id
+}
+
+func (c *strategyCodec) Version() uint8 {
+	return c.version
+}
+
+func (c *strategyCodec) Encode(value interface{}) ([]byte, error) {
+	output, err := c.strategy.Execute(value)
+	if err != nil {
+		return nil, err
+	}
+	data := appendCodecHeader(nil, Header{ID: c.id, Version: c.version})
+	switch v := output.(type) {
+	case []byte:
+		return append(data, v...), nil
+	case string:
+		return append(data, v...), nil
+	default:
+		return nil, fmt.Errorf("compressor strategy %s returned %T instead of []byte", c.id, output)
+	}
+}
+
+func (c *strategyCodec) Decode(data []byte) (interface{}, error) {
+	header, payload, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.ID != c.id || header.Version != c.version {
+		return nil, fmt.Errorf("data was encoded by %s version %d, not by %s version %d", header.ID, header.Version, c.id, c.version)
+	}
+	return c.strategy.Reverse(payload)
+}
+
+// ReadHeader returns the header of the output of a codec and the payload after it
+func ReadHeader(data []byte) (Header, []byte, error) {
+	if !bytes.HasPrefix(data, codecMagic) {
+		return Header{}, nil, errors.New("data wasn't encoded by a codec")
+	}
+	rest := data[len(codecMagic):]
+	if len(rest) < 1 || len(rest) < 2+int(rest[0]) {
+		return Header{}, nil, errShortData
+	}
+	n := int(rest[0])
+	header := Header{ID: string(rest[1 : 1+n]), Version: rest[1+n]}
+	return header, rest[2+n:], nil
+}
+
+func appendCodecHeader(data []byte, header Header) []byte {
+	data = append(data, codecMagic...)
+	data = append(data, byte(len(header.ID)))
+	data = append(data, header.ID...)
+	return append(data, header.Version)
+}
+
+// bytesOf adapts a compressor that returns []byte to an encode function
+func bytesOf(compressor CompressorFunc) func(interface{}) ([]byte, error) {
+	return func(value interface{}) ([]byte, error) {
+		output, err := compressor(value)
+		if err != nil {
+			return nil, err
+		}
+		data, ok := output.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("compressor returned %T instead of []byte", output)
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,152 @@
+package CompressorStrategies
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var codecCases = []struct {
+	id    string
+	value interface{}
+}{
+	{"v1", map[string]interface{}{"pressure": 1.5, "sensor": "a"}},
+	{"v2", map[string]interface{}{"pressure": 1.5, "sensor": "a", "valid": true}},
+	{"v3", []interface{}{1.5, "a", true, nil}},
+	{"v4", "sensor reading"},
+	{"v5", []time.Time{time.Unix(1760000000, 0), time.Unix(1760000001, 0), time.Unix(1760000003, 500)}},
+	{"v5", []int64{10, 20, 30, 45, -5}},
+	{"v6", []float64{21.5, 21.5, 21.75, -3, 0}},
+	{"v6", []Point{{time.Unix(1760000000, 0), 1}, {time.Unix(1760000010, 0), 1.25}}},
+	{"v7", []bool{true, true, true, false, false, true}},
+	{"v7", []string{"idle", "idle", "running", "running", "idle"}},
+}
+
+// equalValues compares decoded values, times are compared with Equal since they come back in the local time zone
+func equalValues(a, b interface{}) bool {
+	switch a := a.(type) {
+	case []time.Time:
+		b, ok := b.([]time.Time)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !a[i].Equal(b[i]) {
+				return false
+			}
+		}
+		return true
+	case []Point:
+		b, ok := b.([]Point)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !a[i].Time.Equal(b[i].Time) || a[i].Value != b[i].Value {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	factory := &CompressorStrategyFactory{}
+	for _, c := range codecCases {
+		t.Run(c.id, func(t *testing.T) {
+			codec, err := factory.CreateCodec(c.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Encode(c.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, _, err := ReadHeader(data)
+			if err != nil || header.ID != c.id || header.Version != codec.Version() {
+				t.Fatalf("header %+v, %v, expected %s version %d", header, err, c.id, codec.Version())
+			}
+			decoded, err := codec.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalValues(c.value, decoded) {
+				t.Fatalf("decoded %#v, expected %#v", decoded, c.value)
+			}
+			// The header tells Decode which codec to use
+			if decoded, err = Decode(data); err != nil || !equalValues(c.value, decoded) {
+				t.Fatalf("Decode returned %#v, %v, expected %#v", decoded, err, c.value)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsTruncatedData(t *testing.T) {
+	factory := &CompressorStrategyFactory{}
+	for _, c := range codecCases {
+		if c.id == "v4" {
+			// Every prefix of a reversed string is a string
+			continue
+		}
+		t.Run(c.id, func(t *testing.T) {
+			codec, err := factory.CreateCodec(c.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Encode(c.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headerSize := len(codecMagic) + 2 + len(c.id)
+			for _, size := range []int{0, 2, headerSize - 1, headerSize, len(data) - 1} {
+				if decoded, err := Decode(data[:size]); err == nil {
+					t.Fatalf("decoded %d of %d bytes to %#v", size, len(data), decoded)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsForgedHeaders(t *testing.T) {
+	v6, err := (&CompressorStrategyFactory{}).CreateCodec("v6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, err := v6.Encode([]float64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := ReadHeader(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"no magic", append([]byte("XYZ\x02v6\x01"), payload...)},
+		{"unknown strategy", append(appendCodecHeader(nil, Header{ID: "v99", Version: 1}), payload...)},
+		{"unknown version", append(appendCodecHeader(nil, Header{ID: "v6", Version: 9}), payload...)},
+		{"identifier longer than the data", []byte("MCS\xffv6")},
+		{"another strategy", append(appendCodecHeader(nil, Header{ID: "v7", Version: 1}), payload...)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if decoded, err := Decode(c.data); err == nil {
+				t.Fatalf("decoded forged data to %#v", decoded)
+			}
+		})
+	}
+
+	v5, err := (&CompressorStrategyFactory{}).CreateCodec("v5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v5.Decode(points); err == nil {
+		t.Fatal("the v5 codec decoded the output of v6")
+	}
+	if _, _, err := ReadHeader([]byte("MCS")); !errors.Is(err, errShortData) {
+		t.Fatalf("reading a header without an identifier returned %v", err)
+	}
+}
@@ -1,23 +1,173 @@
 package CompressorStrategies
 
 import (
+	"compress/gzip"
 	"errors"
+	"fmt"
+	"mcs/TestDesign/Strategies"
+	"strings"
 )
 
+// CompressorStrategyFactory creates the compressor strategies registered in Strategies.DefaultRegistry
 type CompressorStrategyFactory struct{}
 
-func (f *CompressorStrategyFactory) CreateStrategy(identifier string) (CompressorFunc, error) {
-	switch identifier {
-	case "v1":
-		return CompressorV1, nil
-	case "v2":
-		return CompressorV2, nil
-	case "v3":
-		return CompressorV3, nil
-	case "v4":
-		return CompressorV4, nil
-	// And so on for other strategies...
+func (f *CompressorStrategyFactory) CreateStrategy(identifier string) (Strategies.Strategy, error) {
+	return Strategies.Create(Strategies.KindCompressor, identifier)
+}
+
+func (f *CompressorStrategyFactory) CreateStrategyWithParams(identifier string, params map[string]interface{}) (Strategies.Strategy, error) {
+	return Strategies.CreateWithParams(Strategies.KindCompressor, identifier, params)
+}
+
+// List returns the descriptors of the compressor strategies that are registered
+func (f *CompressorStrategyFactory) List() []Strategies.Descriptor {
+	return Strategies.List(Strategies.KindCompressor)
+}
+
+// Register adds a compressor strategy, so other packages can add their own
+func (f *CompressorStrategyFactory) Register(registration Strategies.Registration) error {
+	registration.Kind = Strategies.KindCompressor
+	return Strategies.Register(registration)
+}
+
+// CreateDecompressor returns the decoder of the compressor strategy with identifier
+func (f *CompressorStrategyFactory) CreateDecompressor(identifier string) (DecompressorFunc, error) {
+	strategy, err := f.CreateStrategy(identifier)
+	if err != nil {
+		return nil, err
+	}
+	reverser, ok := strategy.(Strategies.Reverser)
+	if !ok {
+		return nil, errors.New("compressor strategy has no decompressor")
+	}
+	return func(data []byte) (interface{}, error) {
+		return reverser.Reverse(data)
+	}, nil
+}
+
+// Execute makes every CompressorFunc a Strategies.Strategy
+func (f CompressorFunc) Execute(value interface{}) (interface{}, error) {
+	return f(value)
+}
+
+// reversibleCompressor is a compressor together with the decompressor that undoes it
+type reversibleCompressor struct {
+	CompressorFunc
+	decompress DecompressorFunc
+}
+
+// Reverse decompresses the []byte, or string, the compressor returned
+func (c reversibleCompressor) Reverse(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		return c.decompress(v)
+	case string:
+		return c.decompress([]byte(v))
 	default:
-		return nil, errors.New("unknown compressor strategy")
+		return nil, fmt.Errorf("can't decompress %T, expected []byte", value)
+	}
+}
+
+func register(name, alias, description string, inputTypes []string, compressor CompressorFunc, decompressor DecompressorFunc) {
+	registration := Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindCompressor,
+			Name:        name,
+			Version:     1,
+			Description: description,
+			InputTypes:  inputTypes,
+			Aliases:     []string{alias},
+		},
+		New: func() Strategies.Strategy { return compressor },
+	}
+	if decompressor != nil {
+		registration.New = func() Strategies.Strategy {
+			return reversibleCompressor{CompressorFunc: compressor, decompress: decompressor}
+		}
 	}
+	Strategies.DefaultRegistry.MustRegister(registration)
+}
+
+// adaptiveName is the name the adaptive compressor is registered under, it doesn't trial itself
+const adaptiveName = "adaptive"
+
+// levelParams are the parameters of the gzip compressors
+var levelParams = []Strategies.ParamSpec{{
+	Name:        "level",
+	Type:        Strategies.ParamInt,
+	Default:     gzip.DefaultCompression,
+	Min:         Strategies.Bound(gzip.HuffmanOnly),
+	Max:         Strategies.Bound(gzip.BestCompression),
+	Description: "gzip level, -1 is the default level and -2 Huffman coding only",
+}}
+
+func init() {
+	any := []string{"any"}
+	register("gob", "v1", "gob encoding of the value, decodes to the types registered with gob.Register", any, CompressorV1, DecompressorV1)
+	register("json", "v2", "JSON encoding of the value, decodes to the types encoding/json decodes to", any, CompressorV2, DecompressorV2)
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindCompressor,
+			Name:        "gzip-json",
+			Version:     1,
+			Description: "gzip of the JSON encoding of the value",
+			InputTypes:  any,
+			Aliases:     []string{"v3"},
+			Params:      levelParams,
+		},
+		NewWithParams: func(params Strategies.Params) (Strategies.Strategy, error) {
+			compressor, err := NewCompressorV3(params.Int("level"))
+			if err != nil {
+				return nil, err
+			}
+			return reversibleCompressor{CompressorFunc: compressor, decompress: DecompressorV3}, nil
+		},
+	})
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindCompressor,
+			Name:        "gzip",
+			Version:     1,
+			Description: "gzip of bytes, streams with bounded memory",
+			InputTypes:  []string{"[]byte", "string", "io.Reader"},
+			Params:      levelParams,
+		},
+		NewWithParams: func(params Strategies.Params) (Strategies.Strategy, error) {
+			return &GzipStream{Level: params.Int("level")}, nil
+		},
+	})
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindCompressor,
+			Name:        adaptiveName,
+			Version:     1,
+			Description: "trials the registered reversible compressors on recent payloads and compresses with the cheapest",
+			InputTypes:  any,
+			Params: []Strategies.ParamSpec{
+				{Name: "candidates", Type: Strategies.ParamString, Default: "", Description: "comma separated compressors to trial, empty trials every reversible one"},
+				{Name: "trial-every", Type: Strategies.ParamInt, Default: 100, Min: Strategies.Bound(1), Description: "payloads between trials"},
+				{Name: "window", Type: Strategies.ParamInt, Default: 8, Min: Strategies.Bound(1), Description: "recent payloads a trial compresses"},
+				{Name: "byte-weight", Type: Strategies.ParamFloat, Default: 1.0, Min: Strategies.Bound(0), Description: "cost of a byte of output"},
+				{Name: "microsecond-weight", Type: Strategies.ParamFloat, Default: 0.0, Min: Strategies.Bound(0), Description: "cost of a microsecond of compression"},
+			},
+		},
+		NewWithParams: func(params Strategies.Params) (Strategies.Strategy, error) {
+			var candidates []string
+			for _, candidate := range strings.Split(params.String("candidates"), ",") {
+				if candidate = strings.TrimSpace(candidate); candidate != "" {
+					candidates = append(candidates, candidate)
+				}
+			}
+			return NewAdaptiveCompressor(AdaptiveOptions{
+				Candidates: candidates,
+				TrialEvery: params.Int("trial-every"),
+				Window:     params.Int("window"),
+				Cost:       WeightedCost(params.Float("byte-weight"), params.Float("microsecond-weight")),
+			})
+		},
+	})
+	register("reverse", "v4", "the %v string of the value reversed, decodes to a string", any, CompressorV4, DecompressorV4)
+	register("delta-of-delta", "v5", "delta-of-delta encoding of timestamps", []string{"[]time.Time", "[]int64"}, CompressorV5, DecompressorV5)
+	register("gorilla", "v6", "Gorilla XOR encoding of floats, with delta-of-delta timestamps for points", []string{"[]float64", "[]Point"}, CompressorV6, DecompressorV6)
+	register("rle", "v7", "run-length encoding of booleans, strings and integers such as states", []string{"[]bool", "[]string", "[]int"}, CompressorV7, DecompressorV7)
 }
@@ -3,18 +3,16 @@ package CompressorStrategies
 import (
 	"bytes"
 	"compress/gzip"
-	"encoding/gob"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 )
 
 type CompressorFunc func(interface{}) (interface{}, error)
 
 func CompressorV1(value interface{}) (interface{}, error) {
 	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(value); err != nil {
+	if err := EncodeV1(&buf, value); err != nil {
 		fmt.Println("Error encoding data:", err)
 		return nil, errors.New("error encoding data")
 	}
@@ -25,30 +23,35 @@ func CompressorV1(value interface{}) (interface{}, error) {
 
 // CompressorV2 represents the second version of the compressor.
 func CompressorV2(value interface{}) (interface{}, error) {
-	compressedData, err := json.Marshal(value)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := EncodeV2(&buf, value); err != nil {
 		fmt.Println("Error encoding data:", err)
 		return nil, errors.New("error encoding data")
 	}
-	return compressedData, nil
+	// The JSON has no newline at the end, unlike the stream of EncodeV2
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 func CompressorV3(value interface{}) (interface{}, error) {
-	var buf bytes.Buffer
-	gzipWriter := gzip.NewWriter(&buf)
-	defer gzipWriter.Close()
+	return gzipJSON(value, gzip.DefaultCompression)
+}
 
-	data, err := json.Marshal(value)
-	if err != nil {
-		fmt.Println("Error encoding data:", err)
-		return nil, errors.New("error encoding data")
+// NewCompressorV3 returns CompressorV3 with a gzip level from gzip.HuffmanOnly to gzip.BestCompression
+func NewCompressorV3(level int) (CompressorFunc, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
 	}
+	return func(value interface{}) (interface{}, error) {
+		return gzipJSON(value, level)
+	}, nil
+}
 
-	if _, err := gzipWriter.Write(data); err != nil {
+func gzipJSON(value interface{}, level int) (interface{}, error) {
+	var buf bytes.Buffer
+	if err := EncodeV3(&buf, value, level); err != nil {
 		fmt.Println("Error compressing data:", err)
 		return nil, errors.New("error compressing data")
 	}
-
 	return buf.Bytes(), nil
 }
 
@@ -65,6 +68,26 @@ func CompressorV4(value interface{}) (interface{}, error) {
 	return []byte(reversed), nil
 }
 
+// DecompressorV1 decodes the gob of CompressorV1
+func DecompressorV1(data []byte) (interface{}, error) {
+	return DecodeV1(bytes.NewReader(data))
+}
+
+// DecompressorV2 decodes the JSON of CompressorV2 into the types encoding/json decodes to
+func DecompressorV2(data []byte) (interface{}, error) {
+	return DecodeV2(bytes.NewReader(data))
+}
+
+// DecompressorV3 decompresses the output of CompressorV3 and decodes it like DecompressorV2
+func DecompressorV3(data []byte) (interface{}, error) {
+	return DecodeV3(bytes.NewReader(data))
+}
+
+// DecompressorV4 reverses the string of CompressorV4 back, values that weren't strings come back as their %v string
+func DecompressorV4(data []byte) (interface{}, error) {
+	return reverseString(string(data)), nil
+}
+
 func reverseString(s string) string {
 	runes := []rune(s)
 	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
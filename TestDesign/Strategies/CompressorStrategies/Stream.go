@@ -0,0 +1,115 @@
+package CompressorStrategies
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mcs/TestDesign/Strategies"
+	"time"
+)
+
+/*
+This file contains the streaming form of the compressors, CompressorV1 ... CompressorV3 and their decompressors are
+built on it. EncodeV3 writes the gzip stream to w as it is produced, and DecodeV3 decodes the JSON while it is
+decompressed, so neither holds the compressed and the uncompressed form in memory at the same time.
+
+GzipStream compresses streams of bytes, such as image snapshots or historian exports, in bounded memory.
+*/
+
+func init() {
+	// The types encoding/json decodes to and the types the time-series compressors take, so CompressorV1 can
+	// encode the same values as the other compressors
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+	gob.Register([]time.Time{})
+	gob.Register(Point{})
+	gob.Register([]Point{})
+}
+
+// EncodeV1 writes the gob encoding of value to w. The value is encoded as an interface, so DecodeV1 can decode it
+// without knowing its type; types other than the basic ones have to be registered with gob.Register.
+func EncodeV1(w io.Writer, value interface{}) error {
+	return gob.NewEncoder(w).Encode(&value)
+}
+
+// DecodeV1 decodes the next value EncodeV1 wrote to r
+func DecodeV1(r io.Reader) (interface{}, error) {
+	var value interface{}
+	if err := gob.NewDecoder(r).Decode(&value); err != nil {
+		return nil, fmt.Errorf("error decoding data: %w", err)
+	}
+	return value, nil
+}
+
+// EncodeV2 writes the JSON of value to w, followed by a newline so a stream of values can be decoded one by one
+func EncodeV2(w io.Writer, value interface{}) error {
+	return json.NewEncoder(w).Encode(value)
+}
+
+// DecodeV2 decodes the next JSON value of r into the types encoding/json decodes to
+func DecodeV2(r io.Reader) (interface{}, error) {
+	var value interface{}
+	if err := json.NewDecoder(r).Decode(&value); err != nil {
+		return nil, fmt.Errorf("error decoding data: %w", err)
+	}
+	return value, nil
+}
+
+// EncodeV3 writes the gzip of the JSON of value to w with a gzip level
+func EncodeV3(w io.Writer, value interface{}, level int) error {
+	gzipWriter, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	if err := EncodeV2(gzipWriter, value); err != nil {
+		gzipWriter.Close()
+		return err
+	}
+	// Close flushes the rest of the gzip stream
+	return gzipWriter.Close()
+}
+
+// DecodeV3 decompresses r and decodes the JSON in it like DecodeV2
+func DecodeV3(r io.Reader) (interface{}, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing data: %w", err)
+	}
+	defer gzipReader.Close()
+	value, err := DecodeV2(gzipReader)
+	if err != nil {
+		return nil, err
+	}
+	// Read the gzip stream to its end, only then is its checksum verified and a truncated stream detected
+	if _, err := io.Copy(io.Discard, gzipReader); err != nil {
+		return nil, fmt.Errorf("error decompressing data: %w", err)
+	}
+	return value, nil
+}
+
+// GzipStream compresses bytes with gzip. Level is a gzip level, the zero value is gzip.NoCompression like it is
+// for gzip.NewWriterLevel.
+type GzipStream struct {
+	Level int
+}
+
+func (g *GzipStream) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, g.Level)
+}
+
+func (g *GzipStream) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// Execute compresses []byte, a string or an io.Reader, and any other value as its %v string
+func (g *GzipStream) Execute(value interface{}) (interface{}, error) {
+	return Strategies.ExecuteStream(g, value)
+}
+
+// Reverse decompresses to []byte
+func (g *GzipStream) Reverse(value interface{}) (interface{}, error) {
+	return Strategies.ReverseStream(g, value)
+}
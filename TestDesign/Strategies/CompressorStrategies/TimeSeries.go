@@ -0,0 +1,543 @@
+package CompressorStrategies
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"reflect"
+	"time"
+)
+
+/*
+This file contains the compressors for batches of time-series samples, each with a decoder that restores the batch:
+
+    CompressorV5    delta-of-delta encoding of timestamps, for []time.Time and []int64
+    CompressorV6    Gorilla XOR encoding of floats, for []float64 and for []Point whose timestamps use CompressorV5's encoding
+    CompressorV7    run-length encoding, for []bool, slices of integers such as states, and []string
+
+The encodings follow the Gorilla paper (Pelkonen et al., 2015). Regularly sampled timestamps cost a single bit per
+sample, slowly changing floats a few bits, and runs of equal booleans or states a few bytes per run.
+*/
+
+// DecompressorFunc restores the value a compressor was given from its output
+type DecompressorFunc func([]byte) (interface{}, error)
+
+// Point is a single sample of a time series
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// The first byte of the output of V5, V6 and V7 tells the decoder what kind of slice was compressed
+const (
+	kindTimes byte = iota
+	kindInt64s
+	kindFloats
+	kindPoints
+	kindBools
+	kindInts
+	kindStrings
+)
+
+// timestampUnits are tried from coarse to fine, timestamps are stored as a multiple of the coarsest unit that
+// divides all of them
+var timestampUnits = []int64{int64(time.Second), int64(time.Millisecond), int64(time.Microsecond), 1}
+
+// CompressorV5 encodes timestamps as the difference between consecutive deltas
+func CompressorV5(value interface{}) (interface{}, error) {
+	var kind byte
+	var values []int64
+	switch v := value.(type) {
+	case []time.Time:
+		kind = kindTimes
+		var err error
+		if values, err = unixNanos(v); err != nil {
+			return nil, err
+		}
+	case []int64:
+		kind = kindInt64s
+		values = v
+	default:
+		return nil, fmt.Errorf("compressor v5 expects []time.Time or []int64, got %T", value)
+	}
+
+	unit := commonUnit(values)
+	header := appendHeader(nil, kind, len(values))
+	header = append(header, byte(unit))
+	w := &bitWriter{}
+	encodeTimestamps(w, values, timestampUnits[unit])
+	return append(header, w.bytes()...), nil
+}
+
+// DecompressorV5 decodes the output of CompressorV5 into []time.Time or []int64
+func DecompressorV5(data []byte) (interface{}, error) {
+	kind, count, rest, err := readHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if kind != kindTimes && kind != kindInt64s {
+		return nil, fmt.Errorf("data wasn't compressed by compressor v5")
+	}
+	if len(rest) < 1 || int(rest[0]) >= len(timestampUnits) {
+		return nil, errShortData
+	}
+	values, err := decodeTimestamps(&bitReader{data: rest[1:]}, count, timestampUnits[rest[0]])
+	if err != nil {
+		return nil, err
+	}
+	if kind == kindTimes {
+		return fromUnixNanos(values), nil
+	}
+	return values, nil
+}
+
+// CompressorV6 encodes floats as the XOR with the previous value
+func CompressorV6(value interface{}) (interface{}, error) {
+	w := &bitWriter{}
+	switch v := value.(type) {
+	case []float64:
+		header := appendHeader(nil, kindFloats, len(v))
+		encodeFloats(w, v)
+		return append(header, w.bytes()...), nil
+	case []Point:
+		times := make([]time.Time, len(v))
+		floats := make([]float64, len(v))
+		for i, point := range v {
+			times[i] = point.Time
+			floats[i] = point.Value
+		}
+		nanos, err := unixNanos(times)
+		if err != nil {
+			return nil, err
+		}
+		unit := commonUnit(nanos)
+		header := append(appendHeader(nil, kindPoints, len(v)), byte(unit))
+		encodeTimestamps(w, nanos, timestampUnits[unit])
+		encodeFloats(w, floats)
+		return append(header, w.bytes()...), nil
+	default:
+		return nil, fmt.Errorf("compressor v6 expects []float64 or []Point, got %T", value)
+	}
+}
+
+// DecompressorV6 decodes the output of CompressorV6 into []float64 or []Point
+func DecompressorV6(data []byte) (interface{}, error) {
+	kind, count, rest, err := readHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case kindFloats:
+		return decodeFloats(&bitReader{data: rest}, count)
+	case kindPoints:
+		if len(rest) < 1 || int(rest[0]) >= len(timestampUnits) {
+			return nil, errShortData
+		}
+		r := &bitReader{data: rest[1:]}
+		times, err := decodeTimestamps(r, count, timestampUnits[rest[0]])
+		if err != nil {
+			return nil, err
+		}
+		floats, err := decodeFloats(r, count)
+		if err != nil {
+			return nil, err
+		}
+		points := make([]Point, count)
+		for i := range points {
+			points[i] = Point{Time: time.Unix(0, times[i]).UTC(), Value: floats[i]}
+		}
+		return points, nil
+	default:
+		return nil, fmt.Errorf("data wasn't compressed by compressor v6")
+	}
+}
+
+// CompressorV7 stores runs of equal values as the value and the length of the run
+func CompressorV7(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []bool:
+		// Runs of booleans alternate, so only the first value is stored
+		data := appendHeader(nil, kindBools, len(v))
+		if len(v) == 0 {
+			return data, nil
+		}
+		data = append(data, boolByte(v[0]))
+		for start := 0; start < len(v); {
+			end := start
+			for end < len(v) && v[end] == v[start] {
+				end++
+			}
+			data = binary.AppendUvarint(data, uint64(end-start))
+			start = end
+		}
+		return data, nil
+	case []string:
+		data := appendHeader(nil, kindStrings, len(v))
+		for start := 0; start < len(v); {
+			end := start
+			for end < len(v) && v[end] == v[start] {
+				end++
+			}
+			data = binary.AppendUvarint(data, uint64(len(v[start])))
+			data = append(data, v[start]...)
+			data = binary.AppendUvarint(data, uint64(end-start))
+			start = end
+		}
+		return data, nil
+	}
+
+	// Any slice of integers, which includes slices of states
+	slice := reflect.ValueOf(value)
+	if slice.Kind() != reflect.Slice || !isInteger(slice.Type().Elem().Kind()) {
+		return nil, fmt.Errorf("compressor v7 expects []bool, []string or a slice of integers, got %T", value)
+	}
+	data := appendHeader(nil, kindInts, slice.Len())
+	for start := 0; start < slice.Len(); {
+		current := integerAt(slice, start)
+		end := start
+		for end < slice.Len() && integerAt(slice, end) == current {
+			end++
+		}
+		data = binary.AppendVarint(data, current)
+		data = binary.AppendUvarint(data, uint64(end-start))
+		start = end
+	}
+	return data, nil
+}
+
+// DecompressorV7 decodes the output of CompressorV7 into []bool, []string or, for any slice of integers, []int64
+func DecompressorV7(data []byte) (interface{}, error) {
+	kind, count, rest, err := readHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	// A run takes at least a byte, so the values are allocated as the runs are read rather than trusting the count
+	// in the header, which would let a few forged bytes allocate gigabytes
+	switch kind {
+	case kindBools:
+		values := make([]bool, 0, min(count, len(rest)))
+		if count == 0 {
+			return values, nil
+		}
+		if len(rest) < 1 {
+			return nil, errShortData
+		}
+		current := rest[0] == 1
+		rest = rest[1:]
+		for len(values) < count {
+			run, n := binary.Uvarint(rest)
+			if n <= 0 || run > uint64(count-len(values)) {
+				return nil, errShortData
+			}
+			rest = rest[n:]
+			for i := uint64(0); i < run; i++ {
+				values = append(values, current)
+			}
+			current = !current
+		}
+		return values, nil
+	case kindStrings:
+		values := make([]string, 0, min(count, len(rest)))
+		for len(values) < count {
+			length, n := binary.Uvarint(rest)
+			if n <= 0 || uint64(len(rest)-n) < length {
+				return nil, errShortData
+			}
+			current := string(rest[n : n+int(length)])
+			rest = rest[n+int(length):]
+			run, n := binary.Uvarint(rest)
+			if n <= 0 || run > uint64(count-len(values)) {
+				return nil, errShortData
+			}
+			rest = rest[n:]
+			for i := uint64(0); i < run; i++ {
+				values = append(values, current)
+			}
+		}
+		return values, nil
+	case kindInts:
+		values := make([]int64, 0, min(count, len(rest)))
+		for len(values) < count {
+			current, n := binary.Varint(rest)
+			if n <= 0 {
+				return nil, errShortData
+			}
+			rest = rest[n:]
+			run, n := binary.Uvarint(rest)
+			if n <= 0 || run > uint64(count-len(values)) {
+				return nil, errShortData
+			}
+			rest = rest[n:]
+			for i := uint64(0); i < run; i++ {
+				values = append(values, current)
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("data wasn't compressed by compressor v7")
+	}
+}
+
+func appendHeader(data []byte, kind byte, count int) []byte {
+	data = append(data, kind)
+	return binary.AppendUvarint(data, uint64(count))
+}
+
+func readHeader(data []byte) (kind byte, count int, rest []byte, err error) {
+	if len(data) < 1 {
+		return 0, 0, nil, errShortData
+	}
+	n64, n := binary.Uvarint(data[1:])
+	if n <= 0 || n64 > math.MaxInt32 {
+		return 0, 0, nil, errors.New("invalid sample count")
+	}
+	return data[0], int(n64), data[1+n:], nil
+}
+
+// commonUnit returns the index of the coarsest timestamp unit that divides every value
+func commonUnit(values []int64) int {
+	for i, unit := range timestampUnits {
+		divides := true
+		for _, value := range values {
+			if value%unit != 0 {
+				divides = false
+				break
+			}
+		}
+		if divides {
+			return i
+		}
+	}
+	return len(timestampUnits) - 1
+}
+
+// dodBuckets are the sizes a delta of deltas is stored in, after a prefix of as many one bits as its index plus
+// a closing zero bit; the last bucket has no closing bit
+var dodBuckets = []int{0, 7, 9, 12, 32, 64}
+
+func encodeTimestamps(w *bitWriter, values []int64, unit int64) {
+	var previous, previousDelta int64
+	for i, value := range values {
+		value /= unit
+		if i == 0 {
+			w.writeBits(uint64(value), 64)
+			previous = value
+			continue
+		}
+		delta := value - previous
+		dod := delta - previousDelta
+		for bucket, size := range dodBuckets {
+			last := bucket == len(dodBuckets)-1
+			if !last && !fitsSigned(dod, size) {
+				continue
+			}
+			for j := 0; j < bucket; j++ {
+				w.writeBit(true)
+			}
+			if !last {
+				w.writeBit(false)
+			}
+			w.writeBits(uint64(dod), size)
+			break
+		}
+		previous, previousDelta = value, delta
+	}
+}
+
+func decodeTimestamps(r *bitReader, count int, unit int64) ([]int64, error) {
+	// Every timestamp takes at least a bit, the count in the header can't be trusted further than that
+	values := make([]int64, 0, min(count, r.remaining()))
+	var previous, previousDelta int64
+	for i := 0; i < count; i++ {
+		if i == 0 {
+			first, err := r.readBits(64)
+			if err != nil {
+				return nil, err
+			}
+			previous = int64(first)
+			values = append(values, previous*unit)
+			continue
+		}
+		bucket := 0
+		for bucket < len(dodBuckets)-1 {
+			bit, err := r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if !bit {
+				break
+			}
+			bucket++
+		}
+		raw, err := r.readBits(dodBuckets[bucket])
+		if err != nil {
+			return nil, err
+		}
+		dod := signExtend(raw, dodBuckets[bucket])
+		delta := previousDelta + dod
+		previous += delta
+		previousDelta = delta
+		values = append(values, previous*unit)
+	}
+	return values, nil
+}
+
+func encodeFloats(w *bitWriter, values []float64) {
+	var previous uint64
+	leading, trailing := -1, 0
+	for i, value := range values {
+		current := math.Float64bits(value)
+		if i == 0 {
+			w.writeBits(current, 64)
+			previous = current
+			continue
+		}
+		xor := current ^ previous
+		previous = current
+		if xor == 0 {
+			w.writeBit(false)
+			continue
+		}
+		w.writeBit(true)
+		currentLeading := bits.LeadingZeros64(xor)
+		if currentLeading > 31 {
+			currentLeading = 31
+		}
+		currentTrailing := bits.TrailingZeros64(xor)
+		if leading >= 0 && currentLeading >= leading && currentTrailing >= trailing {
+			// The meaningful bits fit in the window of the previous value
+			w.writeBit(false)
+			w.writeBits(xor>>uint(trailing), 64-leading-trailing)
+			continue
+		}
+		leading, trailing = currentLeading, currentTrailing
+		length := 64 - leading - trailing
+		w.writeBit(true)
+		w.writeBits(uint64(leading), 5)
+		// A length of 64 doesn't fit in 6 bits and is stored as 0
+		w.writeBits(uint64(length&63), 6)
+		w.writeBits(xor>>uint(trailing), length)
+	}
+}
+
+func decodeFloats(r *bitReader, count int) ([]float64, error) {
+	values := make([]float64, 0, min(count, r.remaining()))
+	var previous uint64
+	leading, trailing := 0, 0
+	for i := 0; i < count; i++ {
+		if i == 0 {
+			first, err := r.readBits(64)
+			if err != nil {
+				return nil, err
+			}
+			previous = first
+			values = append(values, math.Float64frombits(previous))
+			continue
+		}
+		changed, err := r.readBit()
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			newWindow, err := r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if newWindow {
+				l, err := r.readBits(5)
+				if err != nil {
+					return nil, err
+				}
+				length, err := r.readBits(6)
+				if err != nil {
+					return nil, err
+				}
+				if length == 0 {
+					length = 64
+				}
+				leading = int(l)
+				trailing = 64 - leading - int(length)
+				if trailing < 0 {
+					return nil, errors.New("invalid float encoding")
+				}
+			}
+			meaningful, err := r.readBits(64 - leading - trailing)
+			if err != nil {
+				return nil, err
+			}
+			previous ^= meaningful << uint(trailing)
+		}
+		values = append(values, math.Float64frombits(previous))
+	}
+	return values, nil
+}
+
+func fitsSigned(value int64, size int) bool {
+	if size == 0 {
+		return value == 0
+	}
+	limit := int64(1) << uint(size-1)
+	return value >= -limit && value < limit
+}
+
+func signExtend(value uint64, size int) int64 {
+	if size == 0 || size == 64 {
+		return int64(value)
+	}
+	shift := uint(64 - size)
+	return int64(value<<shift) >> shift
+}
+
+// minTime and maxTime are the range of time.Time.UnixNano, the years 1677 to 2262
+var (
+	minTime = time.Unix(0, math.MinInt64)
+	maxTime = time.Unix(0, math.MaxInt64)
+)
+
+// unixNanos returns the Unix time in nanoseconds of every time, it fails for a time that doesn't fit, such as the
+// zero time.Time
+func unixNanos(times []time.Time) ([]int64, error) {
+	values := make([]int64, len(times))
+	for i, t := range times {
+		if t.Before(minTime) || t.After(maxTime) {
+			return nil, fmt.Errorf("time %d, %s, is outside of the years 1677 to 2262 that can be encoded", i, t)
+		}
+		values[i] = t.UnixNano()
+	}
+	return values, nil
+}
+
+func fromUnixNanos(values []int64) []time.Time {
+	times := make([]time.Time, len(values))
+	for i, value := range values {
+		times[i] = time.Unix(0, value).UTC()
+	}
+	return times
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return true
+	default:
+		return false
+	}
+}
+
+func integerAt(slice reflect.Value, i int) int64 {
+	element := slice.Index(i)
+	if element.CanInt() {
+		return element.Int()
+	}
+	return int64(element.Uint())
+}
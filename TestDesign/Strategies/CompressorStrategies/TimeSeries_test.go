@@ -0,0 +1,37 @@
+package CompressorStrategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeSeriesRejectsTimesOutsideOfUnixNanos(t *testing.T) {
+	if _, err := CompressorV6([]Point{{Value: 1}}); err == nil {
+		t.Fatal("compressed a point with the zero time")
+	}
+	if _, err := CompressorV5([]time.Time{time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)}); err == nil {
+		t.Fatal("compressed a time after 2262")
+	}
+}
+
+func TestTimeSeriesRoundTripsPoints(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	points := []Point{{start, 1.5}, {start.Add(time.Second), 1.75}, {start.Add(2 * time.Second), 1.75}}
+	output, err := CompressorV6(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecompressorV6(output.([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := decoded.([]Point)
+	if !ok || len(restored) != len(points) {
+		t.Fatalf("decoded %#v, expected %d points", decoded, len(points))
+	}
+	for i, point := range restored {
+		if !point.Time.Equal(points[i].Time) || point.Value != points[i].Value {
+			t.Fatalf("point %d decoded to %v, expected %v", i, point, points[i])
+		}
+	}
+}
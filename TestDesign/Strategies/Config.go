@@ -0,0 +1,41 @@
+package Strategies
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config selects a strategy and its parameters, as stored in a config file:
+//
+//	{"compressor": {"kind": "compressor", "strategy": "gzip-json", "params": {"level": 9}}}
+type Config struct {
+	Kind     string                 `json:"kind"`
+	Strategy string                 `json:"strategy"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+}
+
+// Create creates the strategy from DefaultRegistry
+func (c Config) Create() (Strategy, error) {
+	return DefaultRegistry.CreateWithParams(c.Kind, c.Strategy, c.Params)
+}
+
+// LoadConfigs reads a JSON file with a Config per name, such as a module id. Every config is validated, so a
+// config file with a wrong parameter is rejected when it is loaded rather than when the strategy is used.
+// MasterController.ConfigureStrategies applies configs per module id, `mcs demo -strategies` loads them.
+func LoadConfigs(path string) (map[string]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading strategy config: %w", err)
+	}
+	var configs map[string]Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error decoding strategy config %s: %w", path, err)
+	}
+	for name, config := range configs {
+		if _, err := config.Create(); err != nil {
+			return nil, fmt.Errorf("strategy config %s: %w", name, err)
+		}
+	}
+	return configs, nil
+}
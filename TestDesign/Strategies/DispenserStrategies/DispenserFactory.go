@@ -2,22 +2,164 @@ package DispenserStrategies
 
 import (
 	"errors"
+	"fmt"
 	"mcs/TestDesign/Strategies"
+	"os"
 )
 
+// DispenserStrategyFactory creates the dispenser strategies registered in Strategies.DefaultRegistry
 type DispenserStrategyFactory struct{}
 
 func (f *DispenserStrategyFactory) CreateStrategy(identifier string) (Strategies.Strategy, error) {
-	switch identifier {
-	case "v1":
-		return &DispenserV1{}, nil
-	case "v2":
-		return &DispenserV2{}, nil
-	case "v3":
-		return &DispenserV3{}, nil
-	case "v4":
-		return &DispenserV4{}, nil
+	return Strategies.Create(Strategies.KindDispenser, identifier)
+}
+
+// List returns the descriptors of the dispenser strategies that are registered
+func (f *DispenserStrategyFactory) List() []Strategies.Descriptor {
+	return Strategies.List(Strategies.KindDispenser)
+}
+
+func (f *DispenserStrategyFactory) CreateStrategyWithParams(identifier string, params map[string]interface{}) (Strategies.Strategy, error) {
+	return Strategies.CreateWithParams(Strategies.KindDispenser, identifier, params)
+}
+
+// Register adds a dispenser strategy, so other packages can add their own
+func (f *DispenserStrategyFactory) Register(registration Strategies.Registration) error {
+	registration.Kind = Strategies.KindDispenser
+	return Strategies.Register(registration)
+}
+
+func register(name, alias, description string, strategy func() Strategies.Strategy) {
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindDispenser,
+			Name:        name,
+			Version:     1,
+			Description: description,
+			InputTypes:  []string{"any"},
+			Aliases:     []string{alias},
+		},
+		New: strategy,
+	})
+}
+
+// hashParams are the parameters of the hash dispensers
+var hashParams = []Strategies.ParamSpec{
+	{Name: "salt", Type: Strategies.ParamString, Default: "", Description: "prepended to the string before it is hashed"},
+	{Name: "encoding", Type: Strategies.ParamString, Default: "hex", Enum: []string{"hex", "base64"}, Description: "encoding of the hash"},
+}
+
+func registerHash(name, alias, description string, strategy func(salt, encoding string) Strategies.Strategy) {
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindDispenser,
+			Name:        name,
+			Version:     1,
+			Description: description,
+			InputTypes:  []string{"any"},
+			Aliases:     []string{alias},
+			Params:      hashParams,
+		},
+		NewWithParams: func(params Strategies.Params) (Strategies.Strategy, error) {
+			return strategy(params.String("salt"), params.String("encoding")), nil
+		},
+	})
+}
+
+// keyedParams are the parameters of the keyed dispensers in Signing.go
+var keyedParams = []Strategies.ParamSpec{
+	{Name: "keystore", Type: Strategies.ParamString, Required: true, Description: "path of the keystore file"},
+	{Name: "key", Type: Strategies.ParamString, Default: "", Description: "id of the key that signs, empty is the active key"},
+}
+
+func registerKeyed(name, alias, description string, strategy func(keystore *Keystore, keyID string) Strategies.Strategy) {
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindDispenser,
+			Name:        name,
+			Version:     1,
+			Description: description,
+			InputTypes:  []string{"any"},
+			Aliases:     []string{alias},
+			Params:      keyedParams,
+		},
+		NewWithParams: func(params Strategies.Params) (Strategies.Strategy, error) {
+			keystore, err := sharedKeystore(params.String("keystore"))
+			if err != nil {
+				return nil, err
+			}
+			return strategy(keystore, params.String("key")), nil
+		},
+	})
+}
+
+var encryptionParams = []Strategies.ParamSpec{
+	{Name: "passphrase", Type: Strategies.ParamString, Default: "", Secret: true, Description: "passphrase the key is derived from"},
+	{Name: "passphrase-env", Type: Strategies.ParamString, Default: "", Description: "environment variable with the passphrase, keeps it out of config files"},
+	{Name: "key-file", Type: Strategies.ParamString, Default: "", Description: "file with a hex key, instead of a passphrase"},
+	{Name: "kdf", Type: Strategies.ParamString, Default: KDFArgon2id, Enum: []string{KDFArgon2id, KDFScrypt}, Description: "derivation of the key from the passphrase"},
+	{Name: "encoding", Type: Strategies.ParamString, Default: "base64", Enum: []string{"raw", "base64"}, Description: "base64 text or raw bytes"},
+}
+
+func newEncryption(params Strategies.Params) (Strategies.Strategy, error) {
+	passphrase := params.String("passphrase")
+	if name := params.String("passphrase-env"); name != "" {
+		passphrase = os.Getenv(name)
+		if passphrase == "" {
+			return nil, fmt.Errorf("environment variable %s has no passphrase", name)
+		}
+	}
+	var dispenser *EncryptionDispenser
+	var err error
+	switch keyFile := params.String("key-file"); {
+	case keyFile != "" && passphrase != "":
+		return nil, errors.New("encryption takes a passphrase or a key file, not both")
+	case keyFile != "":
+		var key []byte
+		if key, err = LoadKeyFile(keyFile); err == nil {
+			dispenser, err = NewKeyEncryption(key)
+		}
+	case passphrase != "":
+		dispenser, err = NewPassphraseEncryption(passphrase, params.String("kdf"))
 	default:
-		return nil, errors.New("unknown compressor strategy")
+		return nil, errors.New("encryption needs a passphrase, passphrase-env or key-file")
 	}
+	if err != nil {
+		return nil, err
+	}
+	dispenser.Base64 = params.String("encoding") == "base64"
+	return dispenser, nil
+}
+
+func init() {
+	register("base64", "v1", "base64 of the %v string of the value, decodes to a string", func() Strategies.Strategy { return &DispenserV1{} })
+	registerHash("sha256", "v2", "SHA-256 hash of the %v string of the value", func(salt, encoding string) Strategies.Strategy {
+		return &DispenserV2{Salt: salt, Encoding: encoding}
+	})
+	registerHash("sha512", "v3", "SHA-512 hash of the %v string of the value", func(salt, encoding string) Strategies.Strategy {
+		return &DispenserV3{Salt: salt, Encoding: encoding}
+	})
+	register("upper", "v4", "the %v string of the value in upper case", func() Strategies.Strategy { return &DispenserV4{} })
+	registerKeyed("hmac-sha256", "v5", "HMAC-SHA256 of the %v string of the value, as key id:tag", func(keystore *Keystore, keyID string) Strategies.Strategy {
+		return &HMACDispenser{Keystore: keystore, Hash: "sha256", KeyID: keyID}
+	})
+	registerKeyed("hmac-sha512", "v6", "HMAC-SHA512 of the %v string of the value, as key id:tag", func(keystore *Keystore, keyID string) Strategies.Strategy {
+		return &HMACDispenser{Keystore: keystore, Hash: "sha512", KeyID: keyID}
+	})
+	registerKeyed("ed25519", "v7", "ed25519 signature of the %v string of the value, as key id:signature", func(keystore *Keystore, keyID string) Strategies.Strategy {
+		return &Ed25519Dispenser{Keystore: keystore, KeyID: keyID}
+	})
+	Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+		Descriptor: Strategies.Descriptor{
+			Kind:        Strategies.KindDispenser,
+			Name:        "xchacha20-poly1305",
+			Version:     1,
+			Description: "XChaCha20-Poly1305 encryption of the value, []byte or the %v string",
+			Reversible:  true,
+			InputTypes:  []string{"any"},
+			Aliases:     []string{"v8"},
+			Params:      encryptionParams,
+		},
+		NewWithParams: newEncryption,
+	})
 }
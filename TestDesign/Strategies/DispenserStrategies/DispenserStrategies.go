@@ -6,31 +6,124 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
+	"mcs/TestDesign/Strategies"
 	"strings"
 )
 
 type DispenserV1 struct{}
 
 func (d *DispenserV1) Execute(value interface{}) (interface{}, error) {
-	str := fmt.Sprintf("%v", value)
-	encoded := base64.StdEncoding.EncodeToString([]byte(str))
-	return encoded, nil
+	encoded, err := Strategies.ExecuteStream(d, dispensed(value))
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Reverse decodes the base64 back to the string that was encoded
+func (d *DispenserV1) Reverse(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case string, []byte:
+	default:
+		return nil, fmt.Errorf("can't decode %T, expected a base64 string", value)
+	}
+	decoded, err := Strategies.ReverseStream(d, value)
+	if err != nil {
+		return nil, err
+	}
+	return string(decoded), nil
 }
 
-type DispenserV2 struct{}
+func (d *DispenserV1) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return base64.NewEncoder(base64.StdEncoding, w), nil
+}
+
+func (d *DispenserV1) NewReader(r io.Reader) (io.Reader, error) {
+	return base64.NewDecoder(base64.StdEncoding, r), nil
+}
+
+// DispenserV2 hashes with SHA-256, the zero value hashes without a salt and returns hex
+type DispenserV2 struct {
+	// Salt is prepended to the string before it is hashed
+	Salt string
+	// Encoding is "hex" or "base64", empty is hex
+	Encoding string
+}
 
 func (d *DispenserV2) Execute(value interface{}) (interface{}, error) {
-	str := fmt.Sprintf("%v", value)
-	hash := sha256.Sum256([]byte(str))
-	return hex.EncodeToString(hash[:]), nil
+	hash, err := Strategies.ExecuteStream(d, dispensed(value))
+	if err != nil {
+		return nil, err
+	}
+	return string(hash), nil
+}
+
+// NewWriter hashes what is written to it, Close writes the encoded hash to w
+func (d *DispenserV2) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return newHashWriter(w, sha256.New(), d.Salt, d.Encoding)
 }
 
-type DispenserV3 struct{}
+// DispenserV3 hashes with SHA-512, the zero value hashes without a salt and returns hex
+type DispenserV3 struct {
+	Salt     string
+	Encoding string
+}
 
 func (d *DispenserV3) Execute(value interface{}) (interface{}, error) {
-	str := fmt.Sprintf("%v", value)
-	hash := sha512.Sum512([]byte(str))
-	return hex.EncodeToString(hash[:]), nil
+	hash, err := Strategies.ExecuteStream(d, dispensed(value))
+	if err != nil {
+		return nil, err
+	}
+	return string(hash), nil
+}
+
+func (d *DispenserV3) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return newHashWriter(w, sha512.New(), d.Salt, d.Encoding)
+}
+
+// dispensed returns what the dispensers stream for value: an io.Reader as it is, and any other value as its %v
+// string, []byte included, like the dispensers have always done
+func dispensed(value interface{}) interface{} {
+	if reader, ok := value.(io.Reader); ok {
+		return reader
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+type hashWriter struct {
+	hash.Hash
+	w        io.Writer
+	encoding string
+}
+
+func newHashWriter(w io.Writer, h hash.Hash, salt, encoding string) (*hashWriter, error) {
+	if _, err := encodeHash(nil, encoding); err != nil {
+		return nil, err
+	}
+	h.Write([]byte(salt))
+	return &hashWriter{Hash: h, w: w, encoding: encoding}, nil
+}
+
+func (h *hashWriter) Close() error {
+	encoded, err := encodeHash(h.Sum(nil), h.encoding)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(h.w, encoded)
+	return err
+}
+
+func encodeHash(hash []byte, encoding string) (string, error) {
+	switch encoding {
+	case "", "hex":
+		return hex.EncodeToString(hash), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(hash), nil
+	default:
+		return "", fmt.Errorf("unknown hash encoding %q", encoding)
+	}
 }
 
 type DispenserV4 struct{}
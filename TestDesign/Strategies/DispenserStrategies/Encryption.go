@@ -0,0 +1,288 @@
+package DispenserStrategies
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+/*
+This file contains the encrypting dispenser, for special values that are confidential. It encrypts with
+XChaCha20-Poly1305 under a key that is either loaded from a key file or derived from a passphrase with Argon2id or
+scrypt. The output starts with a header that names the key derivation and holds its salt, so Decrypt with the same
+passphrase or key file needs nothing else:
+
+    "MCX" | version | kdf | salt length | salt | plaintext kind | nonce (24 bytes) | ciphertext
+
+The header is authenticated together with the ciphertext, a modified header fails to decrypt like a modified
+ciphertext does. The version selects the Argon2id parameters, ciphertexts of version 1 still decrypt.
+
+The salt of a ciphertext comes from whoever wrote it, so a dispenser caches the keys of only the most recent salts
+that decrypted and runs only a few derivations at a time: every new salt costs a derivation, 64 MiB with Argon2id.
+*/
+
+const (
+	KDFNone     = "none"
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+const (
+	encryptionVersion = 2
+	saltSize          = 16
+	// plaintextBytes and plaintextString record whether Decrypt returns []byte or a string
+	plaintextBytes  = 0
+	plaintextString = 1
+	// derivedKeys is the number of keys a dispenser keeps for the salts of other dispensers
+	derivedKeys = 32
+	// maxDerivations is the number of keys that are derived from passphrases at the same time
+	maxDerivations = 2
+)
+
+var encryptionMagic = []byte("MCX")
+
+// ErrDecrypt is returned when a ciphertext doesn't decrypt, because the key is wrong or the data was modified
+var ErrDecrypt = errors.New("can't decrypt, wrong key or modified data")
+
+var kdfIDs = map[string]byte{KDFNone: 0, KDFArgon2id: 1, KDFScrypt: 2}
+
+// derivations holds a slot for every derivation that runs, it bounds the memory they take
+var derivations = make(chan struct{}, maxDerivations)
+
+// deriveKey derives the 32 byte key from passphrase for a ciphertext of version. Argon2id uses the second set of
+// parameters RFC 9106 recommends, t=3, 64 MiB and 4 lanes, version 1 used a single pass. scrypt uses the
+// parameters golang.org/x/crypto/scrypt recommends for interactive logins, N=2^15, r=8 and p=1.
+func deriveKey(kdf string, version byte, passphrase, salt []byte) ([]byte, error) {
+	derivations <- struct{}{}
+	defer func() { <-derivations }()
+	switch kdf {
+	case KDFArgon2id:
+		passes := uint32(3)
+		if version == 1 {
+			passes = 1
+		}
+		return argon2.IDKey(passphrase, salt, passes, 64*1024, 4, chacha20poly1305.KeySize), nil
+	case KDFScrypt:
+		return scrypt.Key(passphrase, salt, 1<<15, 8, 1, chacha20poly1305.KeySize)
+	default:
+		return nil, fmt.Errorf("unknown key derivation %q", kdf)
+	}
+}
+
+type EncryptionDispenser struct {
+	kdf        string
+	passphrase []byte
+	// salt and key are the key Execute encrypts with, derived once per dispenser
+	salt []byte
+	key  []byte
+	// Base64 makes Execute return base64 text instead of []byte, and Decrypt accept it
+	Base64 bool
+	// derived caches the keys derived for the salts of ciphertexts of other dispensers, most recently used first
+	derived *list.List
+	mu      sync.Mutex
+}
+
+type derivedKey struct {
+	version byte
+	salt    []byte
+	key     []byte
+}
+
+// NewPassphraseEncryption derives a key from passphrase with kdf, KDFArgon2id or KDFScrypt, under a new salt
+func NewPassphraseEncryption(passphrase, kdf string) (*EncryptionDispenser, error) {
+	if passphrase == "" {
+		return nil, errors.New("encryption passphrase is empty")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(kdf, encryptionVersion, []byte(passphrase), salt)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptionDispenser{
+		kdf:        kdf,
+		passphrase: []byte(passphrase),
+		salt:       salt,
+		key:        key,
+		derived:    list.New(),
+	}, nil
+}
+
+// NewKeyEncryption encrypts with a 32 byte key
+func NewKeyEncryption(key []byte) (*EncryptionDispenser, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("encryption key has %d bytes, expected %d", len(key), chacha20poly1305.KeySize)
+	}
+	return &EncryptionDispenser{kdf: KDFNone, key: append([]byte(nil), key...)}, nil
+}
+
+// GenerateKeyFile writes a new random encryption key as hex to path, readable by its owner only
+func GenerateKeyFile(path string) error {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return fmt.Errorf("error writing encryption key: %w", err)
+	}
+	return nil
+}
+
+// LoadKeyFile reads a key written by GenerateKeyFile
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding encryption key %s: %w", path, err)
+	}
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("encryption key %s has %d bytes, expected %d", path, len(key), chacha20poly1305.KeySize)
+	}
+	return key, nil
+}
+
+// Execute encrypts []byte and strings as they are, and any other value as its %v string
+func (d *EncryptionDispenser) Execute(value interface{}) (interface{}, error) {
+	plaintext, kind := []byte(nil), byte(plaintextString)
+	switch v := value.(type) {
+	case []byte:
+		plaintext, kind = v, plaintextBytes
+	case string:
+		plaintext = []byte(v)
+	default:
+		plaintext = []byte(fmt.Sprintf("%v", v))
+	}
+
+	aead, err := chacha20poly1305.NewX(d.key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(nil), encryptionMagic...)
+	header = append(header, encryptionVersion, kdfIDs[d.kdf], byte(len(d.salt)))
+	header = append(header, d.salt...)
+	header = append(header, kind)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	output := append(header, nonce...)
+	output = aead.Seal(output, nonce, plaintext, header)
+	if d.Base64 {
+		return base64.StdEncoding.EncodeToString(output), nil
+	}
+	return output, nil
+}
+
+// Reverse decrypts, it makes the dispenser reversible in pipelines
+func (d *EncryptionDispenser) Reverse(value interface{}) (interface{}, error) {
+	return d.Decrypt(value)
+}
+
+// Decrypt returns the value Execute encrypted, as []byte when it was []byte and as a string otherwise. A dispenser
+// with the same passphrase decrypts the output of every other dispenser with that passphrase, whatever its salt.
+func (d *EncryptionDispenser) Decrypt(value interface{}) (interface{}, error) {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("can't decrypt %T, expected []byte", value)
+	}
+	if d.Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding ciphertext: %w", err)
+		}
+		data = decoded
+	}
+
+	if len(data) < len(encryptionMagic)+3 || !bytes.Equal(data[:len(encryptionMagic)], encryptionMagic) {
+		return nil, errors.New("data wasn't encrypted by an encryption dispenser")
+	}
+	offset := len(encryptionMagic)
+	version, kdfID, saltLength := data[offset], data[offset+1], int(data[offset+2])
+	offset += 3
+	if version < 1 || version > encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %d", version)
+	}
+	if kdfID != kdfIDs[d.kdf] {
+		return nil, fmt.Errorf("%w: data was encrypted with another kind of key", ErrDecrypt)
+	}
+	if len(data) < offset+saltLength+1+chacha20poly1305.NonceSizeX {
+		return nil, ErrDecrypt
+	}
+	salt := data[offset : offset+saltLength]
+	offset += saltLength
+	kind := data[offset]
+	offset++
+	header, nonce, ciphertext := data[:offset], data[offset:offset+chacha20poly1305.NonceSizeX], data[offset+chacha20poly1305.NonceSizeX:]
+
+	key, cached, err := d.keyFor(version, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	if !cached {
+		d.remember(version, salt, key)
+	}
+	if kind == plaintextBytes {
+		return plaintext, nil
+	}
+	return string(plaintext), nil
+}
+
+// keyFor returns the key of a ciphertext of version with salt and whether it is cached. Keys of other salts are
+// derived from the passphrase without holding d.mu, so decrypts under cached keys don't wait for them.
+func (d *EncryptionDispenser) keyFor(version byte, salt []byte) ([]byte, bool, error) {
+	if d.kdf == KDFNone || version == encryptionVersion && bytes.Equal(salt, d.salt) {
+		return d.key, true, nil
+	}
+	d.mu.Lock()
+	for element := d.derived.Front(); element != nil; element = element.Next() {
+		if cached := element.Value.(derivedKey); cached.version == version && bytes.Equal(cached.salt, salt) {
+			d.derived.MoveToFront(element)
+			d.mu.Unlock()
+			return cached.key, true, nil
+		}
+	}
+	d.mu.Unlock()
+
+	key, err := deriveKey(d.kdf, version, d.passphrase, salt)
+	return key, false, err
+}
+
+// remember caches the key of a salt once it decrypted a ciphertext, so forged ciphertexts don't push out the keys
+// of genuine ones
+func (d *EncryptionDispenser) remember(version byte, salt, key []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.derived.PushFront(derivedKey{version: version, salt: append([]byte(nil), salt...), key: key})
+	if d.derived.Len() > derivedKeys {
+		d.derived.Remove(d.derived.Back())
+	}
+}
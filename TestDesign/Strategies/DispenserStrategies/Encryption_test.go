@@ -0,0 +1,110 @@
+package DispenserStrategies
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptionRoundTrips(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	for _, c := range []struct {
+		name      string
+		dispenser func() (*EncryptionDispenser, error)
+		base64    bool
+	}{
+		{"key", func() (*EncryptionDispenser, error) { return NewKeyEncryption(key) }, false},
+		{"key base64", func() (*EncryptionDispenser, error) { return NewKeyEncryption(key) }, true},
+		{"argon2id", func() (*EncryptionDispenser, error) { return NewPassphraseEncryption("hunter2", KDFArgon2id) }, false},
+		{"scrypt", func() (*EncryptionDispenser, error) { return NewPassphraseEncryption("hunter2", KDFScrypt) }, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			encrypter, err := c.dispenser()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Another dispenser with the same key or passphrase, with a salt of its own
+			decrypter, err := c.dispenser()
+			if err != nil {
+				t.Fatal(err)
+			}
+			encrypter.Base64, decrypter.Base64 = c.base64, c.base64
+			for _, value := range []interface{}{"secret value", []byte{0, 1, 2, 255}, ""} {
+				ciphertext, err := encrypter.Execute(value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				plaintext, err := decrypter.Decrypt(ciphertext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(plaintext, value) {
+					t.Fatalf("decrypted %#v, expected %#v", plaintext, value)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	dispenser, err := NewPassphraseEncryption("hunter2", KDFScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := dispenser.Execute("secret value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := output.([]byte)
+	saltStart := len(encryptionMagic) + 3
+	kindOffset := saltStart + saltSize
+	for _, c := range []struct {
+		name   string
+		offset int
+	}{
+		{"salt", saltStart},
+		{"plaintext kind", kindOffset},
+		{"nonce", kindOffset + 1},
+		{"ciphertext", len(ciphertext) - 20},
+		{"tag", len(ciphertext) - 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tampered := append([]byte(nil), ciphertext...)
+			tampered[c.offset] ^= 1
+			if plaintext, err := dispenser.Decrypt(tampered); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("decrypted a modified %s to %#v, %v", c.name, plaintext, err)
+			}
+		})
+	}
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", ciphertext[:len(ciphertext)-1]},
+		{"header only", ciphertext[:kindOffset+1]},
+		{"not encrypted", []byte("secret value")},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if plaintext, err := dispenser.Decrypt(c.data); err == nil {
+				t.Fatalf("decrypted %s data to %#v", c.name, plaintext)
+			}
+		})
+	}
+
+	wrong, err := NewPassphraseEncryption("hunter3", KDFScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Decrypt(ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("decrypting with the wrong passphrase returned %v, expected ErrDecrypt", err)
+	}
+	keyed, err := NewKeyEncryption(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyed.Decrypt(ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("decrypting with a key file returned %v, expected ErrDecrypt", err)
+	}
+}
@@ -0,0 +1,346 @@
+package DispenserStrategies
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+/*
+This file contains the keystore the keyed dispensers sign with. The keystore is a JSON file holding every key that
+was generated, per algorithm the newest key that isn't retired is the active one: it signs, while the older keys are
+kept so the values they signed can still be verified. Rotate generates a new active key, Retire stops a key from
+being accepted at all. Rotate and Retire hold a lock file next to the keystore while they read and write it, so
+keys rotated by several processes at once are all kept.
+*/
+
+const (
+	AlgorithmHMAC    = "hmac"
+	AlgorithmEd25519 = "ed25519"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown key")
+	ErrKeyRetired = errors.New("key is retired")
+	ErrNoKey      = errors.New("keystore has no active key")
+)
+
+type Key struct {
+	ID        string    `json:"id"`
+	Algorithm string    `json:"algorithm"`
+	Created   time.Time `json:"created"`
+	Retired   bool      `json:"retired,omitempty"`
+	// Secret is the HMAC key
+	Secret []byte `json:"-"`
+	// Private is empty in a keystore that only verifies
+	Private ed25519.PrivateKey `json:"-"`
+	Public  ed25519.PublicKey  `json:"-"`
+}
+
+// storedKey is a Key as it is written to the keystore file, with the key material in hex
+type storedKey struct {
+	Key
+	Secret  string `json:"secret,omitempty"`
+	Private string `json:"private,omitempty"`
+	Public  string `json:"public,omitempty"`
+}
+
+type Keystore struct {
+	path string
+	// keys are in the order they were generated
+	keys []Key
+	// modTime and size are those of the file the keys were read from or written to, a file that changed since is
+	// read again, so keys rotated or retired by another process reach this one
+	modTime time.Time
+	size    int64
+	mu      sync.RWMutex
+}
+
+// OpenKeystore reads the keystore at path, a keystore that doesn't exist yet is empty until a key is rotated in
+func OpenKeystore(path string) (*Keystore, error) {
+	ks := &Keystore{path: path}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// load reads the keys from the file of the keystore, ks.mu is held for writing or ks isn't shared yet
+func (ks *Keystore) load() error {
+	info, err := os.Stat(ks.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading keystore: %w", err)
+	}
+	data, err := os.ReadFile(ks.path)
+	if err != nil {
+		return fmt.Errorf("error reading keystore: %w", err)
+	}
+	var stored []storedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("error decoding keystore %s: %w", ks.path, err)
+	}
+	keys := make([]Key, 0, len(stored))
+	for _, s := range stored {
+		key := s.Key
+		if key.Secret, err = hex.DecodeString(s.Secret); err == nil {
+			if key.Private, err = hex.DecodeString(s.Private); err == nil {
+				key.Public, err = hex.DecodeString(s.Public)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding key %s: %w", key.ID, err)
+		}
+		keys = append(keys, key)
+	}
+	ks.keys, ks.modTime, ks.size = keys, info.ModTime(), info.Size()
+	return nil
+}
+
+// changed reports whether the file of the keystore changed since it was read or written
+func (ks *Keystore) changed() bool {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(ks.modTime) || info.Size() != ks.size
+}
+
+// refresh reads the keystore again when its file changed, ks.mu isn't held
+func (ks *Keystore) refresh() error {
+	ks.mu.RLock()
+	changed := ks.changed()
+	ks.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if !ks.changed() {
+		return nil
+	}
+	return ks.load()
+}
+
+var (
+	openKeystores   = make(map[string]*Keystore)
+	openKeystoresMu sync.Mutex
+)
+
+// sharedKeystore opens the keystore at path once, so every strategy created from the registry sees the keys that
+// are rotated in through any of them. Keys rotated or retired by another process, such as mcs keys, are picked up
+// when the file changes.
+func sharedKeystore(path string) (*Keystore, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	openKeystoresMu.Lock()
+	defer openKeystoresMu.Unlock()
+	if ks, ok := openKeystores[absolute]; ok {
+		return ks, nil
+	}
+	ks, err := OpenKeystore(absolute)
+	if err != nil {
+		return nil, err
+	}
+	openKeystores[absolute] = ks
+	return ks, nil
+}
+
+func (ks *Keystore) Path() string {
+	return ks.path
+}
+
+// Rotate generates a new key for algorithm and makes it the active key, the previous keys still verify
+func (ks *Keystore) Rotate(algorithm string) (Key, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	key := Key{ID: algorithm + "-" + hex.EncodeToString(id), Algorithm: algorithm, Created: time.Now().UTC()}
+	switch algorithm {
+	case AlgorithmHMAC:
+		key.Secret = make([]byte, 32)
+		if _, err := rand.Read(key.Secret); err != nil {
+			return Key{}, err
+		}
+	case AlgorithmEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		key.Public, key.Private = public, private
+	default:
+		return Key{}, fmt.Errorf("unknown key algorithm %q", algorithm)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	unlock, err := ks.lock()
+	if err != nil {
+		return Key{}, err
+	}
+	defer unlock()
+	if err := ks.load(); err != nil {
+		return Key{}, err
+	}
+	ks.keys = append(ks.keys, key)
+	if err := ks.save(); err != nil {
+		ks.keys = ks.keys[:len(ks.keys)-1]
+		return Key{}, err
+	}
+	return key, nil
+}
+
+// Retire stops the key with id from signing and verifying
+func (ks *Keystore) Retire(id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	unlock, err := ks.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := ks.load(); err != nil {
+		return err
+	}
+	for i := range ks.keys {
+		if ks.keys[i].ID == id {
+			ks.keys[i].Retired = true
+			return ks.save()
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownKey, id)
+}
+
+// Active returns the newest key of algorithm that isn't retired
+func (ks *Keystore) Active(algorithm string) (Key, error) {
+	if err := ks.refresh(); err != nil {
+		return Key{}, err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].Algorithm == algorithm && !ks.keys[i].Retired {
+			return ks.keys[i], nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w for %s", ErrNoKey, algorithm)
+}
+
+// Key returns the key with id, retired keys are returned together with ErrKeyRetired
+func (ks *Keystore) Key(id string) (Key, error) {
+	if err := ks.refresh(); err != nil {
+		return Key{}, err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID == id {
+			if key.Retired {
+				return key, fmt.Errorf("%w: %s", ErrKeyRetired, id)
+			}
+			return key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w %q", ErrUnknownKey, id)
+}
+
+// Keys returns every key, oldest first
+func (ks *Keystore) Keys() ([]Key, error) {
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	keys := append([]Key(nil), ks.keys...)
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+	return keys, nil
+}
+
+// ExportPublic writes a keystore with only the public ed25519 keys to path, for the parties that verify
+// signatures but shouldn't be able to sign
+func (ks *Keystore) ExportPublic(path string) error {
+	public := &Keystore{path: path}
+	ks.mu.RLock()
+	for _, key := range ks.keys {
+		if key.Algorithm == AlgorithmEd25519 {
+			key.Private = nil
+			public.keys = append(public.keys, key)
+		}
+	}
+	ks.mu.RUnlock()
+	return public.save()
+}
+
+const (
+	// lockTimeout is how long Rotate and Retire wait for another process to release the keystore
+	lockTimeout = 5 * time.Second
+	// staleLock is the age after which a lock file is taken to be left behind by a process that died
+	staleLock = time.Minute
+)
+
+// lock creates the lock file of the keystore, so processes that rotate or retire keys at the same time don't
+// overwrite each other's keys. The returned function removes it again.
+func (ks *Keystore) lock() (func(), error) {
+	path := ks.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("error locking keystore: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("error locking keystore: %s is held by another process", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// save writes the keystore to a temporary file and renames it, so a crash never leaves half a keystore behind
+func (ks *Keystore) save() error {
+	stored := make([]storedKey, len(ks.keys))
+	for i, key := range ks.keys {
+		stored[i] = storedKey{
+			Key:     key,
+			Secret:  hex.EncodeToString(key.Secret),
+			Private: hex.EncodeToString(key.Private),
+			Public:  hex.EncodeToString(key.Public),
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := ks.path + ".tmp"
+	if err := os.WriteFile(temporary, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("error writing keystore: %w", err)
+	}
+	if err := os.Rename(temporary, ks.path); err != nil {
+		return fmt.Errorf("error writing keystore: %w", err)
+	}
+	if info, err := os.Stat(ks.path); err == nil {
+		ks.modTime, ks.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package DispenserStrategies
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestKeystoreKeepsKeysRotatedByEveryProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	// Every keystore stands in for a process of its own
+	const processes = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, processes)
+	for i := 0; i < processes; i++ {
+		ks, err := OpenKeystore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ks.Rotate(AlgorithmHMAC)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ks.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != processes {
+		t.Fatalf("keystore holds %d keys, expected the %d that were rotated", len(keys), processes)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("lock file was left behind: %v", err)
+	}
+}
+
+func TestKeystoreKeysReportsAnUnreadableKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Rotate(AlgorithmEd25519); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("[{\"id\": "), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := ks.Keys(); err == nil {
+		t.Fatalf("returned %d stale keys for a keystore that doesn't decode", len(keys))
+	}
+}
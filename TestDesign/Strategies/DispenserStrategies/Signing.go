@@ -0,0 +1,163 @@
+package DispenserStrategies
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+/*
+This file contains the keyed dispensers. Unlike the bare hashes of DispenserV2 and DispenserV3 their output proves
+which key produced it: HMACDispenser with a secret shared by the signer and the verifier, Ed25519Dispenser with a
+private key only the signer holds. The output is "<key id>:<base64 tag>", so a verifier finds the key in its keystore
+even after the signer rotated to a newer one.
+*/
+
+// ErrInvalidSignature is returned by Verify when the signature doesn't match the value
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Verifier is implemented by dispensers whose output can be checked against the value it was produced from
+type Verifier interface {
+	Verify(value interface{}, signature interface{}) error
+}
+
+type HMACDispenser struct {
+	Keystore *Keystore
+	// Hash is "sha256" or "sha512", empty is sha256
+	Hash string
+	// KeyID pins the key that signs, empty signs with the active HMAC key of the keystore
+	KeyID string
+}
+
+func (d *HMACDispenser) newHash() (func() hash.Hash, error) {
+	switch d.Hash {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unknown HMAC hash %q", d.Hash)
+	}
+}
+
+func (d *HMACDispenser) Execute(value interface{}) (interface{}, error) {
+	key, err := signingKey(d.Keystore, d.KeyID, AlgorithmHMAC)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := d.tag(key, value)
+	if err != nil {
+		return nil, err
+	}
+	return formatSignature(key.ID, tag), nil
+}
+
+// Verify checks the signature of value with the key it names, which can be an older key than the active one
+func (d *HMACDispenser) Verify(value interface{}, signature interface{}) error {
+	key, tag, err := parseSignature(d.Keystore, signature, AlgorithmHMAC)
+	if err != nil {
+		return err
+	}
+	expected, err := d.tag(key, value)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(tag, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (d *HMACDispenser) tag(key Key, value interface{}) ([]byte, error) {
+	newHash, err := d.newHash()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(newHash, key.Secret)
+	mac.Write([]byte(fmt.Sprintf("%v", value)))
+	return mac.Sum(nil), nil
+}
+
+type Ed25519Dispenser struct {
+	Keystore *Keystore
+	// KeyID pins the key that signs, empty signs with the active ed25519 key of the keystore
+	KeyID string
+}
+
+func (d *Ed25519Dispenser) Execute(value interface{}) (interface{}, error) {
+	key, err := signingKey(d.Keystore, d.KeyID, AlgorithmEd25519)
+	if err != nil {
+		return nil, err
+	}
+	if len(key.Private) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("key %s has no private key, it can only verify", key.ID)
+	}
+	signature := ed25519.Sign(key.Private, []byte(fmt.Sprintf("%v", value)))
+	return formatSignature(key.ID, signature), nil
+}
+
+// Verify checks the signature of value with the public key it names, a keystore written by ExportPublic suffices
+func (d *Ed25519Dispenser) Verify(value interface{}, signature interface{}) error {
+	key, sig, err := parseSignature(d.Keystore, signature, AlgorithmEd25519)
+	if err != nil {
+		return err
+	}
+	if len(key.Public) != ed25519.PublicKeySize || !ed25519.Verify(key.Public, []byte(fmt.Sprintf("%v", value)), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func signingKey(keystore *Keystore, keyID, algorithm string) (Key, error) {
+	if keystore == nil {
+		return Key{}, errors.New("dispenser has no keystore")
+	}
+	if keyID == "" {
+		return keystore.Active(algorithm)
+	}
+	key, err := keystore.Key(keyID)
+	if err != nil {
+		return Key{}, err
+	}
+	if key.Algorithm != algorithm {
+		return Key{}, fmt.Errorf("key %s is a %s key, expected %s", keyID, key.Algorithm, algorithm)
+	}
+	return key, nil
+}
+
+func formatSignature(keyID string, signature []byte) string {
+	return keyID + ":" + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// parseSignature splits a signature into the key it names and the tag
+func parseSignature(keystore *Keystore, signature interface{}, algorithm string) (Key, []byte, error) {
+	var text string
+	switch s := signature.(type) {
+	case string:
+		text = s
+	case []byte:
+		text = string(s)
+	default:
+		return Key{}, nil, fmt.Errorf("can't verify %T, expected a signature string", signature)
+	}
+	keyID, encoded, ok := strings.Cut(text, ":")
+	if !ok {
+		return Key{}, nil, fmt.Errorf("%w: no key id", ErrInvalidSignature)
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Key{}, nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	key, err := signingKey(keystore, keyID, algorithm)
+	if err != nil {
+		return Key{}, nil, err
+	}
+	return key, tag, nil
+}
@@ -0,0 +1,128 @@
+package DispenserStrategies
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type signer interface {
+	Execute(value interface{}) (interface{}, error)
+	Verifier
+}
+
+func TestSignaturesVerifyAcrossRotations(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		algorithm string
+		dispenser func(ks *Keystore) signer
+	}{
+		{"hmac-sha256", AlgorithmHMAC, func(ks *Keystore) signer { return &HMACDispenser{Keystore: ks} }},
+		{"hmac-sha512", AlgorithmHMAC, func(ks *Keystore) signer { return &HMACDispenser{Keystore: ks, Hash: "sha512"} }},
+		{"ed25519", AlgorithmEd25519, func(ks *Keystore) signer { return &Ed25519Dispenser{Keystore: ks} }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ks, err := OpenKeystore(filepath.Join(t.TempDir(), "keys.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dispenser := c.dispenser(ks)
+			if _, err := dispenser.Execute("value"); !errors.Is(err, ErrNoKey) {
+				t.Fatalf("signing without a key returned %v, expected ErrNoKey", err)
+			}
+			old, err := ks.Rotate(c.algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signedBefore, err := dispenser.Execute("value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, err := ks.Rotate(c.algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signedAfter, err := dispenser.Execute("value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(signedBefore.(string), old.ID+":") || !strings.HasPrefix(signedAfter.(string), current.ID+":") {
+				t.Fatalf("signatures %v and %v don't name the keys %s and %s", signedBefore, signedAfter, old.ID, current.ID)
+			}
+
+			for _, check := range []struct {
+				name      string
+				value     interface{}
+				signature interface{}
+				expected  error
+			}{
+				{"signed before the rotation", "value", signedBefore, nil},
+				{"signed after the rotation", "value", signedAfter, nil},
+				{"as bytes", "value", []byte(signedAfter.(string)), nil},
+				{"another value", "other", signedAfter, ErrInvalidSignature},
+				{"modified tag", "value", flipTag(signedAfter.(string)), ErrInvalidSignature},
+				{"tag of another key", "value", current.ID + signedBefore.(string)[len(old.ID):], ErrInvalidSignature},
+				{"no key id", "value", "tag", ErrInvalidSignature},
+				{"unknown key", "value", c.algorithm + "-0000000000000000" + signedAfter.(string)[len(current.ID):], ErrUnknownKey},
+			} {
+				if err := dispenser.Verify(check.value, check.signature); !errors.Is(err, check.expected) {
+					t.Errorf("%s: verify returned %v, expected %v", check.name, err, check.expected)
+				}
+			}
+
+			if err := ks.Retire(old.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := dispenser.Verify("value", signedBefore); !errors.Is(err, ErrKeyRetired) {
+				t.Fatalf("verify with a retired key returned %v, expected ErrKeyRetired", err)
+			}
+		})
+	}
+}
+
+func TestExportedPublicKeysOnlyVerify(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := OpenKeystore(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Rotate(AlgorithmEd25519); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Rotate(AlgorithmHMAC); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := (&Ed25519Dispenser{Keystore: ks}).Execute("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.ExportPublic(filepath.Join(dir, "public.json")); err != nil {
+		t.Fatal(err)
+	}
+	public, err := OpenKeystore(filepath.Join(dir, "public.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &Ed25519Dispenser{Keystore: public}
+	if err := verifier.Verify("value", signature); err != nil {
+		t.Fatalf("the exported keystore doesn't verify: %v", err)
+	}
+	if _, err := verifier.Execute("value"); err == nil {
+		t.Fatal("signed with a keystore of public keys")
+	}
+	if _, err := public.Active(AlgorithmHMAC); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("the exported keystore holds an HMAC key: %v", err)
+	}
+}
+
+// flipTag changes a character in the middle of the base64 tag of a signature, the last character can hold bits
+// that aren't decoded
+func flipTag(signature string) string {
+	i := len(signature) - 10
+	replacement := byte('A')
+	if signature[i] == 'A' {
+		replacement = 'B'
+	}
+	return signature[:i] + string(replacement) + signature[i+1:]
+}
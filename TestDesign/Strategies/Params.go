@@ -0,0 +1,251 @@
+package Strategies
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+This file contains the parameters strategies are created with, such as the compression level of gzip or the salt of
+a hash. A strategy declares the parameters it takes as ParamSpecs in its Descriptor, and the registry validates the
+parameters against them before the strategy is created: unknown parameters, values of the wrong type, values out
+of range and missing required parameters are rejected, and parameters that aren't given get their default.
+
+Parameters can be given as a map, as decoded from a config file, or in the identifier in URL query form, such as
+"sha256?salt=abc&encoding=base64", which is how a spec string or a command line passes them.
+*/
+
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamInt    ParamType = "int"
+	ParamFloat  ParamType = "float"
+	ParamBool   ParamType = "bool"
+)
+
+type ParamSpec struct {
+	Name        string
+	Type        ParamType
+	Description string
+	// Default is used when the parameter isn't given, it has to be of the Go type of Type
+	Default interface{}
+	// Required parameters have to be given, they have no default
+	Required bool
+	// Min and Max bound int and float parameters when they are set
+	Min *float64
+	Max *float64
+	// Enum lists the values a string parameter can take, empty allows every value
+	Enum []string
+	// Secret parameters, such as passphrases, are redacted wherever parameters are shown or published
+	Secret bool
+	// Redact, when set, returns the value of a parameter that isn't secret as a whole but can hold secrets, such as
+	// a pipeline spec, with those secrets redacted
+	Redact func(value interface{}) interface{} `json:"-"`
+}
+
+// Bound returns a pointer to value, for ParamSpec.Min and ParamSpec.Max
+func Bound(value float64) *float64 {
+	return &value
+}
+
+func (s ParamSpec) String() string {
+	text := s.Name + ":" + string(s.Type)
+	if s.Required {
+		text += " (required)"
+	} else if s.Secret {
+		text += " (secret)"
+	} else if s.Default != nil {
+		text += fmt.Sprintf("=%#v", s.Default)
+	}
+	if len(s.Enum) > 0 {
+		text += " {" + strings.Join(s.Enum, ",") + "}"
+	}
+	if s.Min != nil || s.Max != nil {
+		low, high := "", ""
+		if s.Min != nil {
+			low = strconv.FormatFloat(*s.Min, 'g', -1, 64)
+		}
+		if s.Max != nil {
+			high = strconv.FormatFloat(*s.Max, 'g', -1, 64)
+		}
+		text += " [" + low + ".." + high + "]"
+	}
+	return text
+}
+
+// Params holds validated parameters, every declared parameter with a default or a given value is present with
+// the Go type of its ParamType: string, int, float64 or bool
+type Params map[string]interface{}
+
+func (p Params) String(name string) string {
+	value, _ := p[name].(string)
+	return value
+}
+
+func (p Params) Int(name string) int {
+	value, _ := p[name].(int)
+	return value
+}
+
+func (p Params) Float(name string) float64 {
+	value, _ := p[name].(float64)
+	return value
+}
+
+func (p Params) Bool(name string) bool {
+	value, _ := p[name].(bool)
+	return value
+}
+
+// Has reports whether the parameter was given or has a default
+func (p Params) Has(name string) bool {
+	_, ok := p[name]
+	return ok
+}
+
+// ValidateParams checks raw against specs and returns the parameters converted to their types with the defaults
+// filled in
+func ValidateParams(specs []ParamSpec, raw map[string]interface{}) (Params, error) {
+	known := make(map[string]ParamSpec, len(specs))
+	for _, spec := range specs {
+		known[spec.Name] = spec
+	}
+	var unknown []string
+	for name := range raw {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameter %s", strings.Join(unknown, ", "))
+	}
+
+	params := make(Params, len(specs))
+	for _, spec := range specs {
+		value, given := raw[spec.Name]
+		if !given {
+			if spec.Required {
+				return nil, fmt.Errorf("parameter %s is required", spec.Name)
+			}
+			if spec.Default != nil {
+				params[spec.Name] = spec.Default
+			}
+			continue
+		}
+		converted, err := convertParam(spec, value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", spec.Name, err)
+		}
+		params[spec.Name] = converted
+	}
+	return params, nil
+}
+
+// convertParam converts a value from Go, JSON or a query string to the type of spec and checks its bounds
+func convertParam(spec ParamSpec, value interface{}) (interface{}, error) {
+	text, isText := value.(string)
+	switch spec.Type {
+	case ParamString:
+		if !isText {
+			return nil, fmt.Errorf("expected a string, got %T", value)
+		}
+		if len(spec.Enum) > 0 && !contains(spec.Enum, text) {
+			return nil, fmt.Errorf("%q isn't one of %s", text, strings.Join(spec.Enum, ", "))
+		}
+		return text, nil
+	case ParamBool:
+		if isText {
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, fmt.Errorf("expected a bool, got %q", text)
+			}
+			return b, nil
+		}
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a bool, got %T", value)
+		}
+		return b, nil
+	case ParamInt, ParamFloat:
+		var f float64
+		switch v := value.(type) {
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected a number, got %q", v)
+			}
+			f = parsed
+		case int:
+			f = float64(v)
+		case int64:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			return nil, fmt.Errorf("expected a number, got %T", value)
+		}
+		if spec.Min != nil && f < *spec.Min || spec.Max != nil && f > *spec.Max {
+			return nil, fmt.Errorf("%v is out of range", f)
+		}
+		if spec.Type == ParamFloat {
+			return f, nil
+		}
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("expected an integer, got %v", f)
+		}
+		return int(f), nil
+	default:
+		return nil, fmt.Errorf("unknown parameter type %q", spec.Type)
+	}
+}
+
+// Redacted is what Redact replaces the value of a secret parameter with
+const Redacted = "<redacted>"
+
+// Redact returns a copy of params with the values of the secret parameters of specs replaced by Redacted, and the
+// parameters with a Redact function replaced by what it returns
+func Redact(specs []ParamSpec, params map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		redacted[name] = value
+	}
+	for _, spec := range specs {
+		value, ok := redacted[spec.Name]
+		switch {
+		case !ok:
+		case spec.Secret:
+			redacted[spec.Name] = Redacted
+		case spec.Redact != nil:
+			redacted[spec.Name] = spec.Redact(value)
+		}
+	}
+	return redacted
+}
+
+// ParseParams parses parameters in URL query form, such as "level=9&encoding=base64", into strings
+func ParseParams(query string) (map[string]interface{}, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters %q: %w", query, err)
+	}
+	raw := make(map[string]interface{}, len(values))
+	for name, list := range values {
+		raw[name] = list[len(list)-1]
+	}
+	return raw, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package Pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mcs/TestDesign/Strategies"
+	"strings"
+)
+
+/*
+This package chains compressor and dispenser strategies into a single strategy, described by a spec such as
+"v2|gzip|base64": encode as JSON, gzip the JSON and encode the result as base64. The stages are listed in Stages.go.
+
+A Pipeline implements Strategies.Strategy, so it can be passed to CompressorModule.SetStrategy and
+DispenserModule.SetStrategy. It is registered as the "pipeline" compressor and dispenser with the spec as its spec
+parameter, so it can be used wherever a registered strategy can: "pipeline?spec=v2|gzip|base64" in a
+SetStrategyCommand, a config file or a rollout. The parameters of a stage have to be escaped in that form, such as
+"pipeline?spec=v2|sha256%3Fsalt%3Dabc", which a config file avoids by giving the spec as a parameter. A pipeline whose stages are all reversible can be reversed with Reverse, as long as
+only its first stage encodes values: a stage such as json or gob restores the types its decoder decodes to rather
+than the bytes an earlier stage gave it, so "v1|v3" isn't reversible while "v3|base64" is. A pipeline whose stages
+all stream, such as "gzip|base64", streams as a whole with NewWriter and NewReader.
+*/
+
+var (
+	// ErrNotReversible is returned by Reverse when a stage of the pipeline can't be undone
+	ErrNotReversible = errors.New("pipeline isn't reversible")
+	// ErrNotStreaming is returned by NewWriter and NewReader when a stage of the pipeline can't stream
+	ErrNotStreaming = errors.New("pipeline doesn't stream")
+)
+
+type Stage struct {
+	Name    string
+	Forward func(value interface{}) (interface{}, error)
+	// Inverse undoes Forward, nil when the stage isn't reversible
+	Inverse func(value interface{}) (interface{}, error)
+	// EncodesValues is set when Forward encodes any value and Inverse restores the types its decoder decodes to,
+	// such as json, so Inverse only undoes the stage when it is the first stage of a pipeline
+	EncodesValues bool
+	// NewWriter and NewReader are the streaming forms of Forward and Inverse, nil when the stage doesn't stream
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.Reader, error)
+}
+
+type Pipeline struct {
+	spec   string
+	stages []Stage
+}
+
+// Parse builds the pipeline of spec, stage names are separated by "|"
+func Parse(spec string) (*Pipeline, error) {
+	var stages []Stage
+	for _, name := range strings.Split(spec, "|") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("pipeline %q has an empty stage", RedactSpec(spec))
+		}
+		stage, err := lookupStage(name)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	return New(stages...), nil
+}
+
+// New builds a pipeline from stages, its spec is the names of the stages. The stages of Parse are named after the
+// spec with their secret parameters redacted, so Spec and the errors of the pipeline can be shown and published.
+func New(stages ...Stage) *Pipeline {
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		names[i] = stage.Name
+	}
+	return &Pipeline{spec: strings.Join(names, "|"), stages: stages}
+}
+
+// pipelineName is the name the pipeline is registered under
+const pipelineName = "pipeline"
+
+func init() {
+	for _, kind := range []string{Strategies.KindCompressor, Strategies.KindDispenser} {
+		Strategies.DefaultRegistry.MustRegister(Strategies.Registration{
+			Descriptor: Strategies.Descriptor{
+				Kind:        kind,
+				Name:        pipelineName,
+				Version:     1,
+				Description: "chains strategies, such as v2|gzip|base64, reversible when its stages are",
+				Reversible:  true,
+				InputTypes:  []string{"any"},
+				Params: []Strategies.ParamSpec{{
+					Name:        "spec",
+					Type:        Strategies.ParamString,
+					Required:    true,
+					Description: "the stages separated by |",
+					Redact:      redactSpecParam,
+				}},
+			},
+			NewWithParams: func(params Strategies.Params) (Strategies.Strategy, error) {
+				return Parse(params.String("spec"))
+			},
+		})
+	}
+}
+
+func redactSpecParam(value interface{}) interface{} {
+	spec, ok := value.(string)
+	if !ok {
+		return Strategies.Redacted
+	}
+	return RedactSpec(spec)
+}
+
+// Spec returns the names of the stages separated by "|", with their secret parameters redacted
+func (p *Pipeline) Spec() string {
+	return p.spec
+}
+
+func (p *Pipeline) Stages() []Stage {
+	return append([]Stage(nil), p.stages...)
+}
+
+// Execute runs value through every stage in order
+func (p *Pipeline) Execute(value interface{}) (interface{}, error) {
+	for _, stage := range p.stages {
+		var err error
+		if value, err = stage.Forward(value); err != nil {
+			return nil, fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+	}
+	return value, nil
+}
+
+// Reversible reports whether Reverse restores the value Execute was given
+func (p *Pipeline) Reversible() bool {
+	return p.irreversible() == nil
+}
+
+// irreversible returns why Reverse can't undo the pipeline, nil when it can
+func (p *Pipeline) irreversible() error {
+	for i, stage := range p.stages {
+		if stage.Inverse == nil {
+			return fmt.Errorf("%w: stage %s can't be undone", ErrNotReversible, stage.Name)
+		}
+		if i > 0 && stage.EncodesValues {
+			return fmt.Errorf("%w: stage %s encodes values, it only undoes itself as the first stage", ErrNotReversible, stage.Name)
+		}
+	}
+	return nil
+}
+
+// Reverse undoes Execute by running the inverse of every stage in reverse order
+func (p *Pipeline) Reverse(value interface{}) (interface{}, error) {
+	if err := p.irreversible(); err != nil {
+		return nil, err
+	}
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		var err error
+		if value, err = p.stages[i].Inverse(value); err != nil {
+			return nil, fmt.Errorf("reversing stage %s: %w", p.stages[i].Name, err)
+		}
+	}
+	return value, nil
+}
+
+// Streaming reports whether every stage streams, so NewWriter works
+func (p *Pipeline) Streaming() bool {
+	for _, stage := range p.stages {
+		if stage.NewWriter == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// NewWriter returns a writer that streams what is written to it through every stage to w, Close flushes every
+// stage without closing w
+func (p *Pipeline) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	for _, stage := range p.stages {
+		if stage.NewWriter == nil {
+			return nil, fmt.Errorf("%w: stage %s", ErrNotStreaming, stage.Name)
+		}
+	}
+	// The last stage writes to w, every earlier stage writes to the stage after it
+	writers := make([]io.WriteCloser, len(p.stages))
+	next := w
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		writer, err := p.stages[i].NewWriter(next)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: %w", p.stages[i].Name, err)
+		}
+		writers[i], next = writer, writer
+	}
+	if len(writers) == 0 {
+		return nopCloser{w}, nil
+	}
+	return &chainWriter{writers: writers}, nil
+}
+
+// NewReader returns a reader that undoes every stage while reading r, the streaming form of Reverse
+func (p *Pipeline) NewReader(r io.Reader) (io.Reader, error) {
+	for _, stage := range p.stages {
+		if stage.NewReader == nil {
+			return nil, fmt.Errorf("%w: stage %s can't be undone while streaming", ErrNotStreaming, stage.Name)
+		}
+	}
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		var err error
+		if r, err = p.stages[i].NewReader(r); err != nil {
+			return nil, fmt.Errorf("reversing stage %s: %w", p.stages[i].Name, err)
+		}
+	}
+	return r, nil
+}
+
+// AsStage turns the pipeline into a stage of another pipeline
+func (p *Pipeline) AsStage() Stage {
+	stage := Stage{Name: p.spec, Forward: p.Execute}
+	if p.Reversible() {
+		stage.Inverse = p.Reverse
+		stage.EncodesValues = len(p.stages) > 0 && p.stages[0].EncodesValues
+	}
+	if p.Streaming() {
+		stage.NewWriter = p.NewWriter
+	}
+	stage.NewReader = p.NewReader
+	for _, s := range p.stages {
+		if s.NewReader == nil {
+			stage.NewReader = nil
+		}
+	}
+	return stage
+}
+
+// chainWriter writes to the first writer of a chain, Close closes them in order so every stage flushes into the
+// next one
+type chainWriter struct {
+	writers []io.WriteCloser
+}
+
+func (c *chainWriter) Write(data []byte) (int, error) {
+	return c.writers[0].Write(data)
+}
+
+func (c *chainWriter) Close() error {
+	for _, writer := range c.writers {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package Pipeline
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Strategies"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPipelineRedactsSecretParameters(t *testing.T) {
+	pipeline, err := Parse("json|xchacha20-poly1305?passphrase=hunter2|base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec := pipeline.Spec(); strings.Contains(spec, "hunter2") {
+		t.Fatalf("spec %q holds the passphrase", spec)
+	}
+	if _, err := pipeline.Reverse("bm90IGVuY3J5cHRlZA=="); err == nil {
+		t.Fatal("reversed data that wasn't encrypted")
+	} else if strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("error %q holds the passphrase", err)
+	}
+	if _, err := Parse("json|xchacha20-poly1305?passphrase=hunter2|"); err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("parse error %v holds the passphrase", err)
+	}
+	if redacted := RedactSpec("dispenser:xchacha20-poly1305?passphrase=hunter2&kdf=scrypt"); redacted != "dispenser:xchacha20-poly1305?kdf=scrypt&passphrase=<redacted>" {
+		t.Fatalf("redacted the spec to %q", redacted)
+	}
+}
+
+func TestPipelineRoundTrips(t *testing.T) {
+	value := map[string]interface{}{"pressure": 1.5, "sensor": "a", "valid": true}
+	for _, spec := range []string{
+		"v2|gzip|base64",
+		"json|gzip|hex",
+		"v3|base64",
+		"gob|gzip|base64",
+		"v1|gzip",
+		"v2|reverse|base64",
+		"json|xchacha20-poly1305?passphrase=hunter2&kdf=scrypt|base64",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			pipeline, err := Parse(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pipeline.Reversible() {
+				t.Fatal("pipeline isn't reversible")
+			}
+			output, err := pipeline.Execute(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := pipeline.Reverse(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, value) {
+				t.Fatalf("decoded %#v, expected %#v", decoded, value)
+			}
+		})
+	}
+}
+
+func TestPipelineWithValueStagesAfterTheFirstIsNotReversible(t *testing.T) {
+	for _, spec := range []string{"v1|v3", "v2|json", "gzip|gob", "sha256|base64", "v2|gzip|v2"} {
+		t.Run(spec, func(t *testing.T) {
+			pipeline, err := Parse(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pipeline.Reversible() {
+				t.Fatal("pipeline reports it is reversible")
+			}
+			output, err := pipeline.Execute("value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := pipeline.Reverse(output); !errors.Is(err, ErrNotReversible) {
+				t.Fatalf("reverse returned %v, expected ErrNotReversible", err)
+			}
+		})
+	}
+}
+
+func TestPipelineStreamsLikeItExecutes(t *testing.T) {
+	pipeline, err := Parse("gzip|base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	writer, err := pipeline.NewWriter(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("streamed value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := pipeline.NewReader(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "streamed value" {
+		t.Fatalf("streamed back %q", data)
+	}
+}
+
+func TestPipelineIsARegisteredStrategy(t *testing.T) {
+	for _, kind := range []string{Strategies.KindCompressor, Strategies.KindDispenser} {
+		strategy, err := Strategies.Create(kind, "pipeline?spec=v2|gzip|base64")
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := strategy.Execute("value")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := strategy.(Strategies.Reverser).Reverse(output)
+		if err != nil || decoded != "value" {
+			t.Fatalf("%s pipeline reversed to %v, %v", kind, decoded, err)
+		}
+	}
+
+	module := TestDesign.NewCompressorModule("compressor", nil, "value")
+	params := map[string]interface{}{"spec": "json|xchacha20-poly1305?passphrase=hunter2|base64"}
+	if err := module.ConfigureStrategy("pipeline", params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := module.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	active := module.ActiveStrategy()
+	if spec := active.Params["spec"]; spec != "json|xchacha20-poly1305?passphrase=<redacted>|base64" {
+		t.Fatalf("module describes its pipeline as %v", spec)
+	}
+}
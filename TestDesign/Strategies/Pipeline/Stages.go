@@ -0,0 +1,250 @@
+package Pipeline
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mcs/TestDesign/Strategies"
+	"mcs/TestDesign/Strategies/CompressorStrategies"
+	"mcs/TestDesign/Strategies/DispenserStrategies"
+	"sort"
+	"strings"
+)
+
+/*
+The stages a spec can name:
+
+    v1 ... v7          the compressor strategies, "compressor:v2" names one explicitly
+    dispenser:v1 ...   the dispenser strategies
+    any other name     a strategy in Strategies.DefaultRegistry, such as "rle" or "gorilla@1", compressors first
+    json, gob          the JSON and gob encodings, json is the same as v2
+    gzip               gzip of bytes
+    base64, hex        text encodings of bytes
+    sha256, sha512     hex hashes, like dispenser:v2 and dispenser:v3
+    upper, reverse     like dispenser:v4 and compressor v4
+
+Stages that work on bytes take []byte or a string, and any other value as its %v string like the dispensers do.
+The dispensers and the reverse compressor get []byte from an earlier stage as a string, not as its %v string.
+json, gob and the registered compressors that don't take []byte encode values, they are only undone as the first
+stage of a pipeline.
+gzip, base64, hex, sha256, sha512 and the registered strategies that implement Strategies.StreamStrategy stream.
+*/
+
+var stages = map[string]Stage{
+	"json":    {Name: "json", Forward: CompressorStrategies.CompressorV2, Inverse: fromBytes(CompressorStrategies.DecompressorV2), EncodesValues: true},
+	"gob":     codecStage("gob", "v1"),
+	"gzip":    streamStage("gzip", &CompressorStrategies.GzipStream{Level: gzip.DefaultCompression}, false),
+	"base64":  streamStage("base64", &DispenserStrategies.DispenserV1{}, true),
+	"hex":     {Name: "hex", Forward: encodeHex, Inverse: decodeHex, NewWriter: newHexWriter, NewReader: newHexReader},
+	"sha256":  streamStage("sha256", &DispenserStrategies.DispenserV2{}, true),
+	"sha512":  streamStage("sha512", &DispenserStrategies.DispenserV3{}, true),
+	"upper":   {Name: "upper", Forward: bytesAsString((&DispenserStrategies.DispenserV4{}).Execute)},
+	"reverse": {Name: "reverse", Forward: bytesAsString(CompressorStrategies.CompressorV4), Inverse: fromBytes(CompressorStrategies.DecompressorV4)},
+}
+
+// StageNames returns the names of the stages of this package, the registered strategies can be used as well
+func StageNames() []string {
+	names := make([]string, 0, len(stages))
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupStage(name string) (Stage, error) {
+	if stage, ok := stages[name]; ok {
+		return stage, nil
+	}
+	if kind, identifier, found := cutKind(name); found {
+		return strategyStage(kind+":", kind, identifier)
+	}
+	// Unqualified names are compressors first, like the v1 ... v7 shorthands
+	if stage, err := strategyStage("", Strategies.KindCompressor, name); err == nil {
+		return stage, nil
+	}
+	if stage, err := strategyStage("", Strategies.KindDispenser, name); err == nil {
+		return stage, nil
+	}
+	return Stage{}, fmt.Errorf("unknown pipeline stage %q", redactStage(name))
+}
+
+// cutKind splits the kind off a stage name such as "dispenser:v1", parameters can hold a ":" so only the part before
+// them is looked at
+func cutKind(name string) (kind, identifier string, found bool) {
+	base, _, _ := strings.Cut(name, "?")
+	if !strings.Contains(base, ":") {
+		return "", name, false
+	}
+	return strings.Cut(name, ":")
+}
+
+// strategyStage turns a registered strategy into a stage, it is reversible when the strategy is. The stage is named
+// prefix followed by identifier with its secret parameters redacted.
+func strategyStage(prefix, kind, identifier string) (Stage, error) {
+	name := prefix + describeStage(kind, identifier)
+	strategy, err := Strategies.Create(kind, identifier)
+	if err != nil {
+		return Stage{}, fmt.Errorf("pipeline stage %q: %w", name, err)
+	}
+	stage := Stage{Name: name, Forward: strategy.Execute}
+	if kind == Strategies.KindDispenser {
+		stage.Forward = bytesAsString(strategy.Execute)
+	}
+	if reverser, ok := strategy.(Strategies.Reverser); ok {
+		stage.Inverse = reverser.Reverse
+		// The dispensers get bytes as a string, the compressors that don't declare []byte as an input encode values
+		if kind == Strategies.KindCompressor {
+			registration, _ := Strategies.DefaultRegistry.Lookup(kind, strings.SplitN(identifier, "?", 2)[0])
+			stage.EncodesValues = !accepts(registration.InputTypes, "[]byte")
+		}
+	}
+	if streaming, ok := strategy.(Strategies.StreamStrategy); ok {
+		stage.NewWriter = streaming.NewWriter
+	}
+	if reverser, ok := strategy.(Strategies.StreamReverser); ok {
+		stage.NewReader = reverser.NewReader
+	}
+	return stage, nil
+}
+
+// describeStage returns identifier with the values of the secret parameters of the registered strategy of kind
+// redacted, like the strategy of a module is described. The parameters of a strategy that isn't registered are all
+// redacted.
+func describeStage(kind, identifier string) string {
+	name, params, err := Strategies.DefaultRegistry.Describe(kind, identifier, nil)
+	if err != nil {
+		var query string
+		name, query, _ = strings.Cut(identifier, "?")
+		params, _ = Strategies.ParseParams(query)
+		for param := range params {
+			params[param] = Strategies.Redacted
+		}
+	}
+	if len(params) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(params))
+	for param := range params {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+	for i, param := range names {
+		names[i] = fmt.Sprintf("%s=%v", param, params[param])
+	}
+	return name + "?" + strings.Join(names, "&")
+}
+
+// redactStage describes the stage name like the stage would be named, without creating it
+func redactStage(name string) string {
+	if _, ok := stages[name]; ok {
+		return name
+	}
+	if kind, identifier, found := cutKind(name); found {
+		return kind + ":" + describeStage(kind, identifier)
+	}
+	base, _, _ := strings.Cut(name, "?")
+	if _, err := Strategies.DefaultRegistry.Lookup(Strategies.KindCompressor, base); err == nil {
+		return describeStage(Strategies.KindCompressor, name)
+	}
+	return describeStage(Strategies.KindDispenser, name)
+}
+
+// RedactSpec returns spec with the values of the secret parameters of its stages redacted, Spec and the errors of
+// a pipeline already name its stages that way
+func RedactSpec(spec string) string {
+	names := strings.Split(spec, "|")
+	for i, name := range names {
+		names[i] = redactStage(strings.TrimSpace(name))
+	}
+	return strings.Join(names, "|")
+}
+
+// codecStage uses the codec of a compressor strategy, whose output says which strategy produced it
+func codecStage(name, identifier string) Stage {
+	factory := &CompressorStrategies.CompressorStrategyFactory{}
+	codec, _ := factory.CreateCodec(identifier)
+	return Stage{
+		Name:          name,
+		Forward:       func(value interface{}) (interface{}, error) { return codec.Encode(value) },
+		Inverse:       fromBytes(codec.Decode),
+		EncodesValues: true,
+	}
+}
+
+func accepts(inputTypes []string, inputType string) bool {
+	for _, accepted := range inputTypes {
+		if accepted == inputType {
+			return true
+		}
+	}
+	return false
+}
+
+func toBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
+
+// bytesAsString passes []byte to f as a string
+func bytesAsString(f func(interface{}) (interface{}, error)) func(interface{}) (interface{}, error) {
+	return func(value interface{}) (interface{}, error) {
+		if data, ok := value.([]byte); ok {
+			return f(string(data))
+		}
+		return f(value)
+	}
+}
+
+// fromBytes adapts a decoder to the values a stage receives
+func fromBytes(decode func([]byte) (interface{}, error)) func(interface{}) (interface{}, error) {
+	return func(value interface{}) (interface{}, error) {
+		return decode(toBytes(value))
+	}
+}
+
+// streamStage turns a streaming strategy into a stage that works on bytes, its output is text when text is set and
+// []byte otherwise
+func streamStage(name string, strategy Strategies.StreamStrategy, text bool) Stage {
+	stage := Stage{
+		Name: name,
+		Forward: func(value interface{}) (interface{}, error) {
+			output, err := Strategies.ExecuteStream(strategy, toBytes(value))
+			if err != nil || !text {
+				return output, err
+			}
+			return string(output), nil
+		},
+		NewWriter: strategy.NewWriter,
+	}
+	if reverser, ok := strategy.(Strategies.StreamReverser); ok {
+		stage.Inverse = func(value interface{}) (interface{}, error) {
+			return Strategies.ReverseStream(reverser, toBytes(value))
+		}
+		stage.NewReader = reverser.NewReader
+	}
+	return stage
+}
+
+func encodeHex(value interface{}) (interface{}, error) {
+	return hex.EncodeToString(toBytes(value)), nil
+}
+
+func decodeHex(value interface{}) (interface{}, error) {
+	return hex.DecodeString(string(toBytes(value)))
+}
+
+func newHexWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopCloser{hex.NewEncoder(w)}, nil
+}
+
+func newHexReader(r io.Reader) (io.Reader, error) {
+	return hex.NewDecoder(r), nil
+}
@@ -0,0 +1,308 @@
+package Strategies
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+This file contains the registry every strategy registers in, under its kind, a name and a version, with a
+Descriptor that tells what the strategy does. The compressor and dispenser packages register their strategies when
+they are imported, other packages can register their own with Register.
+
+A strategy is created from an identifier: "name@version" for a specific version, "name" for the latest version, or
+an alias such as the "v1" ... "v7" the factories have always accepted. Strategies that declare parameters (see
+Params.go) can be given them with CreateWithParams or in the identifier, such as "gzip-json?level=9".
+*/
+
+const (
+	KindCompressor = "compressor"
+	KindDispenser  = "dispenser"
+)
+
+// Reverser is implemented by strategies whose output can be turned back into their input
+type Reverser interface {
+	Reverse(value interface{}) (interface{}, error)
+}
+
+type ReversibleStrategy interface {
+	Strategy
+	Reverser
+}
+
+type Descriptor struct {
+	Kind        string
+	Name        string
+	Version     int
+	Description string
+	// Reversible reports whether the strategy implements Reverser. The registry sets it by creating the strategy
+	// with its default parameters, it is only taken from the registration when the strategy can't be created
+	// without being given parameters, such as a key.
+	Reversible bool
+	// InputTypes are the Go types Execute accepts, such as "[]float64", "any" accepts every value
+	InputTypes []string
+	// Aliases are other identifiers the strategy can be created with
+	Aliases []string
+	// Params declares the parameters the strategy accepts
+	Params []ParamSpec
+}
+
+// ID returns the identifier of this exact version, "name@version"
+func (d Descriptor) ID() string {
+	return d.Name + "@" + strconv.Itoa(d.Version)
+}
+
+type Registration struct {
+	Descriptor
+	// New creates a strategy without parameters, for strategies that don't declare any
+	New func() Strategy
+	// NewWithParams creates a strategy from validated parameters, it takes precedence over New
+	NewWithParams func(params Params) (Strategy, error)
+}
+
+func (r Registration) create(params Params) (Strategy, error) {
+	if r.NewWithParams != nil {
+		return r.NewWithParams(params)
+	}
+	return r.New(), nil
+}
+
+type Registry struct {
+	// versions holds the registrations per kind and name, oldest version first
+	versions map[string]map[string][]Registration
+	aliases  map[string]map[string]Registration
+	mu       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		versions: make(map[string]map[string][]Registration),
+		aliases:  make(map[string]map[string]Registration),
+	}
+}
+
+// DefaultRegistry is the registry the factories create their strategies from
+var DefaultRegistry = NewRegistry()
+
+// Register adds a strategy, its kind, name, version and aliases have to be new, and no name can be the alias of
+// another strategy of the same kind
+func (r *Registry) Register(registration Registration) error {
+	d := registration.Descriptor
+	if d.Kind == "" || d.Name == "" || registration.New == nil && registration.NewWithParams == nil {
+		return fmt.Errorf("strategy %q needs a kind, a name and a constructor", d.Name)
+	}
+	if strings.Contains(d.Name, "@") {
+		return fmt.Errorf("strategy name %q can't contain @", d.Name)
+	}
+	if d.Version < 1 {
+		return fmt.Errorf("strategy %s has version %d, versions start at 1", d.Name, d.Version)
+	}
+	if len(d.Params) > 0 && registration.NewWithParams == nil {
+		return fmt.Errorf("strategy %s declares parameters but has no NewWithParams", d.Name)
+	}
+	if defaults, err := ValidateParams(d.Params, nil); err == nil {
+		if strategy, err := registration.create(defaults); err == nil {
+			_, registration.Reversible = strategy.(Reverser)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.versions[d.Kind][d.Name] {
+		if existing.Version == d.Version {
+			return fmt.Errorf("%s strategy %s is already registered", d.Kind, d.ID())
+		}
+	}
+	// Lookup tries aliases before names, so a name and an alias can't be the same
+	if _, taken := r.aliases[d.Kind][d.Name]; taken {
+		return fmt.Errorf("%s strategy name %q is already registered as an alias", d.Kind, d.Name)
+	}
+	for _, alias := range d.Aliases {
+		if _, taken := r.aliases[d.Kind][alias]; taken {
+			return fmt.Errorf("%s strategy alias %q is already registered", d.Kind, alias)
+		}
+		if _, taken := r.versions[d.Kind][alias]; taken || alias == d.Name {
+			return fmt.Errorf("%s strategy alias %q is already registered as a name", d.Kind, alias)
+		}
+	}
+
+	if r.versions[d.Kind] == nil {
+		r.versions[d.Kind] = make(map[string][]Registration)
+		r.aliases[d.Kind] = make(map[string]Registration)
+	}
+	versions := append(r.versions[d.Kind][d.Name], registration)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	r.versions[d.Kind][d.Name] = versions
+	for _, alias := range d.Aliases {
+		r.aliases[d.Kind][alias] = registration
+	}
+	return nil
+}
+
+// MustRegister registers a strategy and panics when that fails, for use in init functions
+func (r *Registry) MustRegister(registration Registration) {
+	if err := r.Register(registration); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup resolves identifier to a registration of kind
+func (r *Registry) Lookup(kind, identifier string) (Registration, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if registration, ok := r.aliases[kind][identifier]; ok {
+		return registration, nil
+	}
+	name, version, hasVersion := strings.Cut(identifier, "@")
+	versions := r.versions[kind][name]
+	if len(versions) == 0 {
+		return Registration{}, fmt.Errorf("unknown %s strategy %q", kind, identifier)
+	}
+	if !hasVersion {
+		return versions[len(versions)-1], nil
+	}
+	for _, registration := range versions {
+		if strconv.Itoa(registration.Version) == version {
+			return registration, nil
+		}
+	}
+	return Registration{}, fmt.Errorf("unknown %s strategy %q", kind, identifier)
+}
+
+// Create returns a new strategy of kind for identifier, parameters can follow the identifier in URL query form
+func (r *Registry) Create(kind, identifier string) (Strategy, error) {
+	return r.CreateWithParams(kind, identifier, nil)
+}
+
+// CreateWithParams returns a new strategy of kind for identifier with params validated against the parameters the
+// strategy declares. Parameters in the identifier are overridden by params.
+func (r *Registry) CreateWithParams(kind, identifier string, params map[string]interface{}) (Strategy, error) {
+	identifier, query, hasQuery := strings.Cut(identifier, "?")
+	registration, err := r.Lookup(kind, identifier)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{}, len(params))
+	if hasQuery {
+		if raw, err = ParseParams(query); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range params {
+		raw[name] = value
+	}
+	validated, err := ValidateParams(registration.Params, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s strategy %s: %w", kind, registration.ID(), err)
+	}
+	strategy, err := registration.create(validated)
+	if err != nil {
+		return nil, fmt.Errorf("%s strategy %s: %w", kind, registration.ID(), err)
+	}
+	return strategy, nil
+}
+
+// Describe splits the parameters off identifier and merges them with params like CreateWithParams does, with the
+// secret parameters redacted, so the strategy can be shown or published without its secrets
+func (r *Registry) Describe(kind, identifier string, params map[string]interface{}) (string, map[string]interface{}, error) {
+	identifier, query, hasQuery := strings.Cut(identifier, "?")
+	registration, err := r.Lookup(kind, identifier)
+	if err != nil {
+		return "", nil, err
+	}
+	merged := make(map[string]interface{}, len(params))
+	if hasQuery {
+		if merged, err = ParseParams(query); err != nil {
+			return "", nil, err
+		}
+	}
+	for name, value := range params {
+		merged[name] = value
+	}
+	return identifier, Redact(registration.Params, merged), nil
+}
+
+// List returns the descriptors of every version of every strategy of kind, sorted by name and version. An empty
+// kind lists every kind.
+func (r *Registry) List(kind string) []Descriptor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var descriptors []Descriptor
+	for registeredKind, names := range r.versions {
+		if kind != "" && registeredKind != kind {
+			continue
+		}
+		for _, versions := range names {
+			for _, registration := range versions {
+				descriptors = append(descriptors, registration.Descriptor)
+			}
+		}
+	}
+	sort.Slice(descriptors, func(i, j int) bool {
+		a, b := descriptors[i], descriptors[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return descriptors
+}
+
+// Register adds a strategy to DefaultRegistry
+func Register(registration Registration) error {
+	return DefaultRegistry.Register(registration)
+}
+
+// Create returns a new strategy of kind from DefaultRegistry
+func Create(kind, identifier string) (Strategy, error) {
+	return DefaultRegistry.Create(kind, identifier)
+}
+
+// CreateWithParams returns a new strategy of kind with params from DefaultRegistry
+func CreateWithParams(kind, identifier string, params map[string]interface{}) (Strategy, error) {
+	return DefaultRegistry.CreateWithParams(kind, identifier, params)
+}
+
+// List returns the descriptors of the strategies of kind in DefaultRegistry
+func List(kind string) []Descriptor {
+	return DefaultRegistry.List(kind)
+}
+
+// KindFactory creates the strategies of one kind from a registry, it implements StrategyFactory
+type KindFactory struct {
+	Kind string
+	// Registry is the registry to use, nil uses DefaultRegistry
+	Registry *Registry
+}
+
+func (f *KindFactory) registry() *Registry {
+	if f.Registry == nil {
+		return DefaultRegistry
+	}
+	return f.Registry
+}
+
+func (f *KindFactory) CreateStrategy(identifier string) (Strategy, error) {
+	return f.registry().Create(f.Kind, identifier)
+}
+
+func (f *KindFactory) CreateStrategyWithParams(identifier string, params map[string]interface{}) (Strategy, error) {
+	return f.registry().CreateWithParams(f.Kind, identifier, params)
+}
+
+// List returns the descriptors of the strategies the factory can create
+func (f *KindFactory) List() []Descriptor {
+	return f.registry().List(f.Kind)
+}
+
+// Register adds a strategy of the kind of the factory
+func (f *KindFactory) Register(registration Registration) error {
+	registration.Kind = f.Kind
+	return f.registry().Register(registration)
+}
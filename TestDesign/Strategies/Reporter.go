@@ -0,0 +1,11 @@
+package Strategies
+
+// Reporter receives what a strategy reports about itself as values on topics, such as the decisions of the
+// adaptive compressor
+type Reporter func(topic string, value interface{})
+
+// Reporting is implemented by strategies that report, a module that is given such a strategy sets a reporter that
+// publishes the reports on its topics
+type Reporting interface {
+	SetReporter(reporter Reporter)
+}
@@ -0,0 +1,88 @@
+package Strategies
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+/*
+This file contains the streaming form of strategies, for payloads too large to hold in memory such as image
+snapshots or historian exports. A StreamStrategy wraps a writer like gzip.NewWriter does: what is written to the
+wrapper comes out transformed on the wrapped writer, and Close flushes the rest. Its reverse wraps a reader like
+gzip.NewReader does. Both work in bounded memory, whatever the size of the stream.
+
+The value API of a streaming strategy is built on the stream: ExecuteStream writes the value to the wrapper and
+returns what came out.
+*/
+
+type StreamStrategy interface {
+	// NewWriter returns a writer whose output is written to w, Close flushes it without closing w
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+type StreamReverser interface {
+	// NewReader returns a reader of what was written to the writer of NewWriter, given a reader of its output
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// Copy streams src through strategy to dst, it returns the number of bytes read from src
+func Copy(strategy StreamStrategy, dst io.Writer, src io.Reader) (int64, error) {
+	writer, err := strategy.NewWriter(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(writer, src)
+	if err != nil {
+		writer.Close()
+		return n, err
+	}
+	return n, writer.Close()
+}
+
+// ReverseCopy streams src through the reverse of strategy to dst, it returns the number of bytes written to dst
+func ReverseCopy(reverser StreamReverser, dst io.Writer, src io.Reader) (int64, error) {
+	reader, err := reverser.NewReader(src)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(dst, reader)
+	if closer, ok := reader.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return n, err
+}
+
+// ExecuteStream runs a value through strategy. []byte and strings are streamed as they are, an io.Reader is read
+// to its end and any other value is streamed as its %v string, like the dispensers do.
+func ExecuteStream(strategy StreamStrategy, value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := Copy(strategy, &buf, valueReader(value)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReverseStream undoes ExecuteStream
+func ReverseStream(reverser StreamReverser, value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := ReverseCopy(reverser, &buf, valueReader(value)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func valueReader(value interface{}) io.Reader {
+	switch v := value.(type) {
+	case []byte:
+		return bytes.NewReader(v)
+	case string:
+		return bytes.NewReader([]byte(v))
+	case io.Reader:
+		return v
+	default:
+		return bytes.NewReader([]byte(fmt.Sprintf("%v", v)))
+	}
+}
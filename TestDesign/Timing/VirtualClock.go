@@ -0,0 +1,197 @@
+package Timing
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// virtualTickerBuffer is the number of ticks a virtual ticker holds for a slow receiver. Unlike a real ticker a
+// virtual ticker doesn't drop ticks when a test advances the clock by many periods at once.
+const virtualTickerBuffer = 1024
+
+type waiterKind int
+
+const (
+	waiterAfter waiterKind = iota
+	waiterTicker
+	waiterFunc
+)
+
+type waiter struct {
+	id       uint64
+	kind     waiterKind
+	deadline time.Time
+	period   time.Duration
+	channel  chan time.Time
+	function func()
+}
+
+// VirtualClock is a Clock whose time only moves when Advance or Set is called
+type VirtualClock struct {
+	now     time.Time
+	waiters []*waiter
+	nextID  uint64
+	changed *sync.Cond
+	mu      sync.Mutex
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	c := &VirtualClock{now: start}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *VirtualClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep blocks until the clock has been advanced by d
+func (c *VirtualClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	channel := make(chan time.Time, 1)
+	c.add(&waiter{kind: waiterAfter, channel: channel}, d)
+	return channel
+}
+
+func (c *VirtualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for VirtualClock.NewTicker")
+	}
+	w := &waiter{kind: waiterTicker, period: d, channel: make(chan time.Time, virtualTickerBuffer)}
+	c.add(w, d)
+	return &virtualTicker{clock: c, waiter: w}
+}
+
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) Timer {
+	w := &waiter{kind: waiterFunc, function: f}
+	c.add(w, d)
+	return &virtualTimer{clock: c, waiter: w}
+}
+
+func (c *VirtualClock) add(w *waiter, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	w.id = c.nextID
+	w.deadline = c.now.Add(d)
+	c.waiters = append(c.waiters, w)
+	c.changed.Broadcast()
+}
+
+// remove reports whether the waiter was still pending
+func (c *VirtualClock) remove(target *waiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.removeLocked(target)
+}
+
+// Waiters returns the number of pending sleeps, timers and tickers
+func (c *VirtualClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until at least n sleeps, timers or tickers are pending. Tests use it to make sure a goroutine
+// reached its Sleep or created its ticker before they advance the clock.
+func (c *VirtualClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.changed.Wait()
+	}
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker that falls due in order of their deadlines
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock forward to t. Moving the clock backwards is ignored.
+func (c *VirtualClock) Set(t time.Time) {
+	for {
+		c.mu.Lock()
+		due := c.nextDue(t)
+		if due == nil {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+		c.now = due.deadline
+		switch due.kind {
+		case waiterTicker:
+			select {
+			case due.channel <- due.deadline:
+			default:
+			}
+			due.deadline = due.deadline.Add(due.period)
+		case waiterAfter:
+			c.removeLocked(due)
+			due.channel <- due.deadline
+		case waiterFunc:
+			c.removeLocked(due)
+		}
+		c.mu.Unlock()
+		if due.kind == waiterFunc {
+			go due.function()
+		}
+	}
+}
+
+// nextDue returns the pending waiter with the earliest deadline not after t, ties are fired in creation order
+func (c *VirtualClock) nextDue(t time.Time) *waiter {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		if c.waiters[i].deadline.Equal(c.waiters[j].deadline) {
+			return c.waiters[i].id < c.waiters[j].id
+		}
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+	if len(c.waiters) == 0 || c.waiters[0].deadline.After(t) {
+		return nil
+	}
+	return c.waiters[0]
+}
+
+func (c *VirtualClock) removeLocked(target *waiter) bool {
+	for i, w := range c.waiters {
+		if w == target {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type virtualTicker struct {
+	clock  *VirtualClock
+	waiter *waiter
+}
+
+func (t *virtualTicker) C() <-chan time.Time {
+	return t.waiter.channel
+}
+
+func (t *virtualTicker) Stop() {
+	t.clock.remove(t.waiter)
+}
+
+type virtualTimer struct {
+	clock  *VirtualClock
+	waiter *waiter
+}
+
+func (t *virtualTimer) Stop() bool {
+	return t.clock.remove(t.waiter)
+}
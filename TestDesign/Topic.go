@@ -0,0 +1,217 @@
+package TestDesign
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+/*
+This file contains typed topics. Values travel through the mediator as interface{}, so a subscriber of a plain
+topic type-asserts every value it receives, and a publisher that changes the type it publishes breaks its
+subscribers without either of them noticing. A Topic[T] publishes and subscribes with values of type T:
+
+    var Temperature = TestDesign.NewTopic[float64]("temperature")
+
+    Temperature.Publish(sensor, 21.5)
+    err := Temperature.Subscribe(display, "sensor", func(celsius float64) { ... })
+
+The publisher owns the type of its topic: Publish, or Declare before the first Publish, declares it at the
+mediator, and declaring it with another type returns ErrTopicType. Subscribe states the type the subscriber
+expects. It returns ErrTopicType when the publisher declared another type, so a subscriber expecting int from a
+publisher of float64 fails when it subscribes instead of missing every value. Before the publisher declared its
+topic the expectation is kept and checked when it does, a wrong subscriber is reported then and drops the values,
+it never keeps the publisher from publishing. The mediator drops a value of another type published on a declared
+topic through PublishToTopic.
+*/
+
+// ErrTopicType is returned when a topic is published with another type than it was declared with, or subscribed to
+// with another type than its publisher declared
+var ErrTopicType = errors.New("topic has another type")
+
+// TopicDeclarer is implemented by the mediators that check the types of typed topics, a mediator that doesn't
+// leaves the check to the subscribers, which drop values of the wrong type
+type TopicDeclarer interface {
+	// DeclareTopic records the type of a topic of its publisher
+	DeclareTopic(publisherID, topic string, valueType reflect.Type) error
+	// ExpectTopic records the type subscriberID expects from a topic of publisherID, a nil valueType removes it
+	ExpectTopic(subscriberID, publisherID, topic string, valueType reflect.Type) error
+}
+
+// TopicMismatch is a subscriber that expects another type than the publisher declared
+type TopicMismatch struct {
+	SubscriberID string
+	Expected     reflect.Type
+}
+
+// TopicTypes holds the type every typed topic was declared with by its publisher, and the types its subscribers
+// expect
+type TopicTypes struct {
+	// types maps a publisher to the types of its topics
+	types map[string]map[string]reflect.Type
+	// expected maps a publisher and topic to the type every subscriber expects
+	expected map[string]map[string]reflect.Type
+	mu       sync.RWMutex
+}
+
+// Declare records that topic of publisherID carries values of valueType, it fails when it was declared with another.
+// It returns the subscribers that expect another type, the declaration stands regardless.
+func (t *TopicTypes) Declare(publisherID, topic string, valueType reflect.Type) ([]TopicMismatch, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if declared, ok := t.types[publisherID][topic]; ok {
+		if declared != valueType {
+			return nil, fmt.Errorf("%w: %s:%s is %s, not %s", ErrTopicType, publisherID, topic, declared, valueType)
+		}
+		return nil, nil
+	}
+	if t.types == nil {
+		t.types = make(map[string]map[string]reflect.Type)
+	}
+	if t.types[publisherID] == nil {
+		t.types[publisherID] = make(map[string]reflect.Type)
+	}
+	t.types[publisherID][topic] = valueType
+
+	var mismatches []TopicMismatch
+	for subscriberID, expected := range t.expected[publisherID+":"+topic] {
+		if expected != valueType {
+			mismatches = append(mismatches, TopicMismatch{SubscriberID: subscriberID, Expected: expected})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].SubscriberID < mismatches[j].SubscriberID })
+	return mismatches, nil
+}
+
+// Expect records that subscriberID expects values of valueType from topic of publisherID, it fails when the
+// publisher declared another type. A nil valueType removes the expectation.
+func (t *TopicTypes) Expect(subscriberID, publisherID, topic string, valueType reflect.Type) error {
+	key := publisherID + ":" + topic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if valueType == nil {
+		delete(t.expected[key], subscriberID)
+		if len(t.expected[key]) == 0 {
+			delete(t.expected, key)
+		}
+		return nil
+	}
+	if declared, ok := t.types[publisherID][topic]; ok && declared != valueType {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrTopicType, key, declared, valueType)
+	}
+	if t.expected == nil {
+		t.expected = make(map[string]map[string]reflect.Type)
+	}
+	if t.expected[key] == nil {
+		t.expected[key] = make(map[string]reflect.Type)
+	}
+	t.expected[key][subscriberID] = valueType
+	return nil
+}
+
+// Type returns the type topic of publisherID was declared with
+func (t *TopicTypes) Type(publisherID, topic string) (reflect.Type, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	valueType, ok := t.types[publisherID][topic]
+	return valueType, ok
+}
+
+// Forget removes the declarations of the topics of moduleID and the types it expects as a subscriber, a module
+// registered under its id later on can publish and expect other types. What the subscribers of moduleID expect
+// is kept and checked against the declarations of that module.
+func (t *TopicTypes) Forget(moduleID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.types, moduleID)
+	for key, subscribers := range t.expected {
+		delete(subscribers, moduleID)
+		if len(subscribers) == 0 {
+			delete(t.expected, key)
+		}
+	}
+}
+
+// Check returns an error when value can't be published on topic of publisherID, undeclared topics take any value
+func (t *TopicTypes) Check(publisherID, topic string, value interface{}) error {
+	declared, ok := t.Type(publisherID, topic)
+	if !ok || assignable(value, declared) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s:%s is %s, not %T", ErrTopicType, publisherID, topic, declared, value)
+}
+
+// assignable reports whether value is a valid value of valueType, nil only is for interface types
+func assignable(value interface{}, valueType reflect.Type) bool {
+	if value == nil {
+		return valueType.Kind() == reflect.Interface
+	}
+	return reflect.TypeOf(value).AssignableTo(valueType)
+}
+
+type Topic[T any] struct {
+	name string
+}
+
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{name: name}
+}
+
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+// Type is T, the type of the values of the topic
+func (t Topic[T]) Type() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Declare declares the type of the topic of publisher at its mediator, Publish does so as well. Declaring before
+// the first Publish lets subscribers that expect another type fail when they subscribe.
+func (t Topic[T]) Declare(publisher *BaseModule) error {
+	declarer, ok := publisher.Mediator.(TopicDeclarer)
+	if !ok {
+		return nil
+	}
+	return declarer.DeclareTopic(publisher.id, t.name, t.Type())
+}
+
+// Publish publishes value on the topic of publisher
+func (t Topic[T]) Publish(publisher *BaseModule, value T) error {
+	if err := t.Declare(publisher); err != nil {
+		return err
+	}
+	publisher.PublishToTopic(t.name, value)
+	return nil
+}
+
+// Subscribe subscribes module to the topic of publisherID and calls callback with every value published on it,
+// instead of the NotificationCallback of the module. It fails when the publisher declared another type than T.
+func (t Topic[T]) Subscribe(module *BaseModule, publisherID string, callback func(T)) error {
+	if declarer, ok := module.Mediator.(TopicDeclarer); ok {
+		if err := declarer.ExpectTopic(module.id, publisherID, t.name, t.Type()); err != nil {
+			return err
+		}
+	}
+	module.setTopicHandler(publisherID, t.name, func(value interface{}) bool {
+		typed, ok := value.(T)
+		if !ok && (value != nil || t.Type().Kind() != reflect.Interface) {
+			return false
+		}
+		callback(typed)
+		return true
+	})
+	module.SubscribeToTopic(t.name, publisherID)
+	return nil
+}
+
+// Unsubscribe undoes Subscribe
+func (t Topic[T]) Unsubscribe(module *BaseModule, publisherID string) {
+	if declarer, ok := module.Mediator.(TopicDeclarer); ok {
+		declarer.ExpectTopic(module.id, publisherID, t.name, nil)
+	}
+	module.setTopicHandler(publisherID, t.name, nil)
+	module.UnsubscribeFromTopic(t.name, publisherID)
+}
@@ -0,0 +1,68 @@
+package TestDesign
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTopicSubscriberCannotFixThePublishersType(t *testing.T) {
+	mc := NewMasterController()
+	publisher := NewModuleWithDataSource("sensor", mc, nil)
+	subscriber := NewModuleWithDataSource("display", mc, nil)
+	mc.RegisterModule(publisher)
+	mc.RegisterModule(subscriber)
+
+	// The subscriber is wrong, but subscribes before the publisher published anything
+	if err := NewTopic[int]("temperature").Subscribe(subscriber, "sensor", func(int) {}); err != nil {
+		t.Fatalf("subscribing to an undeclared topic failed: %v", err)
+	}
+	temperature := NewTopic[float64]("temperature")
+	if err := temperature.Publish(publisher, 21.5); err != nil {
+		t.Fatalf("the publisher of the topic failed to publish: %v", err)
+	}
+	if err := temperature.Publish(publisher, 22); err != nil {
+		t.Fatalf("the publisher of the topic failed to publish again: %v", err)
+	}
+
+	late := NewModuleWithDataSource("logger", mc, nil)
+	mc.RegisterModule(late)
+	if err := NewTopic[int]("temperature").Subscribe(late, "sensor", func(int) {}); !errors.Is(err, ErrTopicType) {
+		t.Fatalf("subscribing with the wrong type to a declared topic returned %v, expected ErrTopicType", err)
+	}
+	if err := temperature.Subscribe(late, "sensor", func(float64) {}); err != nil {
+		t.Fatalf("subscribing with the declared type failed: %v", err)
+	}
+	if err := NewTopic[string]("temperature").Publish(publisher, "warm"); !errors.Is(err, ErrTopicType) {
+		t.Fatalf("publishing another type returned %v, expected ErrTopicType", err)
+	}
+}
+
+func TestTopicTypesReportPendingExpectationsOnDeclare(t *testing.T) {
+	var types TopicTypes
+	intType, floatType := reflect.TypeOf(0), reflect.TypeOf(0.0)
+	if err := types.Expect("display", "sensor", "temperature", intType); err != nil {
+		t.Fatal(err)
+	}
+	if err := types.Expect("logger", "sensor", "temperature", floatType); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := types.Declare("sensor", "temperature", floatType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0].SubscriberID != "display" || mismatches[0].Expected != intType {
+		t.Fatalf("reported %v, expected display expecting int", mismatches)
+	}
+
+	// A publisher registered again under the same id is checked against the subscribers that stayed
+	types.Forget("sensor")
+	if mismatches, _ := types.Declare("sensor", "temperature", intType); len(mismatches) != 1 || mismatches[0].SubscriberID != "logger" {
+		t.Fatalf("reported %v after the publisher was registered again, expected logger", mismatches)
+	}
+	types.Expect("logger", "sensor", "temperature", nil)
+	types.Forget("sensor")
+	if mismatches, _ := types.Declare("sensor", "temperature", floatType); len(mismatches) != 1 || mismatches[0].SubscriberID != "display" {
+		t.Fatalf("reported %v after logger unsubscribed, expected display", mismatches)
+	}
+}
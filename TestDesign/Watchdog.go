@@ -0,0 +1,162 @@
+package TestDesign
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+This file implements the heartbeat watchdog of the MasterController. Modules that have a HeartbeatConfig send a
+HeartbeatCommand to the controller at the configured interval from their background process. A module whose
+goroutine deadlocks therefore stops sending heartbeats, even though its state still reads RunningState.
+
+The watchdog periodically compares the time of the last heartbeat of every running module against its interval
+plus grace period. When a module is overdue it is moved to ErrorState, an EventHeartbeatLost event is raised and
+the module id is published on the "heartbeatLost" topic of the "watchdog" publisher, so modules can subscribe to it.
+*/
+
+const (
+	// WatchdogID is the publisher id used for values published by the watchdog
+	WatchdogID = "watchdog"
+	// HeartbeatLostTopic is the topic on which the watchdog publishes the id of an unresponsive module
+	HeartbeatLostTopic = "heartbeatLost"
+
+	defaultWatchdogCheckInterval = 100 * time.Millisecond
+)
+
+// HeartbeatsLost is HeartbeatLostTopic as a typed topic
+var HeartbeatsLost = NewTopic[string](HeartbeatLostTopic)
+
+// HeartbeatConfig configures how often a module sends heartbeats and how late they may be.
+// A zero Interval disables heartbeats for the module.
+type HeartbeatConfig struct {
+	Interval    time.Duration
+	GracePeriod time.Duration
+}
+
+// Deadline returns how long after the last heartbeat a module is considered unresponsive
+func (c HeartbeatConfig) Deadline() time.Duration {
+	return c.Interval + c.GracePeriod
+}
+
+type Watchdog struct {
+	controller    *MasterController
+	checkInterval time.Duration
+	lastBeat      map[string]time.Time
+	expired       map[string]bool
+	stopChan      chan struct{}
+	running       bool
+	mu            sync.Mutex
+}
+
+func NewWatchdog(controller *MasterController, checkInterval time.Duration) *Watchdog {
+	if checkInterval <= 0 {
+		checkInterval = defaultWatchdogCheckInterval
+	}
+	return &Watchdog{
+		controller:    controller,
+		checkInterval: checkInterval,
+		lastBeat:      make(map[string]time.Time),
+		expired:       make(map[string]bool),
+	}
+}
+
+// Start runs the periodic check in a goroutine until Stop is called
+func (w *Watchdog) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		return
+	}
+	w.running = true
+	w.stopChan = make(chan struct{})
+	go w.run(w.stopChan)
+}
+
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		w.running = false
+		close(w.stopChan)
+	}
+}
+
+func (w *Watchdog) IsRunning() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.running
+}
+
+func (w *Watchdog) run(stopChan chan struct{}) {
+	ticker := w.controller.clock.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C():
+			w.Check()
+		}
+	}
+}
+
+// Beat records a heartbeat for the given module
+func (w *Watchdog) Beat(moduleID string) {
+	w.mu.Lock()
+	w.lastBeat[moduleID] = w.controller.clock.Now()
+	delete(w.expired, moduleID)
+	w.mu.Unlock()
+}
+
+// Expired returns the ids of the modules whose heartbeats are currently overdue
+func (w *Watchdog) Expired() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]string, 0, len(w.expired))
+	for id := range w.expired {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Check moves every running module whose heartbeat is overdue to ErrorState
+func (w *Watchdog) Check() {
+	now := w.controller.clock.Now()
+	var lost []*BaseModule
+
+	w.mu.Lock()
+	modules := w.controller.snapshotModules()
+	for id := range w.lastBeat {
+		if _, registered := modules[id]; !registered {
+			delete(w.lastBeat, id)
+			delete(w.expired, id)
+		}
+	}
+	for id, module := range modules {
+		config := module.GetHeartbeatConfig()
+		if config.Interval <= 0 || module.GetState() != RunningState {
+			// Restart the grace period so a recovering module isn't flagged straight away
+			w.lastBeat[id] = now
+			continue
+		}
+		last, seen := w.lastBeat[id]
+		if !seen {
+			w.lastBeat[id] = now
+			continue
+		}
+		if now.Sub(last) > config.Deadline() && !w.expired[id] {
+			w.expired[id] = true
+			lost = append(lost, module)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, module := range lost {
+		fmt.Printf("Watchdog: module %s missed its heartbeat, moving it to error state.\n", module.GetId())
+		module.SetState(ErrorState)
+		w.controller.raiseEvent(Event{Type: EventHeartbeatLost, ModuleID: module.GetId()})
+		w.controller.NotifySubscribers(WatchdogID, HeartbeatLostTopic, module.GetId())
+	}
+}
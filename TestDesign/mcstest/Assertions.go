@@ -0,0 +1,129 @@
+package mcstest
+
+import (
+	"fmt"
+	"mcs/TestDesign"
+	"reflect"
+	"time"
+)
+
+// pollInterval is how often the Expect functions look at the recorded values while waiting
+const pollInterval = time.Millisecond
+
+// TB is the part of testing.TB the assertion helpers need
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// NotificationMatcher selects notifications. Empty fields and a nil Value match anything.
+type NotificationMatcher struct {
+	PublisherID  string
+	SubscriberID string
+	Topic        string
+	Value        interface{}
+}
+
+func (m NotificationMatcher) Matches(notification Notification) bool {
+	if m.PublisherID != "" && m.PublisherID != notification.PublisherID {
+		return false
+	}
+	if m.SubscriberID != "" && m.SubscriberID != notification.SubscriberID {
+		return false
+	}
+	if m.Topic != "" && m.Topic != notification.Topic {
+		return false
+	}
+	return m.Value == nil || reflect.DeepEqual(m.Value, notification.Value)
+}
+
+func (m NotificationMatcher) String() string {
+	return fmt.Sprintf("topic %q from %q to %q with value %v", m.Topic, m.PublisherID, m.SubscriberID, m.Value)
+}
+
+// ExpectNotification waits up to within, in real time, for source to record a notification on topic from
+// publisherID with the given value and fails the test when none arrives
+func ExpectNotification(t TB, source NotificationSource, publisherID, topic string, value interface{}, within time.Duration) bool {
+	t.Helper()
+	return ExpectMatch(t, source, NotificationMatcher{PublisherID: publisherID, Topic: topic, Value: value}, within)
+}
+
+// ExpectMatch waits up to within, in real time, for source to record a notification matching matcher
+func ExpectMatch(t TB, source NotificationSource, matcher NotificationMatcher, within time.Duration) bool {
+	t.Helper()
+	if waitFor(within, func() bool { return countMatches(source, matcher) > 0 }) {
+		return true
+	}
+	t.Errorf("expected %s within %v, got %d notifications: %v", matcher, within, len(source.Notifications()), source.Notifications())
+	return false
+}
+
+// ExpectNoNotification fails the test when source records a notification matching matcher during the given time
+func ExpectNoNotification(t TB, source NotificationSource, matcher NotificationMatcher, during time.Duration) bool {
+	t.Helper()
+	if waitFor(during, func() bool { return countMatches(source, matcher) > 0 }) {
+		t.Errorf("expected no %s, got %v", matcher, source.Notifications())
+		return false
+	}
+	return true
+}
+
+// ExpectSubscription fails the test when mediator doesn't have the subscription
+func ExpectSubscription(t TB, mediator *RecordingMediator, subscriberID, publisherID, topic string) bool {
+	t.Helper()
+	expected := Subscription{SubscriberID: subscriberID, PublisherID: publisherID, Topic: topic}
+	for _, subscription := range mediator.Subscriptions() {
+		if subscription == expected {
+			return true
+		}
+	}
+	t.Errorf("expected %s to be subscribed to %s:%s, subscriptions are %v", subscriberID, publisherID, topic, mediator.Subscriptions())
+	return false
+}
+
+// ExpectCommand fails the test when mediator didn't record a command of the same type as example sent to targetID
+func ExpectCommand(t TB, mediator *RecordingMediator, example TestDesign.ICommand, targetID string) bool {
+	t.Helper()
+	expectedType := reflect.TypeOf(example)
+	for _, command := range mediator.Commands() {
+		if reflect.TypeOf(command.Command) == expectedType && command.TargetID == targetID {
+			return true
+		}
+	}
+	t.Errorf("expected a %v sent to %q", expectedType, targetID)
+	return false
+}
+
+// ExpectState waits up to within, in real time, for module to reach state
+func ExpectState(t TB, module *TestDesign.BaseModule, state TestDesign.State, within time.Duration) bool {
+	t.Helper()
+	if waitFor(within, func() bool { return module.GetState() == state }) {
+		return true
+	}
+	t.Errorf("expected module %s to be in state %v within %v, it is in state %v", module.GetId(), state, within, module.GetState())
+	return false
+}
+
+func countMatches(source NotificationSource, matcher NotificationMatcher) int {
+	count := 0
+	for _, notification := range source.Notifications() {
+		if matcher.Matches(notification) {
+			count++
+		}
+	}
+	return count
+}
+
+// waitFor polls condition until it holds or timeout passed and reports whether it held
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,150 @@
+package mcstest
+
+import (
+	"mcs/TestDesign"
+	"mcs/TestDesign/DataSources"
+	"mcs/TestDesign/Timing"
+	"sync"
+	"time"
+)
+
+// settleRounds is the number of consecutive idle checks after which Settle assumes the system is quiet
+const settleRounds = 3
+
+// Harness is an isolated MasterController running under a virtual clock, for integration tests
+type Harness struct {
+	Controller    *TestDesign.MasterController
+	Clock         *Timing.VirtualClock
+	factory       TestDesign.IModuleFactory
+	notifications []Notification
+	mu            sync.Mutex
+}
+
+// NewHarness creates a MasterController with a VirtualClock that starts at the Unix epoch
+func NewHarness() *Harness {
+	clock := Timing.NewVirtualClock(time.Unix(0, 0).UTC())
+	h := &Harness{
+		Controller: TestDesign.NewMasterControllerWithClock(clock),
+		Clock:      clock,
+		factory:    &TestDesign.DefaultModuleFactory{},
+	}
+	h.Controller.AddEventListener(h.record)
+	return h
+}
+
+func (h *Harness) record(event TestDesign.Event) {
+	if event.Type != TestDesign.EventNotified {
+		return
+	}
+	h.mu.Lock()
+	h.notifications = append(h.notifications, Notification{
+		PublisherID:  event.PublisherID,
+		SubscriberID: event.SubscriberID,
+		Topic:        event.Topic,
+		Value:        event.Value,
+		Time:         event.Time,
+	})
+	h.mu.Unlock()
+}
+
+// NewModule creates a module with the given data source and registers it, a nil source publishes nothing
+func (h *Harness) NewModule(id string, source DataSources.DataSource) *TestDesign.BaseModule {
+	module := h.factory.CreateModuleWithDataSource(id, h.Controller, source)
+	h.Register(module)
+	return module
+}
+
+// NewCompressorModule creates a compressor module and registers it. Its data source is RandomNumbers instead of
+// randomnumberapi.com, so the harness stays off the network.
+func (h *Harness) NewCompressorModule(id string, specialValue interface{}) *TestDesign.CompressorModule {
+	module := h.factory.CreateCompressorModule(id, h.Controller, specialValue)
+	module.SetDataSource(&RandomNumbers{})
+	h.Register(module)
+	return module
+}
+
+// NewDispenserModule creates a dispenser module with RandomNumbers as its data source and registers it
+func (h *Harness) NewDispenserModule(id string, specialValue interface{}) *TestDesign.DispenserModule {
+	module := h.factory.CreateDispenserModule(id, h.Controller, specialValue)
+	module.SetDataSource(&RandomNumbers{})
+	h.Register(module)
+	return module
+}
+
+// RandomNumbers stands in for DataSources.NewRandomNumberSource: it publishes the ints 1 ... 100, and then starts
+// over, on the "randomInt" topic every 500 ms
+type RandomNumbers struct {
+	last int
+	mu   sync.Mutex
+}
+
+func (s *RandomNumbers) Topic() string {
+	return "randomInt"
+}
+
+func (s *RandomNumbers) Period() time.Duration {
+	return 500 * time.Millisecond
+}
+
+func (s *RandomNumbers) Fetch() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = s.last%100 + 1
+	return s.last, nil
+}
+
+// Register registers a module created elsewhere with the controller of the harness
+func (h *Harness) Register(module interface{}) {
+	if err := h.Controller.RegisterModule(module); err != nil {
+		panic(err)
+	}
+}
+
+func (h *Harness) Notifications() []Notification {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Notification(nil), h.notifications...)
+}
+
+// ClearNotifications forgets the notifications recorded so far
+func (h *Harness) ClearNotifications() {
+	h.mu.Lock()
+	h.notifications = nil
+	h.mu.Unlock()
+}
+
+// Settle waits, in real time, until the goroutines of the controller and its modules stopped sending commands
+func (h *Harness) Settle() {
+	for quiet := 0; quiet < settleRounds; {
+		h.Controller.WaitIdle()
+		time.Sleep(pollInterval)
+		if h.Controller.Pending() == 0 {
+			quiet++
+		} else {
+			quiet = 0
+		}
+	}
+}
+
+// Advance moves the virtual clock forward in steps, settling after every step so tickers that fire in a step are
+// handled before the next one. A step of zero advances in one go.
+func (h *Harness) Advance(d, step time.Duration) {
+	if step <= 0 || step > d {
+		step = d
+	}
+	for remaining := d; remaining > 0; remaining -= step {
+		if remaining < step {
+			step = remaining
+		}
+		h.Clock.Advance(step)
+		h.Settle()
+	}
+}
+
+// Close stops the watchdog and the background processes of the running modules
+func (h *Harness) Close() {
+	h.Controller.GetWatchdog().Stop()
+	for _, module := range h.Controller.GetModules() {
+		module.StopBackgroundProcess()
+	}
+}
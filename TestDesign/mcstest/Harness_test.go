@@ -0,0 +1,121 @@
+package mcstest
+
+import (
+	"mcs/TestDesign"
+	_ "mcs/TestDesign/Strategies/CompressorStrategies"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHarnessCompressorModulePublishesSimulatedNumbers(t *testing.T) {
+	h := NewHarness()
+	defer h.Close()
+	compressor := h.NewCompressorModule("compressor", "special")
+	display := h.NewModule("display", nil)
+	display.SubscribeToTopic("randomInt", "compressor")
+	h.Settle()
+
+	// The sample ticker is the first waiter the background process adds
+	waiters := h.Clock.Waiters()
+	compressor.TransitionToRunning()
+	h.Clock.BlockUntil(waiters + 1)
+	h.Advance(500*time.Millisecond, 0)
+
+	ExpectNotification(t, h, "compressor", "randomInt", 1, time.Second)
+}
+
+func TestRandomNumbersStartOver(t *testing.T) {
+	source := &RandomNumbers{}
+	for want := 1; want <= 201; want++ {
+		value, err := source.Fetch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (want-1)%100 + 1; value != expected {
+			t.Fatalf("fetch %d returned %v, expected %d", want, value, expected)
+		}
+	}
+}
+
+func TestRecordingMediatorExecutesCommandsSynchronously(t *testing.T) {
+	mediator := NewRecordingMediator()
+	publisher := TestDesign.NewModuleWithDataSource("publisher", mediator, nil)
+	subscriber := TestDesign.NewModuleWithDataSource("subscriber", mediator, nil)
+	mediator.Register(publisher)
+	mediator.Register(subscriber)
+
+	subscriber.SubscribeToTopic("temperature", "publisher")
+	ExpectSubscription(t, mediator, "subscriber", "publisher", "temperature")
+
+	publisher.PublishToTopic("temperature", 21.5)
+	ExpectNotification(t, mediator, "publisher", "temperature", 21.5, 0)
+}
+
+func TestProcessingOnlyTakesTheInputPublisher(t *testing.T) {
+	h := NewHarness()
+	defer h.Close()
+	compressor := h.NewCompressorModule("compressor", nil)
+	if err := compressor.ConfigureStrategy("reverse", nil); err != nil {
+		t.Fatal(err)
+	}
+	sensor := h.NewModule("sensor", nil)
+	other := h.NewModule("other", nil)
+	display := h.NewModule("display", nil)
+
+	var received []interface{}
+	var mu sync.Mutex
+	compressor.SetNotificationCallback(func(valueName string, value interface{}) {
+		mu.Lock()
+		received = append(received, value)
+		mu.Unlock()
+	})
+	if err := compressor.StartProcessing(TestDesign.ProcessingConfig{InputPublisher: "sensor", InputTopic: "reading"}); err != nil {
+		t.Fatal(err)
+	}
+	compressor.SubscribeToTopic("reading", "other")
+	display.SubscribeToTopic(TestDesign.ProcessedTopic, "compressor")
+	h.Settle()
+
+	sensor.PublishToTopic("reading", "abc")
+	other.PublishToTopic("reading", "xyz")
+	h.Settle()
+
+	ExpectNotification(t, h, "compressor", TestDesign.ProcessedTopic, []byte("cba"), time.Second)
+	for _, notification := range h.Notifications() {
+		if notification.Topic == TestDesign.ProcessedTopic && string(notification.Value.([]byte)) != "cba" {
+			t.Fatalf("processed %s, which another publisher published", notification.Value)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0] != "xyz" {
+		t.Fatalf("the notification callback received %v, expected the value of the other publisher", received)
+	}
+}
+
+func TestRecordingMediatorDropsValuesOfTheWrongType(t *testing.T) {
+	mediator := NewRecordingMediator()
+	publisher := TestDesign.NewModuleWithDataSource("publisher", mediator, nil)
+	subscriber := TestDesign.NewModuleWithDataSource("subscriber", mediator, nil)
+	mediator.Register(publisher)
+	mediator.Register(subscriber)
+
+	temperature := TestDesign.NewTopic[float64]("temperature")
+	var received []float64
+	if err := temperature.Subscribe(subscriber, "publisher", func(value float64) { received = append(received, value) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := temperature.Publish(publisher, 21.5); err != nil {
+		t.Fatal(err)
+	}
+	// An untyped publish bypasses the check of Topic.Publish
+	publisher.PublishToTopic("temperature", "warm")
+
+	if notifications := mediator.Notifications(); len(notifications) != 1 || notifications[0].Value != 21.5 {
+		t.Fatalf("recorded %v, expected only the float64 value", notifications)
+	}
+	if len(received) != 1 || received[0] != 21.5 {
+		t.Fatalf("subscriber received %v", received)
+	}
+}
@@ -0,0 +1,216 @@
+package mcstest
+
+import (
+	"fmt"
+	"mcs/TestDesign"
+	"mcs/TestDesign/Timing"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+Package mcstest contains helpers for testing modules and the mediator.
+
+    RecordingMediator is a fake IMediator for unit tests of a single module. It records every command, subscription,
+    heartbeat and notification, and executes commands synchronously so a test doesn't have to wait for workers.
+
+    Harness spins up an isolated MasterController under a Timing.VirtualClock for integration tests and records
+    the notifications the controller delivers.
+
+    The Expect functions assert on what a RecordingMediator or Harness recorded.
+*/
+
+type RecordedCommand struct {
+	Command  TestDesign.ICommand
+	TargetID string
+	Time     time.Time
+	// Err is the error returned by executing the command on its target
+	Err error
+}
+
+type Subscription struct {
+	SubscriberID string
+	PublisherID  string
+	Topic        string
+}
+
+// Notification is a value that was delivered to a subscriber
+type Notification struct {
+	PublisherID  string
+	SubscriberID string
+	Topic        string
+	Value        interface{}
+	Time         time.Time
+}
+
+// NotificationSource is implemented by everything that records notifications
+type NotificationSource interface {
+	Notifications() []Notification
+}
+
+type RecordingMediator struct {
+	clock         Timing.Clock
+	modules       map[string]*TestDesign.BaseModule
+	subscriptions map[Subscription]bool
+	commands      []RecordedCommand
+	notifications []Notification
+	heartbeats    map[string]int
+	topicTypes    TestDesign.TopicTypes
+	mu            sync.Mutex
+}
+
+func NewRecordingMediator() *RecordingMediator {
+	return NewRecordingMediatorWithClock(Timing.RealClock{})
+}
+
+func NewRecordingMediatorWithClock(clock Timing.Clock) *RecordingMediator {
+	return &RecordingMediator{
+		clock:         clock,
+		modules:       make(map[string]*TestDesign.BaseModule),
+		subscriptions: make(map[Subscription]bool),
+		heartbeats:    make(map[string]int),
+	}
+}
+
+// Register makes the module the target of commands sent to its id and a receiver of notifications
+func (r *RecordingMediator) Register(module *TestDesign.BaseModule) {
+	module.SetClock(r.clock)
+	r.mu.Lock()
+	r.modules[module.GetId()] = module
+	r.mu.Unlock()
+}
+
+func (r *RecordingMediator) SendCommand(command TestDesign.ICommand, targetID string) {
+	r.mu.Lock()
+	index := len(r.commands)
+	r.commands = append(r.commands, RecordedCommand{Command: command, TargetID: targetID, Time: r.clock.Now()})
+	target := r.modules[targetID]
+	r.mu.Unlock()
+
+	if target == nil {
+		// The module under test usually talks to modules that don't exist in a unit test, apply what doesn't
+		// depend on the target so subscriptions are still recorded
+		switch c := command.(type) {
+		case *TestDesign.SubscribeCommand:
+			r.Subscribe(c.GetSubscriberID(), c.GetTargetID(), c.GetTopic())
+		case *TestDesign.UnsubscribeCommand:
+			r.Unsubscribe(c.GetSubscriberID(), c.GetTargetID(), c.GetTopic())
+		}
+		return
+	}
+	if err := command.Execute(target); err != nil {
+		r.mu.Lock()
+		r.commands[index].Err = err
+		r.mu.Unlock()
+	}
+}
+
+func (r *RecordingMediator) GetModule(id string) *TestDesign.BaseModule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.modules[id]
+}
+
+func (r *RecordingMediator) Subscribe(subscriberID, publisherID, valueName string) {
+	r.mu.Lock()
+	r.subscriptions[Subscription{SubscriberID: subscriberID, PublisherID: publisherID, Topic: valueName}] = true
+	r.mu.Unlock()
+}
+
+func (r *RecordingMediator) Unsubscribe(subscriberID, publisherID, valueName string) {
+	r.mu.Lock()
+	delete(r.subscriptions, Subscription{SubscriberID: subscriberID, PublisherID: publisherID, Topic: valueName})
+	r.mu.Unlock()
+}
+
+// NotifySubscribers records a notification for every subscriber and delivers it to the registered ones.
+// Subscribers that aren't registered are recorded as well, so a module can be tested on its own. A value of the
+// wrong type for a typed topic is dropped like the MasterController drops it, and isn't recorded.
+func (r *RecordingMediator) NotifySubscribers(publisherID, valueName string, value interface{}) {
+	if err := r.topicTypes.Check(publisherID, valueName, value); err != nil {
+		fmt.Printf("RecordingMediator dropped a value: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	var receivers []*TestDesign.BaseModule
+	for subscription := range r.subscriptions {
+		if subscription.PublisherID != publisherID || subscription.Topic != valueName {
+			continue
+		}
+		r.notifications = append(r.notifications, Notification{
+			PublisherID:  publisherID,
+			SubscriberID: subscription.SubscriberID,
+			Topic:        valueName,
+			Value:        value,
+			Time:         r.clock.Now(),
+		})
+		if module := r.modules[subscription.SubscriberID]; module != nil {
+			receivers = append(receivers, module)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, module := range receivers {
+		if module.GetState() != TestDesign.ErrorState {
+			module.NotifySubscriberFrom(publisherID, valueName, value)
+		}
+	}
+}
+
+// DeclareTopic checks the types of typed topics like the MasterController does
+func (r *RecordingMediator) DeclareTopic(publisherID, topic string, valueType reflect.Type) error {
+	mismatches, err := r.topicTypes.Declare(publisherID, topic, valueType)
+	for _, mismatch := range mismatches {
+		fmt.Printf("RecordingMediator: %s expects %s from %s:%s, which is declared as %s\n", mismatch.SubscriberID, mismatch.Expected, publisherID, topic, valueType)
+	}
+	return err
+}
+
+// ExpectTopic records the type a subscriber of a typed topic expects, like the MasterController does
+func (r *RecordingMediator) ExpectTopic(subscriberID, publisherID, topic string, valueType reflect.Type) error {
+	return r.topicTypes.Expect(subscriberID, publisherID, topic, valueType)
+}
+
+func (r *RecordingMediator) Heartbeat(moduleID string) {
+	r.mu.Lock()
+	r.heartbeats[moduleID]++
+	r.mu.Unlock()
+}
+
+func (r *RecordingMediator) Commands() []RecordedCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedCommand(nil), r.commands...)
+}
+
+func (r *RecordingMediator) Subscriptions() []Subscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscriptions := make([]Subscription, 0, len(r.subscriptions))
+	for subscription := range r.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions
+}
+
+func (r *RecordingMediator) Notifications() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.notifications...)
+}
+
+func (r *RecordingMediator) Heartbeats(moduleID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.heartbeats[moduleID]
+}
+
+// Reset forgets everything that was recorded, subscriptions and registered modules are kept
+func (r *RecordingMediator) Reset() {
+	r.mu.Lock()
+	r.commands = nil
+	r.notifications = nil
+	r.heartbeats = make(map[string]int)
+	r.mu.Unlock()
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"mcs/TestDesign/Audit"
+	"mcs/TestDesign/Journal"
+	"mcs/TestDesign/Replay"
+	"mcs/TestDesign/Scenario"
+	"mcs/TestDesign/Strategies"
+	"mcs/TestDesign/Strategies/CompressorStrategies"
+	"mcs/TestDesign/Strategies/DispenserStrategies"
+	"mcs/TestDesign/Strategies/Pipeline"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+This file contains the command line interface of mcs. Without arguments mcs runs the subscriptions demo in main.go,
+otherwise the first arguments select a command:
+
+    mcs demo [-strategies <file>] run the subscriptions demo with the strategies of a config file, such as
+                                  configs/strategies.json
+    mcs scenario run <file>...    run scenario files against a MasterController under a virtual clock
+    mcs replay [-speed n] [-step] <journal dir>
+                                  replay a journal and report where the notifications diverge from the recording
+    mcs audit keygen <private key file> <public key file>
+                                  generate an ed25519 key pair to sign audit checkpoints with
+    mcs audit verify -key <public key file> [-anchor seq:hash] <audit log>
+                                  check that no audit record was modified, inserted or deleted, the anchor
+                                  printed by an earlier verify also detects a deleted tail. Records after the
+                                  last checkpoint fail as UNSIGNED unless the anchor covers them.
+    mcs bench compressors [-samples n] [-seed n]
+                                  compare the compression ratios of the compressor strategies on realistic signals
+    mcs strategies [kind]         list the registered strategies and their parameters
+    mcs keys rotate <keystore> hmac|ed25519
+                                  generate a new active key for the keyed dispensers
+    mcs keys list <keystore>      list the keys of a keystore
+    mcs keys retire <keystore> <key id>
+                                  stop a key from signing and verifying
+    mcs keys export <keystore> <public keystore>
+                                  write the public ed25519 keys to a keystore that can only verify
+    mcs keys verify -strategy name <keystore> <value> <signature>
+                                  check a signature of a keyed dispenser
+    mcs keys secret <key file>    generate a key file for the xchacha20-poly1305 dispenser
+    mcs stream [-reverse] <spec>  stream standard input through a pipeline such as "gzip|base64" to standard output
+*/
+
+const usage = `usage: mcs demo [-strategies <file>]
+       mcs scenario run <file>...
+       mcs replay [-speed n] [-step] <journal dir>
+       mcs audit keygen <private key file> <public key file>
+       mcs audit verify -key <public key file> [-anchor seq:hash] <audit log>
+       mcs bench compressors [-samples n] [-seed n]
+       mcs strategies [kind]
+       mcs keys rotate <keystore> hmac|ed25519
+       mcs keys list <keystore>
+       mcs keys retire <keystore> <key id>
+       mcs keys export <keystore> <public keystore>
+       mcs keys verify -strategy name <keystore> <value> <signature>
+       mcs keys secret <key file>
+       mcs stream [-reverse] <spec>`
+
+func runCommand(args []string) int {
+	switch {
+	case len(args) >= 1 && args[0] == "demo":
+		return runDemo(args[1:])
+	case len(args) >= 2 && args[0] == "scenario" && args[1] == "run":
+		return runScenarios(args[2:])
+	case len(args) >= 1 && args[0] == "replay":
+		return runReplay(args[1:])
+	case len(args) >= 2 && args[0] == "audit" && args[1] == "keygen":
+		return runAuditKeygen(args[2:])
+	case len(args) >= 2 && args[0] == "audit" && args[1] == "verify":
+		return runAuditVerify(args[2:])
+	case len(args) >= 2 && args[0] == "bench" && args[1] == "compressors":
+		return runCompressorBenchmarks(args[2:])
+	case len(args) >= 1 && args[0] == "strategies":
+		return runListStrategies(args[1:])
+	case len(args) >= 1 && args[0] == "stream":
+		return runStream(args[1:])
+	case len(args) >= 2 && args[0] == "keys":
+		return runKeys(args[1], args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+func runDemo(args []string) int {
+	flags := flag.NewFlagSet("demo", flag.ContinueOnError)
+	configPath := flags.String("strategies", "", "JSON file with a strategy config per module id")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	var configs map[string]Strategies.Config
+	if *configPath != "" {
+		var err error
+		if configs, err = Strategies.LoadConfigs(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	subscriptions(configs)
+	return 0
+}
+
+func runScenarios(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	exitCode := 0
+	for _, path := range paths {
+		scenario, err := Scenario.Load(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		report := Scenario.Run(scenario)
+		report.Write(os.Stdout)
+		if !report.Passed() {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := flags.Float64("speed", 0, "replay speed, 1 is real time and 0 doesn't wait between entries")
+	step := flags.Bool("step", false, "wait for enter before every step")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	reader, err := Journal.OpenReader(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	entries, err := reader.ReadAll()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	engine, err := Replay.New(entries, Replay.Options{Speed: *speed})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *step {
+		input := bufio.NewScanner(os.Stdin)
+		for {
+			next, ok := engine.Peek()
+			if !ok {
+				break
+			}
+			fmt.Printf("#%d %s %s (enter to replay, q to stop) ", next.Entry.Seq, next.Entry.Type, next.Entry.ModuleID)
+			if !input.Scan() || input.Text() == "q" {
+				break
+			}
+			replayed, _ := engine.Next()
+			for _, divergence := range replayed.Divergences {
+				fmt.Printf("  %s\n", divergence)
+			}
+		}
+	} else {
+		engine.Run()
+	}
+
+	report := engine.Report()
+	report.Write(os.Stdout)
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
+
+func runAuditKeygen(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err := Audit.GenerateKeyFiles(args[0], args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runAuditVerify(args []string) int {
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	keyPath := flags.String("key", "", "file with the hex ed25519 public key of the checkpoints")
+	anchorFlag := flags.String("anchor", "", "seq:hash of a record the log must still hold, as printed by an earlier verify")
+	if err := flags.Parse(args); err != nil || *keyPath == "" || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	key, err := Audit.LoadPublicKey(*keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var anchors []Audit.Anchor
+	if *anchorFlag != "" {
+		anchor, err := Audit.ParseAnchor(*anchorFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		anchors = append(anchors, anchor)
+	}
+	result, err := Audit.VerifyFile(flags.Arg(0), key, anchors...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	result.Write(os.Stdout)
+	if !result.Valid() {
+		return 1
+	}
+	return 0
+}
+
+func runCompressorBenchmarks(args []string) int {
+	flags := flag.NewFlagSet("bench compressors", flag.ContinueOnError)
+	samples := flags.Int("samples", 10000, "number of samples per signal")
+	seed := flags.Int64("seed", 1, "seed of the generated signals")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *samples <= 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	results := CompressorStrategies.RunBenchmarks(*samples, *seed)
+	CompressorStrategies.WriteBenchmarks(os.Stdout, results)
+	for _, result := range results {
+		if result.Err != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+func runListStrategies(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	kind := ""
+	if len(args) == 1 {
+		kind = args[0]
+	}
+	for _, d := range Strategies.List(kind) {
+		reversible := "one-way"
+		if d.Reversible {
+			reversible = "reversible"
+		}
+		fmt.Printf("%-11s %-22s %-6s %-10s %-28s %s\n", d.Kind, d.ID(), strings.Join(d.Aliases, ","), reversible, strings.Join(d.InputTypes, ","), d.Description)
+		for _, param := range d.Params {
+			fmt.Printf("%-11s   %s  %s\n", "", param, param.Description)
+		}
+	}
+	return 0
+}
+
+func runKeys(command string, args []string) int {
+	switch {
+	case command == "verify":
+		return runKeysVerify(args)
+	case command == "secret" && len(args) == 1:
+		if err := DispenserStrategies.GenerateKeyFile(args[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	expected := map[string]int{"rotate": 2, "list": 1, "retire": 2, "export": 2}
+	if n, ok := expected[command]; !ok || len(args) != n {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	keystore, err := DispenserStrategies.OpenKeystore(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch command {
+	case "rotate":
+		var key DispenserStrategies.Key
+		if key, err = keystore.Rotate(args[1]); err == nil {
+			fmt.Println(key.ID)
+		}
+	case "retire":
+		err = keystore.Retire(args[1])
+	case "export":
+		err = keystore.ExportPublic(args[1])
+	case "list":
+		var keys []DispenserStrategies.Key
+		keys, err = keystore.Keys()
+		for _, key := range keys {
+			status := "verifies"
+			if key.Retired {
+				status = "retired"
+			} else if active, _ := keystore.Active(key.Algorithm); active.ID == key.ID {
+				status = "active"
+			}
+			fmt.Printf("%-26s %-8s %-9s %s\n", key.ID, key.Algorithm, status, key.Created.Format(time.RFC3339))
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runKeysVerify(args []string) int {
+	flags := flag.NewFlagSet("keys verify", flag.ContinueOnError)
+	name := flags.String("strategy", "hmac-sha256", "keyed dispenser that produced the signature")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 3 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	strategy, err := Strategies.CreateWithParams(Strategies.KindDispenser, *name, map[string]interface{}{"keystore": flags.Arg(0)})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	verifier, ok := strategy.(DispenserStrategies.Verifier)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "dispenser strategy %s can't verify\n", *name)
+		return 1
+	}
+	if err := verifier.Verify(flags.Arg(1), flags.Arg(2)); err != nil {
+		fmt.Println("INVALID:", err)
+		return 1
+	}
+	fmt.Println("valid")
+	return 0
+}
+
+func runStream(args []string) int {
+	flags := flag.NewFlagSet("stream", flag.ContinueOnError)
+	reverse := flags.Bool("reverse", false, "undo the pipeline instead of running it")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	pipeline, err := Pipeline.Parse(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	output := bufio.NewWriter(os.Stdout)
+	if *reverse {
+		_, err = Strategies.ReverseCopy(pipeline, output, os.Stdin)
+	} else {
+		_, err = Strategies.Copy(pipeline, output, os.Stdin)
+	}
+	if err == nil {
+		err = output.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
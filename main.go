@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"math/rand"
 	"mcs/TestDesign"
+	"mcs/TestDesign/Strategies"
 	"mcs/TestDesign/Strategies/CompressorStrategies"
 	"mcs/TestDesign/Strategies/DispenserStrategies"
+	"os"
 	"sync"
 	"time"
 )
@@ -27,7 +29,7 @@ Key Components and Flow:
 
     Dynamic Subscription Management: The example includes dynamic subscription management, where Module1 unsubscribes from Module2's "x" value updates and then resubscribes after a delay. This showcases the flexibility of the mediator pattern in managing subscriptions.
 
-    Concurrency and Synchronization: The use of goroutines and the time.Sleep function to simulate asynchronous behavior and delays highlights the concurrency model of Go. It also demonstrates how the mediator pattern can manage concurrent operations, such as value updates and notifications.
+    Concurrency and Synchronization: The use of goroutines and the Sleep function of the controller's clock to simulate asynchronous behavior and delays highlights the concurrency model of Go. It also demonstrates how the mediator pattern can manage concurrent operations, such as value updates and notifications.
 
 Conclusion:
 
@@ -35,19 +37,30 @@ This code serves as a practical example of how the mediator and command patterns
 */
 
 func main() {
-	subscriptions()
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+	subscriptions(nil)
 	//patterns.Main()
 }
 
-func subscriptions() {
+// subscriptions runs the demo, configs selects the strategies of its modules by module id, see `mcs demo`
+func subscriptions(configs map[string]Strategies.Config) {
 	controller := TestDesign.NewMasterController()
 	factory := &TestDesign.DefaultModuleFactory{}
+	clock := controller.GetClock()
+	if server, err := controller.ServeHealth("127.0.0.1:8081"); err != nil {
+		fmt.Println(err)
+	} else {
+		defer server.Close()
+	}
 
 	module1 := factory.CreateModule("module1", controller)
 	err := controller.RegisterModule(module1)
 	if err != nil {
 		return
 	}
+	module1.SetHeartbeatConfig(TestDesign.HeartbeatConfig{Interval: time.Second, GracePeriod: 2 * time.Second})
 	module1.TransitionToRunning()
 	module2 := factory.CreateModule("module2", controller)
 	err = controller.RegisterModule(module2)
@@ -65,6 +78,9 @@ func subscriptions() {
 	if err != nil {
 		return
 	}
+	if err := controller.ConfigureStrategies(configs); err != nil {
+		fmt.Println(err)
+	}
 	compressorModule.SubscribeToTopic("x", "module2")
 	compressorModule.SetNotificationCallback(func(valueName string, value any) {
 		fmt.Printf("This is a message from the callback in compressorModule %v %v\n", valueName, value)
@@ -83,24 +99,24 @@ func subscriptions() {
 			x++
 			// Share the updated "x" value with subscribers
 			module2.PublishToTopic("x", x)
-			time.Sleep(500 * time.Millisecond)
+			clock.Sleep(500 * time.Millisecond)
 		}
 	}()
-	time.Sleep(time.Second * 20)
+	clock.Sleep(time.Second * 20)
 	testSubscriptions(controller, module1)
-	time.Sleep(time.Second * 10)
+	clock.Sleep(time.Second * 10)
 	testUnregisterModule(controller, module2)
-	time.Sleep(time.Second * 10)
+	clock.Sleep(time.Second * 10)
 	testErrorState(module1)
-	time.Sleep(time.Second * 10)
+	clock.Sleep(time.Second * 10)
 	testErrorState(module2)
-	time.Sleep(time.Second * 10)
+	clock.Sleep(time.Second * 10)
 
 	unregisterRandomModules(controller, 10)
-	time.Sleep(time.Second * 10)
+	clock.Sleep(time.Second * 10)
 	unregisterRandomModulesAsync(controller, 1000)
 	//Keep main running for a few more seconds before shutting down
-	time.Sleep(time.Second * 10)
+	clock.Sleep(time.Second * 10)
 
 	testCompressorModule(compressorModule)
 	testDispenserModule(dispenserModule)
@@ -164,7 +180,7 @@ func testUnregisterModule(controller *TestDesign.MasterController, module *TestD
 	}
 	fmt.Printf("Unregistered  %s\n", moduleId)
 	fmt.Println("------------------------------------")
-	time.Sleep(time.Second * 10)
+	controller.GetClock().Sleep(time.Second * 10)
 
 	fmt.Printf("registering  %s\n", moduleId)
 	err = controller.RegisterModule(module)
@@ -181,7 +197,7 @@ func testErrorState(module *TestDesign.BaseModule) {
 	module.SetState(TestDesign.ErrorState)
 	fmt.Printf("%v should be in error state\n", module.GetId())
 	fmt.Println("------------------------------------")
-	time.Sleep(time.Second * 10)
+	module.GetClock().Sleep(time.Second * 10)
 	fmt.Println("------------------------------------")
 	fmt.Printf("Putting %v in running state\n", module.GetId())
 	module.SetState(TestDesign.RunningState)
@@ -197,7 +213,7 @@ func unregisterRandomModule(controller *TestDesign.MasterController, module *Tes
 		return
 	}
 	fmt.Printf("Unregistered %v\n", module.GetId())
-	time.Sleep(time.Second * 10)
+	controller.GetClock().Sleep(time.Second * 10)
 	fmt.Println("Registering module:", module.GetId())
 	err = controller.RegisterModule(module)
 	if err != nil {